@@ -0,0 +1,106 @@
+// Команда migrate управляет версионированными миграциями схемы PostgreSQL.
+//
+// Использование:
+//
+//	migrate -d <dsn> up          применить все недостающие миграции
+//	migrate -d <dsn> down [N]    откатить N последних миграций (по умолчанию одну)
+//	migrate -d <dsn> status      показать состояние миграций
+//
+// Строка подключения берётся так же, как у сервиса: из флага -d,
+// переменной окружения DATABASE_DSN или JSON-файла конфигурации.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"github.com/bubaew95/yandex-go-learn/config"
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/logger"
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/repository/postgres"
+)
+
+func main() {
+	if err := run(); err != nil {
+		logger.Log.Fatal("Migration error", zap.Error(err))
+	}
+}
+
+func run() error {
+	if err := logger.Initialize(); err != nil {
+		return fmt.Errorf("logging initialization error: %w", err)
+	}
+
+	cfg := config.NewConfig()
+	if cfg.DataBaseDSN == "" {
+		return errors.New("database DSN is not set")
+	}
+
+	ctx := context.Background()
+
+	db, err := postgres.NewPool(ctx, *cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := postgres.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	switch flag.Arg(0) {
+	case "up":
+		if err = migrator.Up(ctx); err != nil {
+			return err
+		}
+
+		return printVersion(ctx, migrator)
+	case "down":
+		steps := 1
+		if flag.NArg() > 1 {
+			steps, err = strconv.Atoi(flag.Arg(1))
+			if err != nil || steps <= 0 {
+				return fmt.Errorf("invalid number of steps %q", flag.Arg(1))
+			}
+		}
+
+		if err = migrator.Down(ctx, steps); err != nil {
+			return err
+		}
+
+		return printVersion(ctx, migrator)
+	case "status":
+		items, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			applied := "pending"
+			if item.AppliedAt != nil {
+				applied = item.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+
+			fmt.Printf("%04d %-30s %s\n", item.Version, item.Name, applied)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q, expected up, down or status", flag.Arg(0))
+	}
+}
+
+func printVersion(ctx context.Context, migrator *postgres.Migrator) error {
+	version, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Schema version: %d (latest %d)\n", version, migrator.Latest())
+	return nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"expvar"
 	"fmt"
 	chi_middleware "github.com/go-chi/chi/v5/middleware"
 	"golang.org/x/crypto/acme/autocert"
@@ -22,8 +23,12 @@ import (
 	"github.com/bubaew95/yandex-go-learn/internal/adapters/handlers/middleware"
 	"github.com/bubaew95/yandex-go-learn/internal/adapters/logger"
 	fileStorage "github.com/bubaew95/yandex-go-learn/internal/adapters/repository/filestorage"
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/repository/memory"
 	"github.com/bubaew95/yandex-go-learn/internal/adapters/repository/postgres"
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/repository/retry"
 	"github.com/bubaew95/yandex-go-learn/internal/adapters/storage"
+	"github.com/bubaew95/yandex-go-learn/internal/core/idgen"
+	"github.com/bubaew95/yandex-go-learn/internal/core/policy"
 	"github.com/bubaew95/yandex-go-learn/internal/core/service"
 )
 
@@ -51,18 +56,48 @@ func runApp() error {
 	}
 
 	cfg := config.NewConfig()
-	shortenerRepository, err := initRepository(*cfg)
+	backend, err := initRepository(*cfg)
 	if err != nil {
 		return err
 	}
-	defer safeClose(shortenerRepository)
+	defer safeClose(backend.repository)
 
 	var wg sync.WaitGroup
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	shortenerService := service.NewShortenerService(shortenerRepository, *cfg)
+	// Фоновые задачи хранилища останавливаются после сервиса,
+	// чтобы отложенные удаления успели записаться.
+	var storageWg sync.WaitGroup
+	storageCtx, cancelStorage := context.WithCancel(context.Background())
+	defer cancelStorage()
+
+	if backend.compactor != nil {
+		backend.compactor.Run(storageCtx, &storageWg)
+		handleCompactionSignal(storageCtx, backend.compactor)
+	}
+
+	generator, err := initGenerator(storageCtx, &storageWg, *cfg, backend.ranges)
+	if err != nil {
+		return fmt.Errorf("id generator initialization error: %w", err)
+	}
+
+	// Временные ошибки хранилища повторяются, а не превращаются сразу в 500.
+	shortenerService := service.NewShortenerService(retry.NewShortenerRepository(backend.repository, *cfg), generator, *cfg)
 	shortenerService.Run(ctx, &wg)
+	shortenerService.RunPurge(storageCtx, &storageWg)
+	shortenerService.RunExpirySweep(storageCtx, &storageWg)
+
+	if cfg.PolicyBlocklistFile != "" || cfg.PolicyAllowlistFile != "" {
+		domainPolicy, err := policy.New(*cfg)
+		if err != nil {
+			return fmt.Errorf("domain policy initialization error: %w", err)
+		}
+
+		shortenerService.SetPolicy(domainPolicy)
+		domainPolicy.Run(storageCtx, &storageWg)
+		handlePolicySignal(storageCtx, domainPolicy)
+	}
 
 	shortenerHandler := handlers.NewShortenerHandler(shortenerService)
 	route := setupRouter(shortenerHandler)
@@ -103,27 +138,133 @@ func runApp() error {
 	shortenerService.Close()
 
 	wg.Wait()
+
+	cancelStorage()
+	storageWg.Wait()
 	return nil
 }
 
-func initRepository(cfg config.Config) (service.ShortenerRepository, error) {
-	if cfg.DataBaseDSN != "" {
+// storageBackend — репозиторий и связанные с ним компоненты выбранного хранилища.
+type storageBackend struct {
+	repository service.ShortenerRepository
+
+	// compactor — фоновый уплотнитель журнала, только для файлового хранилища.
+	compactor *storage.Compactor
+
+	// ranges — хранилище блоков номеров для стратегии генерации ID block.
+	ranges idgen.RangeStore
+}
+
+// initRepository создаёт репозиторий по конфигурации.
+func initRepository(cfg config.Config) (storageBackend, error) {
+	switch cfg.StorageType {
+	case config.StorageTypePostgres:
 		shortenerRepository, err := postgres.NewShortenerRepository(cfg)
 		if err != nil {
 			logger.Log.Fatal("Database initialization error", zap.Error(err))
 		}
 
-		return shortenerRepository, nil
+		// Состояние пула соединений доступно по /debug/vars.
+		expvar.Publish("postgres_pool", expvar.Func(func() any {
+			return shortenerRepository.Stats()
+		}))
+		expvar.Publish("postgres_replicas", expvar.Func(func() any {
+			return shortenerRepository.Replicas()
+		}))
+
+		return storageBackend{
+			repository: shortenerRepository,
+			ranges:     shortenerRepository.RangeStore(cfg.IDLeaseTTL.Duration),
+		}, nil
+	case config.StorageTypeMemory:
+		logger.Log.Info("Using in-memory storage, data will not be persisted")
+		return storageBackend{
+			repository: memory.NewShortenerRepository(),
+			ranges:     idgen.NewMemoryRangeStore(),
+		}, nil
+	case config.StorageTypeFile:
+		shortenerDB, err := storage.NewShortenerDB(cfg)
+		if err != nil {
+			return storageBackend{}, fmt.Errorf("database file initialization error: %w", err)
+		}
+
+		shortener, err := fileStorage.NewShortenerRepository(*shortenerDB)
+		if err != nil {
+			return storageBackend{}, err
+		}
+
+		return storageBackend{
+			repository: shortener,
+			compactor:  storage.NewCompactor(*shortenerDB),
+			ranges:     shortenerDB.NewRangeStore(),
+		}, nil
+	default:
+		return storageBackend{}, fmt.Errorf("unknown storage type %q", cfg.StorageType)
+	}
+}
+
+// initGenerator создаёт генератор коротких ID. Для стратегии block блоки номеров
+// арендуются в хранилище и возвращаются в него при отмене ctx.
+func initGenerator(ctx context.Context, wg *sync.WaitGroup, cfg config.Config, ranges idgen.RangeStore) (idgen.Generator, error) {
+	if cfg.IDStrategy != config.IDStrategyBlock {
+		return idgen.New(cfg)
 	}
 
-	shortenerDB, err := storage.NewShortenerDB(cfg)
+	leaseCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	block, err := idgen.NewBlock(leaseCtx, cfg, ranges)
 	if err != nil {
-		return nil, fmt.Errorf("database file initialization error: %w", err)
+		return nil, err
 	}
+	block.Run(ctx, wg)
 
-	shortener, err := fileStorage.NewShortenerRepository(*shortenerDB)
+	return block, nil
+}
+
+// handleCompactionSignal запускает внеочередное уплотнение файлового хранилища по сигналу SIGUSR1
+// (только в unix-системах, см. compactionSignals).
+func handleCompactionSignal(ctx context.Context, compactor *storage.Compactor) {
+	if len(compactionSignals) == 0 {
+		return
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, compactionSignals...)
 
-	return shortener, err
+	go func() {
+		defer signal.Stop(ch)
+
+		for {
+			select {
+			case <-ch:
+				logger.Log.Info("Compaction requested by signal")
+				compactor.Trigger()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// handlePolicySignal перечитывает списки доменов по сигналу SIGHUP.
+func handlePolicySignal(ctx context.Context, domainPolicy *policy.Policy) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(ch)
+
+		for {
+			select {
+			case <-ch:
+				logger.Log.Info("Domain policy reload requested by signal")
+				domainPolicy.Trigger()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
 }
 
 func setupRouter(shortenerHandler *handlers.ShortenerHandler) *chi.Mux {
@@ -134,6 +275,7 @@ func setupRouter(shortenerHandler *handlers.ShortenerHandler) *chi.Mux {
 
 	route.Post("/", shortenerHandler.CreateURL)
 	route.Get("/{id}", shortenerHandler.GetURL)
+	route.Post("/{id}", shortenerHandler.UnlockURL)
 	route.Get("/ping", shortenerHandler.Ping)
 
 	route.Route("/api/shorten", func(r chi.Router) {
@@ -144,6 +286,11 @@ func setupRouter(shortenerHandler *handlers.ShortenerHandler) *chi.Mux {
 	route.Route("/api/user", func(r chi.Router) {
 		r.Get("/urls", shortenerHandler.GetUserURLS)
 		r.Delete("/urls", shortenerHandler.DeleteUserURLS)
+		r.Get("/urls/trash", shortenerHandler.GetDeletedURLs)
+		r.Post("/urls/trash/{id}/restore", shortenerHandler.RestoreDeletedURL)
+		r.Patch("/urls/{id}", shortenerHandler.UpdateUserURL)
+		r.Get("/urls/{id}/history", shortenerHandler.GetURLHistory)
+		r.Post("/urls/{id}/history/{version}/restore", shortenerHandler.RestoreURL)
 	})
 
 	route.Mount("/debug", chi_middleware.Profiler())
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// compactionSignals пуст: SIGUSR1 есть только в unix-системах, здесь уплотнение
+// запускается только автоматически, по размеру файла и числу записей.
+var compactionSignals []os.Signal
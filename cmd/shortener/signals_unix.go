@@ -0,0 +1,11 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// compactionSignals — сигналы внеочередного уплотнения файлового хранилища.
+var compactionSignals = []os.Signal{syscall.SIGUSR1}
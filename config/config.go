@@ -10,6 +10,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Config содержит параметры конфигурации приложения.
@@ -26,8 +27,270 @@ type Config struct {
 	// DataBaseDSN строка подключения к базе данных
 	DataBaseDSN string `json:"database_dsn"`
 
+	// DataBaseReplicaDSNs строки подключения к репликам PostgreSQL для чтения
+	DataBaseReplicaDSNs []string `json:"database_replica_dsns"`
+
+	// DBMaxConns максимальное число соединений в пуле PostgreSQL
+	DBMaxConns int32 `json:"db_max_conns"`
+
+	// DBMinConns минимальное число соединений, поддерживаемых в пуле PostgreSQL
+	DBMinConns int32 `json:"db_min_conns"`
+
+	// DBMaxConnLifetime максимальное время жизни соединения в пуле
+	DBMaxConnLifetime Duration `json:"db_max_conn_lifetime"`
+
+	// DBStatementTimeout ограничение времени выполнения одного SQL-запроса (statement_timeout)
+	DBStatementTimeout Duration `json:"db_statement_timeout"`
+
+	// DBAcquireTimeout максимальное время ожидания свободного соединения из пула
+	DBAcquireTimeout Duration `json:"db_acquire_timeout"`
+
+	// RetryMaxAttempts число попыток вызова хранилища при временных ошибках (1 — без повторов)
+	RetryMaxAttempts int `json:"retry_max_attempts"`
+
+	// RetryInitialBackoff пауза перед первым повтором; далее удваивается
+	RetryInitialBackoff Duration `json:"retry_initial_backoff"`
+
+	// RetryMaxBackoff максимальная пауза между повторами
+	RetryMaxBackoff Duration `json:"retry_max_backoff"`
+
+	// RetryOperations переопределяет политику повторов для отдельных операций хранилища
+	// (ключ — имя метода репозитория, например "SetURL"). Задаётся только в JSON-файле.
+	RetryOperations map[string]RetryPolicy `json:"retry_operations"`
+
+	// MaxURLLength максимальная длина сокращаемого URL в байтах (0 — без ограничения)
+	MaxURLLength int `json:"max_url_length"`
+
+	// URLAllowedSchemes схемы, с которыми принимаются сокращаемые URL
+	URLAllowedSchemes []string `json:"url_allowed_schemes"`
+
+	// URLCanonicalization приведение URL к каноническому виду перед сохранением: basic или off
+	URLCanonicalization string `json:"url_canonicalization"`
+
+	// URLSortQuery сортировать параметры запроса при приведении URL
+	URLSortQuery bool `json:"url_sort_query"`
+
+	// URLStripTracking удалять рекламные параметры запроса при приведении URL
+	URLStripTracking bool `json:"url_strip_tracking"`
+
+	// URLTrackingParams рекламные параметры, удаляемые при URLStripTracking; "utm_*" задаёт префикс.
+	// Если не задан, используется встроенный список
+	URLTrackingParams []string `json:"url_tracking_params"`
+
+	// PurgeRetention время хранения удалённых ссылок до окончательного удаления
+	// (0 — не удалять, по умолчанию)
+	PurgeRetention Duration `json:"purge_retention"`
+
+	// PurgeInterval период запуска очистки удалённых ссылок
+	PurgeInterval Duration `json:"purge_interval"`
+
+	// PurgeBatchSize максимальное число ссылок, удаляемых за один запрос к хранилищу
+	PurgeBatchSize int `json:"purge_batch_size"`
+
+	// PurgeReuseIDs разрешает повторно выдавать короткие ID окончательно удалённых ссылок
+	PurgeReuseIDs bool `json:"purge_reuse_ids"`
+
+	// PolicyBlocklistFile путь к файлу со списком запрещённых доменов
+	PolicyBlocklistFile string `json:"policy_blocklist_file"`
+
+	// PolicyAllowlistFile путь к файлу со списком разрешённых доменов; если список не пуст,
+	// сокращаются только ссылки на эти домены
+	PolicyAllowlistFile string `json:"policy_allowlist_file"`
+
+	// PolicyReloadInterval период проверки изменения файлов списков доменов
+	PolicyReloadInterval Duration `json:"policy_reload_interval"`
+
+	// PolicyDisableExisting отключать переход по уже созданным ссылкам на запрещённые домены
+	PolicyDisableExisting bool `json:"policy_disable_existing"`
+
+	// RestoreWindow время после удаления, в течение которого пользователь может восстановить ссылку.
+	// Удалённые ссылки не очищаются окончательно, пока не закончится это время
+	RestoreWindow Duration `json:"restore_window"`
+
+	// DefaultLinkTTL срок жизни ссылки, если при создании он не указан (0 — бессрочно)
+	DefaultLinkTTL Duration `json:"default_link_ttl"`
+
+	// MaxLinkTTL максимальный срок жизни ссылки (0 — без ограничения)
+	MaxLinkTTL Duration `json:"max_link_ttl"`
+
+	// ExpirySweepInterval период пометки истёкших ссылок удалёнными (0 — не помечать)
+	ExpirySweepInterval Duration `json:"expiry_sweep_interval"`
+
+	// PasswordMaxAttempts число неудачных попыток ввода пароля ссылки, после которого
+	// попытки для этой ссылки временно блокируются (0 — без ограничения)
+	PasswordMaxAttempts int `json:"password_max_attempts"`
+
+	// PasswordLockout время блокировки попыток ввода пароля ссылки
+	PasswordLockout Duration `json:"password_lockout"`
+
+	// IDStrategy стратегия генерации коротких ID: random, counter, hash, sequential или block
+	IDStrategy string `json:"id_strategy"`
+
+	// IDAlphabet символы, из которых составляется короткий ID
+	IDAlphabet string `json:"id_alphabet"`
+
+	// IDLength длина короткого ID без префикса
+	IDLength int `json:"id_length"`
+
+	// IDPrefix префикс, добавляемый к каждому короткому ID
+	IDPrefix string `json:"id_prefix"`
+
+	// IDSecret ключ для стратегий hash и sequential: без него ID можно предсказать
+	IDSecret string `json:"id_secret"`
+
+	// IDBlockSize число порядковых номеров, арендуемых экземпляром за раз в стратегии block
+	IDBlockSize int `json:"id_block_size"`
+
+	// IDLeaseTTL срок аренды блока номеров; аренда продлевается в фоне, пока экземпляр работает
+	IDLeaseTTL Duration `json:"id_lease_ttl"`
+
+	// StorageType тип хранилища: postgres, file или memory.
+	// Если не задан, выбирается по DataBaseDSN и FilePath.
+	StorageType string `json:"storage_type"`
+
 	// EnableHTTPS Включить https протокол
 	EnableHTTPS bool `json:"enable_https"`
+
+	// FileCompactSize размер хвостового сегмента файла в байтах, после которого запускается уплотнение;
+	// 0 отключает проверку размера
+	FileCompactSize int64 `json:"file_compact_size"`
+
+	// FileCompactRatio отношение числа записей в хвостовом сегменте к числу записей в снимке,
+	// после которого запускается уплотнение; 0 отключает проверку отношения
+	FileCompactRatio float64 `json:"file_compact_ratio"`
+
+	// FileRecoveryMode режим восстановления файла при запуске: repair или strict
+	FileRecoveryMode string `json:"file_recovery_mode"`
+
+	// FileSyncPolicy политика сброса записей на диск: always, interval или never
+	FileSyncPolicy string `json:"file_sync_policy"`
+
+	// FileSyncInterval период сброса записей на диск для политики interval
+	FileSyncInterval Duration `json:"file_sync_interval"`
+}
+
+// RetryPolicy — политика повторов для одной операции хранилища.
+// Незаданные (нулевые) поля берутся из общих настроек Retry*.
+type RetryPolicy struct {
+	// MaxAttempts число попыток, включая первую
+	MaxAttempts int `json:"max_attempts"`
+
+	// InitialBackoff пауза перед первым повтором
+	InitialBackoff Duration `json:"initial_backoff"`
+
+	// MaxBackoff максимальная пауза между повторами
+	MaxBackoff Duration `json:"max_backoff"`
+}
+
+// Стратегии генерации коротких ID.
+const (
+	IDStrategyRandom     = "random"     // Криптографически случайный ID
+	IDStrategyCounter    = "counter"    // Счётчик в системе счисления алфавита
+	IDStrategyHash       = "hash"       // Хеш оригинального URL
+	IDStrategySequential = "sequential" // Перемешанный счётчик
+	IDStrategyBlock      = "block"      // Счётчик с арендой блоков номеров в хранилище
+)
+
+// Режимы приведения URL к каноническому виду.
+const (
+	URLCanonicalizationBasic = "basic" // Регистр, порт, экранирование и путь
+	URLCanonicalizationOff   = "off"   // URL сохраняется как есть
+)
+
+// Типы хранилищ.
+const (
+	StorageTypePostgres = "postgres" // PostgreSQL
+	StorageTypeFile     = "file"     // JSONL-файл
+	StorageTypeMemory   = "memory"   // Только память процесса
+)
+
+const (
+	defaultDBMaxConns         = 10
+	defaultDBMaxConnLifetime  = time.Hour
+	defaultDBStatementTimeout = 5 * time.Second
+	defaultDBAcquireTimeout   = 3 * time.Second
+)
+
+const defaultMaxURLLength = 32 << 10
+
+// defaultURLAllowedSchemes — схемы сокращаемых URL, если в конфигурации не заданы свои.
+var defaultURLAllowedSchemes = []string{"http", "https"}
+
+const (
+	defaultIDAlphabet  = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	defaultIDLength    = 8
+	defaultIDBlockSize = 1000
+	defaultIDLeaseTTL  = 5 * time.Minute
+)
+
+const defaultExpirySweepInterval = time.Minute
+
+const defaultPolicyReloadInterval = 10 * time.Second
+
+const (
+	defaultPasswordMaxAttempts = 5
+	defaultPasswordLockout     = 15 * time.Minute
+)
+
+// Окончательное удаление включается явно заданным PurgeRetention.
+const (
+	defaultPurgeInterval  = time.Hour
+	defaultPurgeBatchSize = 500
+	defaultRestoreWindow  = 7 * 24 * time.Hour
+)
+
+const (
+	defaultRetryMaxAttempts    = 3
+	defaultRetryInitialBackoff = 50 * time.Millisecond
+	defaultRetryMaxBackoff     = time.Second
+)
+
+const (
+	defaultFileCompactSize  = 64 << 20
+	defaultFileCompactRatio = 4
+	defaultFileRecoveryMode = "repair"
+)
+
+// Политика сброса файлового хранилища на диск по умолчанию. Используется и
+// хранилищем, созданным без NewConfig.
+const (
+	DefaultFileSyncPolicy   = "interval"
+	DefaultFileSyncInterval = time.Second
+)
+
+// Duration — обёртка над time.Duration, которая в JSON-конфигурации
+// записывается строкой в формате time.ParseDuration (например, "1m30s").
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON разбирает длительность из строки ("5s") или из числа наносекунд.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	switch value := v.(type) {
+	case float64:
+		d.Duration = time.Duration(value)
+		return nil
+	case string:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+
+		d.Duration = parsed
+		return nil
+	default:
+		return fmt.Errorf("invalid duration: %s", string(b))
+	}
+}
+
+// MarshalJSON записывает длительность строкой.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
 }
 
 // NewConfig создает и возвращает структуру конфигурации Config,
@@ -41,7 +304,48 @@ func NewConfig() *Config {
 	baseURL := flag.String("b", "", "Базовый адрес сокращённого URL")
 	filePath := flag.String("f", "", "Путь до JSON-файла")
 	databaseDSN := flag.String("d", "", "Строка подключения к базе данных")
+	databaseReplicaDSNs := flag.String("replicas", "", "Строки подключения к репликам базы данных через запятую")
+	storageType := flag.String("storage", "", "Тип хранилища: postgres, file или memory")
+	dbMaxConns := flag.Int("db-max-conns", 0, "Максимальное число соединений с базой данных")
+	dbMinConns := flag.Int("db-min-conns", 0, "Минимальное число соединений с базой данных")
+	dbMaxConnLifetime := flag.Duration("db-max-conn-lifetime", 0, "Максимальное время жизни соединения с базой данных")
+	dbStatementTimeout := flag.Duration("db-statement-timeout", 0, "Ограничение времени выполнения SQL-запроса")
+	dbAcquireTimeout := flag.Duration("db-acquire-timeout", 0, "Время ожидания свободного соединения с базой данных")
+	retryMaxAttempts := flag.Int("retry-attempts", 0, "Число попыток вызова хранилища при временных ошибках")
+	retryInitialBackoff := flag.Duration("retry-backoff", 0, "Пауза перед первым повтором вызова хранилища")
+	retryMaxBackoff := flag.Duration("retry-max-backoff", 0, "Максимальная пауза между повторами вызова хранилища")
+	maxURLLength := flag.Int("max-url-length", 0, "Максимальная длина сокращаемого URL в байтах")
+	urlAllowedSchemes := flag.String("allowed-schemes", "", "Схемы сокращаемых URL через запятую")
+	urlCanonicalization := flag.String("canonicalize", "", "Приведение URL к каноническому виду: basic или off")
+	urlSortQuery := flag.Bool("sort-query", false, "Сортировать параметры запроса при приведении URL")
+	urlStripTracking := flag.Bool("strip-tracking", false, "Удалять рекламные параметры запроса при приведении URL")
+	urlTrackingParams := flag.String("tracking-params", "", "Рекламные параметры запроса через запятую")
+	purgeRetention := flag.Duration("purge-retention", 0, "Время хранения удалённых ссылок до окончательного удаления")
+	purgeInterval := flag.Duration("purge-interval", 0, "Период запуска очистки удалённых ссылок")
+	purgeBatchSize := flag.Int("purge-batch", 0, "Число ссылок, удаляемых за один запрос к хранилищу")
+	purgeReuseIDs := flag.Bool("purge-reuse-ids", false, "Разрешить повторную выдачу ID окончательно удалённых ссылок")
+	policyBlocklistFile := flag.String("blocklist", "", "Путь к файлу со списком запрещённых доменов")
+	policyAllowlistFile := flag.String("allowlist", "", "Путь к файлу со списком разрешённых доменов")
+	policyReloadInterval := flag.Duration("policy-reload-interval", 0, "Период проверки изменения файлов списков доменов")
+	policyDisableExisting := flag.Bool("policy-disable-existing", false, "Отключать переход по ссылкам на запрещённые домены")
+	restoreWindow := flag.Duration("restore-window", 0, "Время после удаления, в течение которого ссылку можно восстановить")
+	defaultLinkTTL := flag.Duration("default-link-ttl", 0, "Срок жизни ссылки по умолчанию")
+	maxLinkTTL := flag.Duration("max-link-ttl", 0, "Максимальный срок жизни ссылки")
+	expirySweepInterval := flag.Duration("expiry-sweep-interval", 0, "Период пометки истёкших ссылок удалёнными")
+	passwordMaxAttempts := flag.Int("password-attempts", 0, "Число неудачных попыток ввода пароля ссылки до блокировки")
+	passwordLockout := flag.Duration("password-lockout", 0, "Время блокировки попыток ввода пароля ссылки")
+	idStrategy := flag.String("id-strategy", "", "Стратегия генерации коротких ID: random, counter, hash, sequential или block")
+	idAlphabet := flag.String("id-alphabet", "", "Символы, из которых составляется короткий ID")
+	idLength := flag.Int("id-length", 0, "Длина короткого ID без префикса")
+	idPrefix := flag.String("id-prefix", "", "Префикс короткого ID")
+	idBlockSize := flag.Int("id-block-size", 0, "Число номеров, арендуемых за раз в стратегии block")
+	idLeaseTTL := flag.Duration("id-lease-ttl", 0, "Срок аренды блока номеров в стратегии block")
 	enableHTTPS := flag.Bool("s", false, "Включить HTTPS")
+	fileCompactSize := flag.Int64("compact-size", 0, "Размер файла в байтах, после которого запускается уплотнение (0 — не учитывать размер)")
+	fileCompactRatio := flag.Float64("compact-ratio", 0, "Отношение записей хвоста к записям снимка для запуска уплотнения (0 — не учитывать отношение)")
+	fileRecoveryMode := flag.String("recovery", "", "Режим восстановления файла при запуске: repair или strict")
+	fileSyncPolicy := flag.String("sync", "", "Политика сброса файла на диск: always, interval или never")
+	fileSyncInterval := flag.Duration("sync-interval", 0, "Период сброса файла на диск для политики interval")
 
 	flag.StringVar(&fileConfigPath, "c", "", "Путь к JSON файлу конфигурации")
 	flag.StringVar(&fileConfigPath, "config", "", "Путь к JSON файлу конфигурации")
@@ -52,11 +356,19 @@ func NewConfig() *Config {
 		fileConfigPath = envFileConfig
 	}
 
+	// Для параметров, у которых 0 — осмысленное значение, учитывается, задан ли параметр
+	// явно: иначе 0 нельзя отличить от отсутствующего значения.
+	explicit := explicitOptions{flags: make(map[string]bool)}
+	flag.Visit(func(f *flag.Flag) {
+		explicit.flags[f.Name] = true
+	})
+
 	if fileConfigPath != "" {
-		err := getFileConfigs(fileConfigPath, &config)
+		keys, err := getFileConfigs(fileConfigPath, &config)
 		if err != nil {
 			logger.Log.Debug("Config file error", zap.Error(err))
 		}
+		explicit.file = keys
 	}
 
 	config.ServerAddress = cmp.Or(os.Getenv("SERVER_ADDRESS"), *serverAddress, config.ServerAddress, "8080")
@@ -68,6 +380,110 @@ func NewConfig() *Config {
 	config.BaseURL = cmp.Or(os.Getenv("BASE_URL"), *baseURL, config.BaseURL, fmt.Sprintf("http://localhost%s", config.ServerAddress))
 	config.FilePath = cmp.Or(os.Getenv("FILE_STORAGE_PATH"), *filePath, config.FilePath, "data.json")
 	config.DataBaseDSN = cmp.Or(os.Getenv("DATABASE_DSN"), *databaseDSN, config.DataBaseDSN)
+	if replicas := cmp.Or(os.Getenv("DATABASE_REPLICA_DSNS"), *databaseReplicaDSNs); replicas != "" {
+		config.DataBaseReplicaDSNs = splitList(replicas)
+	}
+
+	config.DBMaxConns = cmp.Or(int32(envInt64("DB_MAX_CONNS")), int32(*dbMaxConns), config.DBMaxConns, defaultDBMaxConns)
+	config.DBMinConns = cmp.Or(int32(envInt64("DB_MIN_CONNS")), int32(*dbMinConns), config.DBMinConns)
+	config.DBMaxConnLifetime.Duration = cmp.Or(envDuration("DB_MAX_CONN_LIFETIME"), *dbMaxConnLifetime, config.DBMaxConnLifetime.Duration, defaultDBMaxConnLifetime)
+	config.DBStatementTimeout.Duration = cmp.Or(envDuration("DB_STATEMENT_TIMEOUT"), *dbStatementTimeout, config.DBStatementTimeout.Duration, defaultDBStatementTimeout)
+	config.DBAcquireTimeout.Duration = cmp.Or(envDuration("DB_ACQUIRE_TIMEOUT"), *dbAcquireTimeout, config.DBAcquireTimeout.Duration, defaultDBAcquireTimeout)
+	config.MaxURLLength = explicit.int("MAX_URL_LENGTH", "max-url-length", "max_url_length", *maxURLLength, config.MaxURLLength, defaultMaxURLLength)
+	if schemes := cmp.Or(os.Getenv("URL_ALLOWED_SCHEMES"), *urlAllowedSchemes); schemes != "" {
+		config.URLAllowedSchemes = splitList(schemes)
+	}
+
+	if len(config.URLAllowedSchemes) == 0 {
+		config.URLAllowedSchemes = defaultURLAllowedSchemes
+	}
+
+	config.URLCanonicalization = cmp.Or(os.Getenv("URL_CANONICALIZATION"), *urlCanonicalization, config.URLCanonicalization, URLCanonicalizationBasic)
+	if trackingParams := cmp.Or(os.Getenv("URL_TRACKING_PARAMS"), *urlTrackingParams); trackingParams != "" {
+		config.URLTrackingParams = splitList(trackingParams)
+	}
+
+	if *urlSortQuery {
+		config.URLSortQuery = *urlSortQuery
+	}
+
+	if envURLSortQuery := os.Getenv("URL_SORT_QUERY"); envURLSortQuery != "" {
+		sortQuery, err := strconv.ParseBool(envURLSortQuery)
+		if err == nil {
+			config.URLSortQuery = sortQuery
+		}
+	}
+
+	if *urlStripTracking {
+		config.URLStripTracking = *urlStripTracking
+	}
+
+	if envURLStripTracking := os.Getenv("URL_STRIP_TRACKING"); envURLStripTracking != "" {
+		stripTracking, err := strconv.ParseBool(envURLStripTracking)
+		if err == nil {
+			config.URLStripTracking = stripTracking
+		}
+	}
+
+	config.IDStrategy = cmp.Or(os.Getenv("ID_STRATEGY"), *idStrategy, config.IDStrategy, IDStrategyRandom)
+	config.IDAlphabet = cmp.Or(os.Getenv("ID_ALPHABET"), *idAlphabet, config.IDAlphabet, defaultIDAlphabet)
+	config.IDLength = cmp.Or(int(envInt64("ID_LENGTH")), *idLength, config.IDLength, defaultIDLength)
+	config.IDPrefix = cmp.Or(os.Getenv("ID_PREFIX"), *idPrefix, config.IDPrefix)
+	config.IDSecret = cmp.Or(os.Getenv("ID_SECRET"), config.IDSecret)
+	config.IDBlockSize = cmp.Or(int(envInt64("ID_BLOCK_SIZE")), *idBlockSize, config.IDBlockSize, defaultIDBlockSize)
+	config.IDLeaseTTL.Duration = cmp.Or(envDuration("ID_LEASE_TTL"), *idLeaseTTL, config.IDLeaseTTL.Duration, defaultIDLeaseTTL)
+	config.PurgeRetention.Duration = cmp.Or(envDuration("PURGE_RETENTION"), *purgeRetention, config.PurgeRetention.Duration)
+	config.PurgeInterval.Duration = cmp.Or(envDuration("PURGE_INTERVAL"), *purgeInterval, config.PurgeInterval.Duration, defaultPurgeInterval)
+	config.PurgeBatchSize = cmp.Or(int(envInt64("PURGE_BATCH_SIZE")), *purgeBatchSize, config.PurgeBatchSize, defaultPurgeBatchSize)
+	config.RestoreWindow.Duration = cmp.Or(envDuration("RESTORE_WINDOW"), *restoreWindow, config.RestoreWindow.Duration, defaultRestoreWindow)
+
+	if *purgeReuseIDs {
+		config.PurgeReuseIDs = *purgeReuseIDs
+	}
+
+	if envPurgeReuseIDs := os.Getenv("PURGE_REUSE_IDS"); envPurgeReuseIDs != "" {
+		reuse, err := strconv.ParseBool(envPurgeReuseIDs)
+		if err == nil {
+			config.PurgeReuseIDs = reuse
+		}
+	}
+
+	config.PolicyBlocklistFile = cmp.Or(os.Getenv("POLICY_BLOCKLIST_FILE"), *policyBlocklistFile, config.PolicyBlocklistFile)
+	config.PolicyAllowlistFile = cmp.Or(os.Getenv("POLICY_ALLOWLIST_FILE"), *policyAllowlistFile, config.PolicyAllowlistFile)
+	config.PolicyReloadInterval.Duration = cmp.Or(envDuration("POLICY_RELOAD_INTERVAL"), *policyReloadInterval, config.PolicyReloadInterval.Duration, defaultPolicyReloadInterval)
+
+	if *policyDisableExisting {
+		config.PolicyDisableExisting = *policyDisableExisting
+	}
+
+	if envPolicyDisableExisting := os.Getenv("POLICY_DISABLE_EXISTING"); envPolicyDisableExisting != "" {
+		disable, err := strconv.ParseBool(envPolicyDisableExisting)
+		if err == nil {
+			config.PolicyDisableExisting = disable
+		}
+	}
+
+	config.DefaultLinkTTL.Duration = cmp.Or(envDuration("DEFAULT_LINK_TTL"), *defaultLinkTTL, config.DefaultLinkTTL.Duration)
+	config.MaxLinkTTL.Duration = cmp.Or(envDuration("MAX_LINK_TTL"), *maxLinkTTL, config.MaxLinkTTL.Duration)
+	config.ExpirySweepInterval.Duration = explicit.duration("EXPIRY_SWEEP_INTERVAL", "expiry-sweep-interval", "expiry_sweep_interval", *expirySweepInterval, config.ExpirySweepInterval.Duration, defaultExpirySweepInterval)
+	config.PasswordMaxAttempts = explicit.int("PASSWORD_MAX_ATTEMPTS", "password-attempts", "password_max_attempts", *passwordMaxAttempts, config.PasswordMaxAttempts, defaultPasswordMaxAttempts)
+	config.PasswordLockout.Duration = cmp.Or(envDuration("PASSWORD_LOCKOUT"), *passwordLockout, config.PasswordLockout.Duration, defaultPasswordLockout)
+
+	config.RetryMaxAttempts = cmp.Or(int(envInt64("RETRY_MAX_ATTEMPTS")), *retryMaxAttempts, config.RetryMaxAttempts, defaultRetryMaxAttempts)
+	config.RetryInitialBackoff.Duration = cmp.Or(envDuration("RETRY_INITIAL_BACKOFF"), *retryInitialBackoff, config.RetryInitialBackoff.Duration, defaultRetryInitialBackoff)
+	config.RetryMaxBackoff.Duration = cmp.Or(envDuration("RETRY_MAX_BACKOFF"), *retryMaxBackoff, config.RetryMaxBackoff.Duration, defaultRetryMaxBackoff)
+
+	// Явно пустой FILE_STORAGE_PATH означает работу без файла.
+	if envFilePath, ok := os.LookupEnv("FILE_STORAGE_PATH"); ok && envFilePath == "" {
+		config.FilePath = ""
+	}
+
+	config.StorageType = cmp.Or(os.Getenv("STORAGE_TYPE"), *storageType, config.StorageType, defaultStorageType(config))
+	config.FileCompactSize = explicit.int64("FILE_COMPACT_SIZE", "compact-size", "file_compact_size", *fileCompactSize, config.FileCompactSize, defaultFileCompactSize)
+	config.FileCompactRatio = explicit.float64("FILE_COMPACT_RATIO", "compact-ratio", "file_compact_ratio", *fileCompactRatio, config.FileCompactRatio, defaultFileCompactRatio)
+	config.FileRecoveryMode = cmp.Or(os.Getenv("FILE_RECOVERY_MODE"), *fileRecoveryMode, config.FileRecoveryMode, defaultFileRecoveryMode)
+	config.FileSyncPolicy = cmp.Or(os.Getenv("FILE_SYNC_POLICY"), *fileSyncPolicy, config.FileSyncPolicy, DefaultFileSyncPolicy)
+	config.FileSyncInterval.Duration = cmp.Or(envDuration("FILE_SYNC_INTERVAL"), *fileSyncInterval, config.FileSyncInterval.Duration, DefaultFileSyncInterval)
 
 	if *enableHTTPS {
 		config.EnableHTTPS = *enableHTTPS
@@ -83,11 +499,148 @@ func NewConfig() *Config {
 	return &config
 }
 
-func getFileConfigs(filePath string, cfg *Config) error {
+func defaultStorageType(c Config) string {
+	if c.DataBaseDSN != "" {
+		return StorageTypePostgres
+	}
+
+	if c.FilePath == "" {
+		return StorageTypeMemory
+	}
+
+	return StorageTypeFile
+}
+
+// splitList разбирает список значений, разделённых запятыми, пропуская пустые.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+func envInt64(name string) int64 {
+	v, err := strconv.ParseInt(os.Getenv(name), 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return v
+}
+
+func envDuration(name string) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(name))
+	if err != nil {
+		return 0
+	}
+
+	return v
+}
+
+// getFileConfigs читает JSON-файл конфигурации в cfg и возвращает ключи, заданные в файле.
+func getFileConfigs(filePath string, cfg *Config) (map[string]bool, error) {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+
+	var raw map[string]json.RawMessage
+	if err = json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]bool, len(raw))
+	for key := range raw {
+		keys[key] = true
+	}
+
+	return keys, nil
+}
+
+// explicitOptions — параметры, явно заданные флагами и в JSON-файле конфигурации.
+type explicitOptions struct {
+	flags map[string]bool
+	file  map[string]bool
+}
+
+// int выбирает значение параметра с приоритетом переменная окружения env > флаг flagName >
+// ключ JSON-файла fileKey > def. В отличие от cmp.Or, явно заданный 0 не заменяется
+// следующим по приоритету значением.
+func (e explicitOptions) int(env, flagName, fileKey string, flagValue, fileValue, def int) int {
+	if v, ok := os.LookupEnv(env); ok {
+		if parsed, err := strconv.Atoi(v); err == nil {
+			return parsed
+		}
+	}
+
+	switch {
+	case e.flags[flagName]:
+		return flagValue
+	case e.file[fileKey]:
+		return fileValue
+	default:
+		return def
+	}
+}
+
+// int64 выбирает целое значение так же, как int.
+func (e explicitOptions) int64(env, flagName, fileKey string, flagValue, fileValue, def int64) int64 {
+	if v, ok := os.LookupEnv(env); ok {
+		if parsed, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return parsed
+		}
+	}
+
+	switch {
+	case e.flags[flagName]:
+		return flagValue
+	case e.file[fileKey]:
+		return fileValue
+	default:
+		return def
+	}
+}
+
+// float64 выбирает дробное значение так же, как int.
+func (e explicitOptions) float64(env, flagName, fileKey string, flagValue, fileValue, def float64) float64 {
+	if v, ok := os.LookupEnv(env); ok {
+		if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+			return parsed
+		}
 	}
 
-	return json.Unmarshal(data, &cfg)
+	switch {
+	case e.flags[flagName]:
+		return flagValue
+	case e.file[fileKey]:
+		return fileValue
+	default:
+		return def
+	}
+}
+
+// duration выбирает длительность так же, как int.
+func (e explicitOptions) duration(env, flagName, fileKey string, flagValue, fileValue, def time.Duration) time.Duration {
+	if v, ok := os.LookupEnv(env); ok {
+		if parsed, err := time.ParseDuration(v); err == nil {
+			return parsed
+		}
+	}
+
+	switch {
+	case e.flags[flagName]:
+		return flagValue
+	case e.file[fileKey]:
+		return fileValue
+	default:
+		return def
+	}
 }
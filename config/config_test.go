@@ -0,0 +1,58 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplicitOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      string
+		flags    map[string]bool
+		file     map[string]bool
+		fileInt  int
+		wantInt  int
+		wantTime time.Duration
+	}{
+		{name: "default", wantInt: 5, wantTime: time.Minute},
+		{name: "zero in file", file: map[string]bool{"key": true}, wantInt: 0, wantTime: 0},
+		{name: "file", file: map[string]bool{"key": true}, fileInt: 7, wantInt: 7, wantTime: 0},
+		{name: "zero flag over file", flags: map[string]bool{"flag": true}, file: map[string]bool{"key": true}, fileInt: 7, wantInt: 0, wantTime: 0},
+		{name: "zero env over flag", env: "0", flags: map[string]bool{"flag": true}, wantInt: 0, wantTime: 0},
+		{name: "invalid env ignored", env: "x", wantInt: 5, wantTime: time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env != "" {
+				t.Setenv("TEST_OPTION", tt.env)
+			}
+
+			e := explicitOptions{flags: tt.flags, file: tt.file}
+			assert.Equal(t, tt.wantInt, e.int("TEST_OPTION", "flag", "key", 0, tt.fileInt, 5))
+			assert.Equal(t, int64(tt.wantInt), e.int64("TEST_OPTION", "flag", "key", 0, int64(tt.fileInt), 5))
+			assert.Equal(t, float64(tt.wantInt), e.float64("TEST_OPTION", "flag", "key", 0, float64(tt.fileInt), 5))
+			assert.Equal(t, tt.wantTime, e.duration("TEST_OPTION", "flag", "key", 0, 0, time.Minute))
+		})
+	}
+}
+
+func TestGetFileConfigs(t *testing.T) {
+	t.Parallel()
+
+	filePath := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(filePath, []byte(`{"max_url_length": 0, "purge_retention": "1h"}`), 0o644))
+
+	var cfg Config
+	keys, err := getFileConfigs(filePath, &cfg)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]bool{"max_url_length": true, "purge_retention": true}, keys)
+	assert.Equal(t, time.Hour, cfg.PurgeRetention.Duration)
+}
@@ -1,9 +1,98 @@
 package constants
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // Ошибки.
 var (
-	ErrUniqueIndex = errors.New("url already exists") // Такой url уже существует
-	ErrIsDeleted   = errors.New("url is deleted")     // Url удален
+	ErrUniqueIndex         = errors.New("url already exists")          // Такой url уже существует
+	ErrIDConflict          = errors.New("id already exists")           // Короткий ID уже занят другой ссылкой
+	ErrIDAttemptsExhausted = errors.New("no free id found")            // Генератор не нашёл свободный короткий ID за допустимое число попыток
+	ErrIsDeleted           = errors.New("url is deleted")              // Url удален
+	ErrNotFound            = errors.New("url not found")               // Ссылка не найдена
+	ErrNotOwner            = errors.New("url belongs to another user") // Ссылка принадлежит другому пользователю
+	ErrVersionNotFound     = errors.New("url version not found")       // В истории ссылки нет такой версии
+	ErrRestoreWindowPassed = errors.New("restore window has passed")   // Время, в течение которого удалённую ссылку можно восстановить, истекло
+	ErrExpired             = errors.New("url is expired")              // Срок жизни ссылки истёк
+	ErrInvalidExpiry       = errors.New("invalid expiry")              // Срок жизни ссылки задан неверно
+	ErrNoClicksLeft        = errors.New("url has no clicks left")      // Лимит переходов по ссылке исчерпан
+	ErrInvalidClicks       = errors.New("invalid max clicks")          // Лимит переходов задан неверно
+	ErrPasswordRequired    = errors.New("password required")           // Ссылка защищена паролем
+	ErrWrongPassword       = errors.New("wrong password")              // Пароль ссылки не подошёл
+	ErrInvalidPassword     = errors.New("invalid password")            // Пароль ссылки не подходит для хранения
+	ErrTooManyAttempts     = errors.New("too many password attempts")  // Превышено число неудачных попыток ввода пароля
+	ErrURLTooLong          = errors.New("url is too long")             // Url длиннее допустимого
+	ErrEmptyURL            = errors.New("url is empty")                // Url не задан
+	ErrInvalidURL          = errors.New("invalid url")                 // Url не прошёл проверку
+	ErrForbiddenURL        = errors.New("url is forbidden by policy")  // Домен url запрещён политикой
+	ErrDegraded            = errors.New("storage is degraded")         // Хранилище работает, но часть узлов недоступна
+	ErrInvalidAlias        = errors.New("invalid alias")               // Пользовательский ID не прошёл проверку
+	ErrReservedAlias       = errors.New("alias is reserved")           // Пользовательский ID совпадает с путём роутера
+)
+
+// Машиночитаемые причины, по которым URL не прошёл проверку.
+const (
+	URLReasonEmpty            = "empty"              // Url не задан
+	URLReasonTooLong          = "too_long"           // Url длиннее допустимого
+	URLReasonControlChars     = "control_characters" // Url содержит управляющие символы
+	URLReasonMalformed        = "malformed"          // Url не удалось разобрать
+	URLReasonMissingScheme    = "missing_scheme"     // Url относительный или без схемы
+	URLReasonSchemeNotAllowed = "scheme_not_allowed" // Схема url не разрешена
+	URLReasonMissingHost      = "missing_host"       // В url нет хоста
+	URLReasonInvalidHost      = "invalid_host"       // Хост url нельзя перевести в punycode
+)
+
+// URLError — ошибка проверки URL с машиночитаемой причиной Reason.
+// errors.Is сопоставляет её с ErrInvalidURL и с Err, если он задан.
+type URLError struct {
+	Reason string
+	Err    error
+}
+
+// Error возвращает текст Err, а если он не задан — ErrInvalidURL с причиной.
+func (e *URLError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+
+	return ErrInvalidURL.Error() + ": " + e.Reason
+}
+
+// Unwrap возвращает ErrInvalidURL и Err.
+func (e *URLError) Unwrap() []error {
+	if e.Err != nil {
+		return []error{ErrInvalidURL, e.Err}
+	}
+
+	return []error{ErrInvalidURL}
+}
+
+// Машиночитаемые причины, по которым URL отклонён политикой доменов.
+const (
+	URLReasonBlockedDomain    = "blocked_domain"     // Домен в списке запрещённых
+	URLReasonDomainNotAllowed = "domain_not_allowed" // Домена нет в списке разрешённых
 )
+
+// PolicyError — отказ политики доменов с машиночитаемой причиной Reason.
+// errors.Is сопоставляет её с ErrForbiddenURL.
+type PolicyError struct {
+	Reason string
+	Host   string
+	Rule   string // Правило списка запрещённых, под которое попал хост
+}
+
+// Error описывает отказ с хостом и сработавшим правилом.
+func (e *PolicyError) Error() string {
+	if e.Rule != "" {
+		return fmt.Sprintf("domain %q is blocked by rule %q", e.Host, e.Rule)
+	}
+
+	return fmt.Sprintf("domain %q is not allowed", e.Host)
+}
+
+// Unwrap возвращает ErrForbiddenURL.
+func (e *PolicyError) Unwrap() error {
+	return ErrForbiddenURL
+}
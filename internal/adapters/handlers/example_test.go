@@ -6,6 +6,7 @@ import (
 	"github.com/bubaew95/yandex-go-learn/config"
 	fileStorage "github.com/bubaew95/yandex-go-learn/internal/adapters/repository/filestorage"
 	"github.com/bubaew95/yandex-go-learn/internal/adapters/storage"
+	"github.com/bubaew95/yandex-go-learn/internal/core/idgen"
 	"github.com/bubaew95/yandex-go-learn/internal/core/service"
 	"github.com/go-chi/chi/v5"
 	"net/http"
@@ -26,7 +27,7 @@ func ExampleShortenerHandler_AddNewURL() {
 		return
 	}
 
-	mockService := service.NewShortenerService(shortenerRepository, cfg)
+	mockService := service.NewShortenerService(shortenerRepository, idgen.NewRandom(idgen.Base62, 8, ""), cfg)
 	handler := NewShortenerHandler(mockService)
 
 	route := chi.NewRouter()
@@ -32,9 +32,9 @@ func (_m *MockShortenerService) DeleteUserURLS(ctx context.Context, items []mode
 	return r0
 }
 
-// GenerateURL provides a mock function with given fields: ctx, url, randomStringLength
-func (_m *MockShortenerService) GenerateURL(ctx context.Context, url string, randomStringLength int) (string, error) {
-	ret := _m.Called(ctx, url, randomStringLength)
+// GenerateURL provides a mock function with given fields: ctx, url, opts
+func (_m *MockShortenerService) GenerateURL(ctx context.Context, url string, opts model.LinkOptions) (string, error) {
+	ret := _m.Called(ctx, url, opts)
 
 	if len(ret) == 0 {
 		panic("no return value specified for GenerateURL")
@@ -42,17 +42,17 @@ func (_m *MockShortenerService) GenerateURL(ctx context.Context, url string, ran
 
 	var r0 string
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, int) (string, error)); ok {
-		return rf(ctx, url, randomStringLength)
+	if rf, ok := ret.Get(0).(func(context.Context, string, model.LinkOptions) (string, error)); ok {
+		return rf(ctx, url, opts)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string, int) string); ok {
-		r0 = rf(ctx, url, randomStringLength)
+	if rf, ok := ret.Get(0).(func(context.Context, string, model.LinkOptions) string); ok {
+		r0 = rf(ctx, url, opts)
 	} else {
 		r0 = ret.Get(0).(string)
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, string, int) error); ok {
-		r1 = rf(ctx, url, randomStringLength)
+	if rf, ok := ret.Get(1).(func(context.Context, string, model.LinkOptions) error); ok {
+		r1 = rf(ctx, url, opts)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -60,9 +60,39 @@ func (_m *MockShortenerService) GenerateURL(ctx context.Context, url string, ran
 	return r0, r1
 }
 
-// GetURLByID provides a mock function with given fields: ctx, id
-func (_m *MockShortenerService) GetURLByID(ctx context.Context, id string) (string, error) {
-	ret := _m.Called(ctx, id)
+// GetDeletedURLs provides a mock function with given fields: ctx, userID
+func (_m *MockShortenerService) GetDeletedURLs(ctx context.Context, userID string) ([]model.DeletedURLResponse, error) {
+	ret := _m.Called(ctx, userID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetDeletedURLs")
+	}
+
+	var r0 []model.DeletedURLResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]model.DeletedURLResponse, error)); ok {
+		return rf(ctx, userID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) []model.DeletedURLResponse); ok {
+		r0 = rf(ctx, userID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.DeletedURLResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetURLByID provides a mock function with given fields: ctx, id, password
+func (_m *MockShortenerService) GetURLByID(ctx context.Context, id string, password string) (string, error) {
+	ret := _m.Called(ctx, id, password)
 
 	if len(ret) == 0 {
 		panic("no return value specified for GetURLByID")
@@ -70,17 +100,17 @@ func (_m *MockShortenerService) GetURLByID(ctx context.Context, id string) (stri
 
 	var r0 string
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) (string, error)); ok {
-		return rf(ctx, id)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (string, error)); ok {
+		return rf(ctx, id, password)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string) string); ok {
-		r0 = rf(ctx, id)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) string); ok {
+		r0 = rf(ctx, id, password)
 	} else {
 		r0 = ret.Get(0).(string)
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, id)
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, id, password)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -116,6 +146,36 @@ func (_m *MockShortenerService) GetURLByOriginalURL(ctx context.Context, origina
 	return r0, r1
 }
 
+// GetURLHistory provides a mock function with given fields: ctx, id, userID
+func (_m *MockShortenerService) GetURLHistory(ctx context.Context, id string, userID string) ([]model.URLEdit, error) {
+	ret := _m.Called(ctx, id, userID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetURLHistory")
+	}
+
+	var r0 []model.URLEdit
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) ([]model.URLEdit, error)); ok {
+		return rf(ctx, id, userID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) []model.URLEdit); ok {
+		r0 = rf(ctx, id, userID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.URLEdit)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, id, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetURLSByUserID provides a mock function with given fields: ctx, userID
 func (_m *MockShortenerService) GetURLSByUserID(ctx context.Context, userID string) ([]model.ShortenerURLSForUserResponse, error) {
 	ret := _m.Called(ctx, userID)
@@ -194,29 +254,113 @@ func (_m *MockShortenerService) Ping(ctx context.Context) error {
 	return r0
 }
 
-// RandStringBytes provides a mock function with given fields: n
-func (_m *MockShortenerService) RandStringBytes(n int) string {
-	ret := _m.Called(n)
+// RestoreDeletedURL provides a mock function with given fields: ctx, id, userID
+func (_m *MockShortenerService) RestoreDeletedURL(ctx context.Context, id string, userID string) error {
+	ret := _m.Called(ctx, id, userID)
 
 	if len(ret) == 0 {
-		panic("no return value specified for RandStringBytes")
+		panic("no return value specified for RestoreDeletedURL")
 	}
 
-	var r0 string
-	if rf, ok := ret.Get(0).(func(int) string); ok {
-		r0 = rf(n)
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, id, userID)
 	} else {
-		r0 = ret.Get(0).(string)
+		r0 = ret.Error(0)
 	}
 
 	return r0
 }
 
+// RestoreURL provides a mock function with given fields: ctx, id, userID, version
+func (_m *MockShortenerService) RestoreURL(ctx context.Context, id string, userID string, version int) (model.ShortenerURLSForUserResponse, error) {
+	ret := _m.Called(ctx, id, userID, version)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RestoreURL")
+	}
+
+	var r0 model.ShortenerURLSForUserResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int) (model.ShortenerURLSForUserResponse, error)); ok {
+		return rf(ctx, id, userID, version)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int) model.ShortenerURLSForUserResponse); ok {
+		r0 = rf(ctx, id, userID, version)
+	} else {
+		r0 = ret.Get(0).(model.ShortenerURLSForUserResponse)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int) error); ok {
+		r1 = rf(ctx, id, userID, version)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // ScheduleURLDeletion provides a mock function with given fields: ctx, items
 func (_m *MockShortenerService) ScheduleURLDeletion(ctx context.Context, items []model.URLToDelete) {
 	_m.Called(ctx, items)
 }
 
+// SetAlias provides a mock function with given fields: ctx, url, alias, opts
+func (_m *MockShortenerService) SetAlias(ctx context.Context, url string, alias string, opts model.LinkOptions) (string, error) {
+	ret := _m.Called(ctx, url, alias, opts)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetAlias")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, model.LinkOptions) (string, error)); ok {
+		return rf(ctx, url, alias, opts)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, model.LinkOptions) string); ok {
+		r0 = rf(ctx, url, alias, opts)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, model.LinkOptions) error); ok {
+		r1 = rf(ctx, url, alias, opts)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateURL provides a mock function with given fields: ctx, id, userID, url
+func (_m *MockShortenerService) UpdateURL(ctx context.Context, id string, userID string, url string) (model.ShortenerURLSForUserResponse, error) {
+	ret := _m.Called(ctx, id, userID, url)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpdateURL")
+	}
+
+	var r0 model.ShortenerURLSForUserResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) (model.ShortenerURLSForUserResponse, error)); ok {
+		return rf(ctx, id, userID, url)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) model.ShortenerURLSForUserResponse); ok {
+		r0 = rf(ctx, id, userID, url)
+	} else {
+		r0 = ret.Get(0).(model.ShortenerURLSForUserResponse)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string) error); ok {
+		r1 = rf(ctx, id, userID, url)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // NewMockShortenerService creates a new instance of MockShortenerService. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewMockShortenerService(t interface {
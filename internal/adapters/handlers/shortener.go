@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"html/template"
 	"io"
 	"net/http"
 	"strconv"
@@ -17,37 +18,51 @@ import (
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
-const randomStringLength = 8
-
 // ShortenerService определяет бизнес-логику сервиса сокращения ссылок.
 // Включает в себя генерацию ссылок, работу с пользователями и отложенное удаление.
 //
 //go:generate go run github.com/vektra/mockery/v2@v2.52.2 --name=ShortenerService --filename=servicemock_test.go --inpackage
 type ShortenerService interface {
 	// GenerateURL генерирует короткий URL на основе оригинального.
-	GenerateURL(ctx context.Context, url string, randomStringLength int) (string, error)
+	GenerateURL(ctx context.Context, url string, opts model.LinkOptions) (string, error)
+
+	// SetAlias сохраняет ссылку под выбранным пользователем коротким ID.
+	SetAlias(ctx context.Context, url string, alias string, opts model.LinkOptions) (string, error)
 
 	// GetURLByID возвращает оригинальный URL по его сокращённому ID.
-	GetURLByID(ctx context.Context, id string) (string, error)
+	// Для защищённой ссылки password проверяется перед переходом.
+	GetURLByID(ctx context.Context, id string, password string) (string, error)
 
 	// GetURLByOriginalURL возвращает ID, соответствующий оригинальному URL.
 	GetURLByOriginalURL(ctx context.Context, originalURL string) (string, bool)
 
-	// InsertURLs добавляет множество URL и возвращает их короткие представления.
+	// InsertURLs добавляет множество URL и возвращает результат для каждого из них.
 	InsertURLs(ctx context.Context, urls []model.ShortenerURLMapping) ([]model.ShortenerURLResponse, error)
 
 	// GetURLSByUserID возвращает список сокращённых URL, принадлежащих пользователю.
 	GetURLSByUserID(ctx context.Context, userID string) ([]model.ShortenerURLSForUserResponse, error)
 
+	// UpdateURL меняет оригинальный URL ссылки по запросу её владельца.
+	UpdateURL(ctx context.Context, id string, userID string, url string) (model.ShortenerURLSForUserResponse, error)
+
+	// GetURLHistory возвращает прежние оригинальные URL ссылки её владельцу.
+	GetURLHistory(ctx context.Context, id string, userID string) ([]model.URLEdit, error)
+
+	// RestoreURL возвращает ссылке оригинальный URL из её истории.
+	RestoreURL(ctx context.Context, id string, userID string, version int) (model.ShortenerURLSForUserResponse, error)
+
 	// DeleteUserURLS помечает ссылки как удалённые.
 	DeleteUserURLS(ctx context.Context, items []model.URLToDelete) error
 
+	// GetDeletedURLs возвращает удалённые ссылки пользователя, которые ещё можно восстановить.
+	GetDeletedURLs(ctx context.Context, userID string) ([]model.DeletedURLResponse, error)
+
+	// RestoreDeletedURL восстанавливает удалённую пользователем ссылку.
+	RestoreDeletedURL(ctx context.Context, id string, userID string) error
+
 	// ScheduleURLDeletion планирует асинхронное удаление ссылок (например, через очередь).
 	ScheduleURLDeletion(ctx context.Context, items []model.URLToDelete)
 
-	// RandStringBytes генерирует случайную строку заданной длины (обычно для ID короткой ссылки).
-	RandStringBytes(n int) string
-
 	// Ping проверяет доступность сервиса (например, для liveness-проб).
 	Ping(ctx context.Context) error
 }
@@ -86,6 +101,9 @@ func writeByteResponse(res http.ResponseWriter, statusCode int, data []byte) {
 // Ожидает оригинальный URL в теле запроса (как текст).
 // Возвращает укороченную ссылку в случае успеха.
 // Если такая ссылка уже есть — возвращает HTTP 409 и ранее созданную короткую ссылку.
+// Если URL не прошёл проверку — возвращает HTTP 400 (HTTP 413 для слишком длинного URL),
+// если домен запрещён политикой — HTTP 403; в обоих случаях JSON с причиной, см. writeRejectedURL.
+// Срок жизни ссылки — срок по умолчанию из конфигурации.
 func (s ShortenerHandler) CreateURL(res http.ResponseWriter, req *http.Request) {
 	responseData, err := io.ReadAll(req.Body)
 	if err != nil {
@@ -94,14 +112,12 @@ func (s ShortenerHandler) CreateURL(res http.ResponseWriter, req *http.Request)
 	}
 
 	body := string(responseData)
-	if body == "" {
-		logger.Log.Debug("Body is empty")
-		res.WriteHeader(http.StatusBadRequest)
-		return
-	}
-
-	url, err := s.service.GenerateURL(req.Context(), body, randomStringLength)
+	url, err := s.service.GenerateURL(req.Context(), body, model.LinkOptions{})
 	if err != nil {
+		if writeRejectedURL(res, err) {
+			return
+		}
+
 		if errors.Is(err, constants.ErrUniqueIndex) {
 			originURL, ok := s.service.GetURLByOriginalURL(req.Context(), body)
 
@@ -121,16 +137,54 @@ func (s ShortenerHandler) CreateURL(res http.ResponseWriter, req *http.Request)
 	writeByteResponse(res, http.StatusCreated, []byte(url))
 }
 
+// passwordHeader — заголовок, в котором API-клиенты передают пароль защищённой ссылки.
+const passwordHeader = "X-Link-Password"
+
+// passwordForm — страница ввода пароля защищённой ссылки.
+// Форма отправляется POST-запросом на тот же адрес.
+var passwordForm = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Ссылка защищена паролем</title></head>
+<body>
+<form method="post">
+{{if .}}<p>{{.}}</p>
+{{end}}<label>Пароль: <input type="password" name="password" autofocus></label>
+<button type="submit">Перейти</button>
+</form>
+</body>
+</html>
+`))
+
 // GetURL обрабатывает GET-запрос для получения оригинального URL по его короткому идентификатору.
 //
 // Ожидает параметр id, по которому извлекается оригинальная ссылка.
 // Если ссылка найдена возврашает HTTP 307 статус и перенаправляет на оригинальную ссылку.
-// Если ссылка удалена возврашает HTTP 410 статус.
+// Если ссылка удалена, истёк срок её жизни или исчерпан лимит переходов возврашает HTTP 410 статус.
 // Если ссылка не найдена - возврашает HTTP 404 статус.
+// Если ссылка ведёт на домен, запрещённый политикой, и переход по таким ссылкам отключён -
+// возврашает HTTP 403 статус.
+//
+// Пароль защищённой ссылки API-клиенты передают в заголовке X-Link-Password.
+// Без пароля или с неверным паролем возврашается HTTP 401 статус и форма ввода пароля,
+// после превышения числа попыток - HTTP 429 статус.
 func (s ShortenerHandler) GetURL(res http.ResponseWriter, req *http.Request) {
+	s.followURL(res, req, req.Header.Get(passwordHeader), http.StatusTemporaryRedirect)
+}
+
+// UnlockURL обрабатывает отправку формы ввода пароля защищённой ссылки.
+//
+// Ожидает пароль в поле password формы.
+// Если пароль верный - возврашает HTTP 303 статус и перенаправляет на оригинальную ссылку.
+// Остальные ответы совпадают с GetURL.
+func (s ShortenerHandler) UnlockURL(res http.ResponseWriter, req *http.Request) {
+	s.followURL(res, req, req.PostFormValue("password"), http.StatusSeeOther)
+}
+
+// followURL выполняет переход по короткой ссылке из запроса, отвечая перенаправлением со статусом status.
+func (s ShortenerHandler) followURL(res http.ResponseWriter, req *http.Request, password string, status int) {
 	id := chi.URLParam(req, "id")
 
-	url, err := s.service.GetURLByID(req.Context(), id)
+	url, err := s.service.GetURLByID(req.Context(), id, password)
 	if err != nil || url == "" {
 		if errors.Is(err, constants.ErrIsDeleted) {
 			logger.Log.Debug("Url is deleted", zap.String("id", id))
@@ -138,13 +192,86 @@ func (s ShortenerHandler) GetURL(res http.ResponseWriter, req *http.Request) {
 			return
 		}
 
+		if errors.Is(err, constants.ErrExpired) {
+			logger.Log.Debug("Url is expired", zap.String("id", id))
+			res.WriteHeader(http.StatusGone)
+			return
+		}
+
+		if errors.Is(err, constants.ErrNoClicksLeft) {
+			logger.Log.Debug("Url has no clicks left", zap.String("id", id))
+			res.WriteHeader(http.StatusGone)
+			return
+		}
+
+		if errors.Is(err, constants.ErrPasswordRequired) {
+			logger.Log.Debug("Url is password protected", zap.String("id", id))
+			writePasswordForm(res, "")
+			return
+		}
+
+		if errors.Is(err, constants.ErrWrongPassword) {
+			logger.Log.Debug("Wrong url password", zap.String("id", id))
+			writePasswordForm(res, "Неверный пароль")
+			return
+		}
+
+		if errors.Is(err, constants.ErrTooManyAttempts) {
+			logger.Log.Debug("Too many password attempts", zap.String("id", id))
+			writeByteResponse(res, http.StatusTooManyRequests, []byte(err.Error()))
+			return
+		}
+
+		if errors.Is(err, constants.ErrForbiddenURL) {
+			logger.Log.Debug("Url is disabled by domain policy", zap.String("id", id), zap.Error(err))
+			writeByteResponse(res, http.StatusForbidden, []byte(err.Error()))
+			return
+		}
+
 		logger.Log.Debug("Url not found by id", zap.String("id", id))
 		res.WriteHeader(http.StatusNotFound)
 		return
 	}
 
 	res.Header().Set("Location", url)
-	res.WriteHeader(http.StatusTemporaryRedirect)
+	res.WriteHeader(status)
+}
+
+// writeRejectedURL отвечает на отказ в сокращении URL JSON с текстом ошибки и машиночитаемой
+// причиной (поле reason): для домена, запрещённого политикой, - HTTP 403, для слишком
+// длинного URL - HTTP 413, для остальных ошибок проверки - HTTP 400.
+// Возвращает false, если err не является отказом в сокращении URL.
+func writeRejectedURL(res http.ResponseWriter, err error) bool {
+	var (
+		urlErr    *constants.URLError
+		policyErr *constants.PolicyError
+		status    int
+		reason    string
+	)
+	switch {
+	case errors.As(err, &policyErr):
+		status, reason = http.StatusForbidden, policyErr.Reason
+	case errors.As(err, &urlErr) && errors.Is(err, constants.ErrURLTooLong):
+		status, reason = http.StatusRequestEntityTooLarge, urlErr.Reason
+	case errors.As(err, &urlErr):
+		status, reason = http.StatusBadRequest, urlErr.Reason
+	default:
+		return false
+	}
+
+	logger.Log.Debug("Url rejected", zap.String("reason", reason), zap.Error(err))
+	writeJSONResponse(res, status, model.ErrorResponse{Error: err.Error(), Reason: reason})
+	return true
+}
+
+// writePasswordForm отвечает HTTP 401 статусом и формой ввода пароля с сообщением message.
+func writePasswordForm(res http.ResponseWriter, message string) {
+	res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	res.WriteHeader(http.StatusUnauthorized)
+
+	if err := passwordForm.Execute(res, message); err != nil {
+		logger.Log.Debug("Cannot render password form", zap.Error(err))
+	}
 }
 
 // AddNewURL обрабатывает HTTP POST-запрос на создание короткой ссылки.
@@ -154,6 +281,18 @@ func (s ShortenerHandler) GetURL(res http.ResponseWriter, req *http.Request) {
 // Если JSON тело запроса имеет ошибку - вовзврашается HTTP 500 ошибка.
 // Если при генерации короткой ссылки возникла ошибка - возврается HTTP 500 ошибка.
 // Если такая ссылка уже добавлена в базу - возврашается оригинальная ссылка из базы.
+// Если URL не прошёл проверку - возврашается HTTP 400 ошибка (HTTP 413 для слишком длинного URL),
+// если домен запрещён политикой - HTTP 403; причина передаётся в поле reason, см. writeRejectedURL.
+//
+// Если в запросе задан alias, ссылка сохраняется под этим коротким ID.
+// Если alias не прошёл проверку или зарезервирован - возврашается HTTP 400 ошибка.
+// Если alias уже занят - возврашается HTTP 409 статус и занятый alias.
+//
+// Срок жизни ссылки задаётся полем expires_in (в секундах) или expires_at (RFC 3339).
+// Если срок задан неверно или больше максимального - возврашается HTTP 400 ошибка.
+// Поле max_clicks ограничивает число переходов по ссылке (1 - одноразовая ссылка);
+// отрицательное значение - HTTP 400 ошибка.
+// Поле password защищает ссылку паролем, который потребуется при переходе.
 func (s ShortenerHandler) AddNewURL(res http.ResponseWriter, req *http.Request) {
 	var requestBody model.ShortenerRequest
 
@@ -163,8 +302,44 @@ func (s ShortenerHandler) AddNewURL(res http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	url, err := s.service.GenerateURL(req.Context(), requestBody.URL, randomStringLength)
+	var (
+		url string
+		err error
+	)
+	if requestBody.Alias != "" {
+		url, err = s.service.SetAlias(req.Context(), requestBody.URL, requestBody.Alias, requestBody.LinkOptions)
+	} else {
+		url, err = s.service.GenerateURL(req.Context(), requestBody.URL, requestBody.LinkOptions)
+	}
+
 	if err != nil {
+		if errors.Is(err, constants.ErrInvalidAlias) || errors.Is(err, constants.ErrReservedAlias) {
+			logger.Log.Debug("Invalid alias", zap.String("alias", requestBody.Alias), zap.Error(err))
+			writeJSONResponse(res, http.StatusBadRequest, model.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		if errors.Is(err, constants.ErrInvalidExpiry) ||
+			errors.Is(err, constants.ErrInvalidClicks) ||
+			errors.Is(err, constants.ErrInvalidPassword) {
+			logger.Log.Debug("Invalid link options", zap.Error(err))
+			writeJSONResponse(res, http.StatusBadRequest, model.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		if errors.Is(err, constants.ErrIDConflict) {
+			logger.Log.Debug("Alias is taken", zap.String("alias", requestBody.Alias))
+			writeJSONResponse(res, http.StatusConflict, model.AliasConflictResponse{
+				Error: err.Error(),
+				Alias: requestBody.Alias,
+			})
+			return
+		}
+
+		if writeRejectedURL(res, err) {
+			return
+		}
+
 		if errors.Is(err, constants.ErrUniqueIndex) {
 			originURL, ok := s.service.GetURLByOriginalURL(req.Context(), requestBody.URL)
 			if ok {
@@ -192,9 +367,17 @@ func (s ShortenerHandler) AddNewURL(res http.ResponseWriter, req *http.Request)
 // Ping - обрабатывает HTTP GET-запрос на проверку подключения к БД.
 //
 // Если подключение успешное - возврашает HTTP 200 статус.
+// Если часть реплик недоступна - возврашает HTTP 200 статус и список недоступных реплик.
 // Если при подключении возникла ошибка - возврашает HTTP 500 статус.
 func (s ShortenerHandler) Ping(w http.ResponseWriter, r *http.Request) {
-	if err := s.service.Ping(r.Context()); err != nil {
+	err := s.service.Ping(r.Context())
+	if errors.Is(err, constants.ErrDegraded) {
+		logger.Log.Warn("Storage is degraded", zap.Error(err))
+		writeByteResponse(w, http.StatusOK, []byte(err.Error()))
+		return
+	}
+
+	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -204,8 +387,15 @@ func (s ShortenerHandler) Ping(w http.ResponseWriter, r *http.Request) {
 
 // Batch - обрабатывает HTTP POST-запрос на создание которих ссылок.
 //
-// Ожидает JSON массив с которотким ID и с оригинальной ссылкой.
-// Если добавление ссылок прошла успешно - возврашает HTTP 201 статус и все добавленыее ссылки.
+// Ожидает JSON массив с correlation_id и с оригинальной ссылкой. Короткие ID генерирует сервис,
+// correlation_id возвращается в ответе без изменений.
+// Возврашает HTTP 201 статус и результат для каждого элемента в порядке запроса: status "created"
+// для новой ссылки, "exists" для уже сокращённого URL (с существующей ссылкой) и "invalid"
+// с причиной в поле error для URL, не прошедшего проверку, и неверных параметров ссылки;
+// "forbidden" для URL на домен, запрещённый политикой. Для URL в поле reason также
+// передаётся машиночитаемая причина, как в AddNewURL.
+// Срок жизни и лимит переходов каждой ссылки задаются полями expires_in, expires_at
+// и max_clicks, как в AddNewURL.
 // Если в JSON есть ошибка - возврашает HTTP 500 ошибку.
 // Если при добавлении возникла ошибка - возврашает HTTP 500 статус.
 func (s ShortenerHandler) Batch(w http.ResponseWriter, r *http.Request) {
@@ -230,7 +420,8 @@ func (s ShortenerHandler) Batch(w http.ResponseWriter, r *http.Request) {
 
 // GetUserURLS - обрабатывает HTTP GET-запрос на получение ссылок авторизованного пользователя.
 //
-// Если есть ссылки - возврашает HTTP 200 статус и все ссылки.
+// Если есть ссылки - возврашает HTTP 200 статус и все ссылки; для ссылок с лимитом
+// переходов в поле clicks_left указано оставшееся число переходов.
 // Если ссылок нет - возврашает HTTP 204 статус.
 // Если в запросе возникла ошибка возврашает HTTP 500 ошибку.
 func (s ShortenerHandler) GetUserURLS(w http.ResponseWriter, r *http.Request) {
@@ -286,3 +477,187 @@ func (s ShortenerHandler) DeleteUserURLS(w http.ResponseWriter, r *http.Request)
 	logger.Log.Debug("Urls deleted")
 	w.WriteHeader(http.StatusAccepted)
 }
+
+// GetDeletedURLs обрабатывает HTTP GET-запрос на получение корзины пользователя.
+//
+// Возврашает HTTP 200 статус и JSON список удалённых ссылок, которые ещё можно восстановить,
+// с временем удаления (deleted_at) и временем, до которого возможно восстановление (restore_until).
+// Ссылки удаляются асинхронно, поэтому только что удалённая ссылка может появиться в корзине не сразу.
+// Если куки нет или корзина пуста - возврашает HTTP 204 статус.
+// Если в запросе возникла ошибка возврашает HTTP 500 ошибку.
+func (s ShortenerHandler) GetDeletedURLs(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie("user_id")
+	if err != nil || cookie.Value == "" {
+		logger.Log.Debug("Cookie not found")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	items, err := s.service.GetDeletedURLs(r.Context(), cookie.Value)
+	if err != nil {
+		logger.Log.Debug("Get deleted urls error", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if len(items) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, items)
+}
+
+// RestoreDeletedURL обрабатывает HTTP POST-запрос на восстановление удалённой ссылки из корзины.
+//
+// Ожидает параметр id. Если ссылка восстановлена или не была удалена - возврашает HTTP 204 статус.
+// Если время восстановления истекло или истёк срок жизни ссылки - возврашает HTTP 410 статус.
+// Ошибки доступа к ссылке описаны в writeUserURLError.
+func (s ShortenerHandler) RestoreDeletedURL(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromCookie(w, r)
+	if !ok {
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if err := s.service.RestoreDeletedURL(r.Context(), id, userID); err != nil {
+		writeUserURLError(w, id, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UpdateUserURL обрабатывает HTTP PATCH-запрос владельца на замену оригинального URL ссылки.
+//
+// Ожидает параметр id и JSON {"url": "..."} в теле запроса; владелец определяется по куке user_id.
+// Возврашает HTTP 200 статус и JSON с короткой и новой оригинальной ссылкой.
+// Прежний URL сохраняется в истории ссылки (см. GetURLHistory).
+// Если JSON тело запроса имеет ошибку - возврашается HTTP 400 ошибка.
+// Если URL не прошёл проверку - возврашается HTTP 400 ошибка (HTTP 413 для слишком длинного URL)
+// с причиной в поле reason.
+// Если URL уже сокращён другой ссылкой - возврашается HTTP 409 статус.
+// Ошибки доступа к ссылке описаны в writeUserURLError.
+func (s ShortenerHandler) UpdateUserURL(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromCookie(w, r)
+	if !ok {
+		return
+	}
+
+	var request model.UpdateURLRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		logger.Log.Debug("Cannot decode request JSON", zap.Error(err))
+		writeJSONResponse(w, http.StatusBadRequest, model.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	item, err := s.service.UpdateURL(r.Context(), id, userID, request.URL)
+	if err != nil {
+		writeUserURLError(w, id, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, item)
+}
+
+// GetURLHistory обрабатывает HTTP GET-запрос владельца на получение истории изменений ссылки.
+//
+// Возврашает HTTP 200 статус и JSON список прежних оригинальных URL от последнего изменения к первому.
+// Если ссылку не изменяли - возврашает HTTP 204 статус.
+// Ошибки доступа к ссылке описаны в writeUserURLError.
+func (s ShortenerHandler) GetURLHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromCookie(w, r)
+	if !ok {
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	history, err := s.service.GetURLHistory(r.Context(), id, userID)
+	if err != nil {
+		writeUserURLError(w, id, err)
+		return
+	}
+
+	if len(history) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, history)
+}
+
+// RestoreURL обрабатывает HTTP POST-запрос владельца на возврат ссылке URL из её истории.
+//
+// Ожидает параметры id и version - номер записи истории.
+// Возврашает HTTP 200 статус и JSON с короткой и восстановленной оригинальной ссылкой;
+// заменённый URL сам попадает в историю.
+// Если version не число - возврашается HTTP 400 ошибка, если такой записи нет - HTTP 404.
+// Если URL из истории уже сокращён другой ссылкой - возврашается HTTP 409 статус.
+// Ошибки доступа к ссылке описаны в writeUserURLError.
+func (s ShortenerHandler) RestoreURL(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromCookie(w, r)
+	if !ok {
+		return
+	}
+
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		writeJSONResponse(w, http.StatusBadRequest, model.ErrorResponse{Error: "invalid version"})
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	item, err := s.service.RestoreURL(r.Context(), id, userID, version)
+	if err != nil {
+		writeUserURLError(w, id, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, item)
+}
+
+// userIDFromCookie возвращает владельца из куки user_id.
+// Если куки нет, отвечает HTTP 401 статусом.
+func userIDFromCookie(w http.ResponseWriter, r *http.Request) (string, bool) {
+	cookie, err := r.Cookie("user_id")
+	if err != nil || cookie.Value == "" {
+		logger.Log.Debug("Cookie not found")
+		w.WriteHeader(http.StatusUnauthorized)
+		return "", false
+	}
+
+	return cookie.Value, true
+}
+
+// writeUserURLError отвечает на ошибку изменения ссылки её владельцем:
+// ссылка не найдена - HTTP 404, принадлежит другому пользователю - HTTP 403,
+// удалена или больше не может быть восстановлена - HTTP 410, URL уже сокращён - HTTP 409,
+// URL отклонён - как в writeRejectedURL, прочие ошибки - HTTP 500.
+func writeUserURLError(w http.ResponseWriter, id string, err error) {
+	if writeRejectedURL(w, err) {
+		return
+	}
+
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, constants.ErrNotFound), errors.Is(err, constants.ErrVersionNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, constants.ErrNotOwner):
+		status = http.StatusForbidden
+	case errors.Is(err, constants.ErrIsDeleted),
+		errors.Is(err, constants.ErrRestoreWindowPassed),
+		errors.Is(err, constants.ErrExpired):
+		status = http.StatusGone
+	case errors.Is(err, constants.ErrUniqueIndex):
+		status = http.StatusConflict
+	}
+
+	logger.Log.Debug("Cannot change user url", zap.String("id", id), zap.Error(err))
+	if status == http.StatusInternalServerError {
+		w.WriteHeader(status)
+		return
+	}
+
+	writeJSONResponse(w, status, model.ErrorResponse{Error: err.Error()})
+}
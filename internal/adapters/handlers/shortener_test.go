@@ -1,14 +1,18 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/bubaew95/yandex-go-learn/internal/adapters/constants"
 
@@ -20,14 +24,19 @@ import (
 
 	"github.com/bubaew95/yandex-go-learn/config"
 	fileStorage "github.com/bubaew95/yandex-go-learn/internal/adapters/repository/filestorage"
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/repository/memory"
 	"github.com/bubaew95/yandex-go-learn/internal/adapters/storage"
+	"github.com/bubaew95/yandex-go-learn/internal/core/idgen"
 	"github.com/bubaew95/yandex-go-learn/internal/core/model"
+	"github.com/bubaew95/yandex-go-learn/internal/core/policy"
 	"github.com/bubaew95/yandex-go-learn/internal/core/service"
 )
 
 func TestHandlerCreate(t *testing.T) {
 	t.Parallel()
 
+	cfg := config.NewConfig()
+
 	type want struct {
 		contentType string
 		statusCode  int
@@ -61,15 +70,23 @@ func TestHandlerCreate(t *testing.T) {
 
 			err: true,
 		},
-	}
+		{
+			name: "Url is too long",
+			data: "https://practicum.yandex.ru/?q=" + strings.Repeat("a", cfg.MaxURLLength),
+			want: want{
+				statusCode: http.StatusRequestEntityTooLarge,
+				method:     http.MethodPost,
+			},
 
-	cfg := config.NewConfig()
+			err: true,
+		},
+	}
 
 	shortenerDB, _ := storage.NewShortenerDB(*cfg)
 	shortenerRepository, err := fileStorage.NewShortenerRepository(*shortenerDB)
 	require.NoError(t, err)
 
-	shortenerService := service.NewShortenerService(shortenerRepository, *cfg)
+	shortenerService := service.NewShortenerService(shortenerRepository, idgen.NewRandom(idgen.Base62, 8, ""), *cfg)
 	shortenerHandler := NewShortenerHandler(shortenerService)
 
 	route := chi.NewRouter()
@@ -100,6 +117,330 @@ func TestHandlerCreate(t *testing.T) {
 	}
 }
 
+func TestHandlerCreate_DuplicateFileStorage(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Config{
+		BaseURL:  "http://test.local",
+		FilePath: filepath.Join(t.TempDir(), "data.json"),
+	}
+
+	shortenerDB, err := storage.NewShortenerDB(cfg)
+	require.NoError(t, err)
+
+	shortenerRepository, err := fileStorage.NewShortenerRepository(*shortenerDB)
+	require.NoError(t, err)
+	defer shortenerRepository.Close()
+
+	shortenerService := service.NewShortenerService(shortenerRepository, idgen.NewRandom(idgen.Base62, 8, ""), cfg)
+	shortenerHandler := NewShortenerHandler(shortenerService)
+
+	route := chi.NewRouter()
+	route.Post("/", shortenerHandler.CreateURL)
+	route.Post("/api/shorten", shortenerHandler.AddNewURL)
+
+	ts := httptest.NewServer(route)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL, "text/plain", strings.NewReader("https://practicum.yandex.ru/"))
+	require.NoError(t, err)
+	created, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, err = http.Post(ts.URL, "text/plain", strings.NewReader("https://practicum.yandex.ru/"))
+	require.NoError(t, err)
+	duplicate, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, string(created), string(duplicate))
+
+	resp, err = http.Post(ts.URL+"/api/shorten", "application/json", strings.NewReader(`{"url": "https://practicum.yandex.ru/"}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var response model.ShortenerResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, string(created), response.Result)
+}
+
+func TestHandlerAddNewURL_AliasFileStorage(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Config{
+		BaseURL:  "http://test.local",
+		FilePath: filepath.Join(t.TempDir(), "data.json"),
+	}
+
+	shortenerDB, err := storage.NewShortenerDB(cfg)
+	require.NoError(t, err)
+
+	shortenerRepository, err := fileStorage.NewShortenerRepository(*shortenerDB)
+	require.NoError(t, err)
+	defer shortenerRepository.Close()
+
+	shortenerService := service.NewShortenerService(shortenerRepository, idgen.NewRandom(idgen.Base62, 8, ""), cfg)
+	shortenerHandler := NewShortenerHandler(shortenerService)
+
+	route := chi.NewRouter()
+	route.Get("/{id}", shortenerHandler.GetURL)
+	route.Post("/api/shorten", shortenerHandler.AddNewURL)
+
+	ts := httptest.NewServer(route)
+	defer ts.Close()
+
+	client := ts.Client()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	post := func(body string) (*http.Response, []byte) {
+		resp, err := client.Post(ts.URL+"/api/shorten", "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		return resp, data
+	}
+
+	resp, body := post(`{"url": "https://practicum.yandex.ru/", "alias": "promo-2026"}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var created model.ShortenerResponse
+	require.NoError(t, json.Unmarshal(body, &created))
+	assert.Equal(t, "http://test.local/promo-2026", created.Result)
+
+	resp, body = post(`{"url": "https://yandex.ru/", "alias": "promo-2026"}`)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	var conflict model.AliasConflictResponse
+	require.NoError(t, json.Unmarshal(body, &conflict))
+	assert.Equal(t, "promo-2026", conflict.Alias)
+	assert.Equal(t, constants.ErrIDConflict.Error(), conflict.Error)
+
+	resp, _ = post(`{"url": "https://yandex.ru/", "alias": "debug"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, _ = post(`{"url": "https://yandex.ru/", "alias": "promo 2026"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = client.Get(ts.URL + "/promo-2026")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, "https://practicum.yandex.ru/", resp.Header.Get("Location"))
+}
+
+func TestHandlerAddNewURL_ExpiryFileStorage(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Config{
+		BaseURL:    "http://test.local",
+		FilePath:   filepath.Join(t.TempDir(), "data.json"),
+		MaxLinkTTL: config.Duration{Duration: 24 * time.Hour},
+	}
+
+	shortenerDB, err := storage.NewShortenerDB(cfg)
+	require.NoError(t, err)
+
+	shortenerRepository, err := fileStorage.NewShortenerRepository(*shortenerDB)
+	require.NoError(t, err)
+	defer shortenerRepository.Close()
+
+	shortenerService := service.NewShortenerService(shortenerRepository, idgen.NewRandom(idgen.Base62, 8, ""), cfg)
+	shortenerHandler := NewShortenerHandler(shortenerService)
+
+	route := chi.NewRouter()
+	route.Get("/{id}", shortenerHandler.GetURL)
+	route.Post("/api/shorten", shortenerHandler.AddNewURL)
+
+	ts := httptest.NewServer(route)
+	defer ts.Close()
+
+	client := ts.Client()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	post := func(body string) *http.Response {
+		resp, err := client.Post(ts.URL+"/api/shorten", "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		return resp
+	}
+
+	get := func(id string) *http.Response {
+		resp, err := client.Get(ts.URL + "/" + id)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		return resp
+	}
+
+	assert.Equal(t, http.StatusBadRequest, post(`{"url": "https://yandex.ru/", "expires_in": 172800}`).StatusCode)
+	assert.Equal(t, http.StatusBadRequest, post(`{"url": "https://yandex.ru/", "expires_at": "2020-01-01T00:00:00Z"}`).StatusCode)
+	assert.Equal(t, http.StatusBadRequest, post(`{"url": "https://yandex.ru/", "expires_in": 60, "expires_at": "2999-01-01T00:00:00Z"}`).StatusCode)
+
+	assert.Equal(t, http.StatusCreated, post(`{"url": "https://practicum.yandex.ru/", "alias": "promo-2026", "expires_in": 3600}`).StatusCode)
+	assert.Equal(t, http.StatusTemporaryRedirect, get("promo-2026").StatusCode)
+
+	// Истёкшая ссылка ведёт себя как удалённая
+	past := time.Now().Add(-time.Minute)
+	require.NoError(t, shortenerRepository.SetURL(context.Background(), model.ShortenURL{
+		ShortURL:    "expired",
+		OriginalURL: "https://yandex.ru/old",
+		ExpiresAt:   &past,
+	}))
+
+	assert.Equal(t, http.StatusGone, get("expired").StatusCode)
+}
+
+func TestHandlerAddNewURL_OneTimeFileStorage(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Config{
+		BaseURL:  "http://test.local",
+		FilePath: filepath.Join(t.TempDir(), "data.json"),
+	}
+
+	shortenerDB, err := storage.NewShortenerDB(cfg)
+	require.NoError(t, err)
+
+	shortenerRepository, err := fileStorage.NewShortenerRepository(*shortenerDB)
+	require.NoError(t, err)
+	defer shortenerRepository.Close()
+
+	shortenerService := service.NewShortenerService(shortenerRepository, idgen.NewRandom(idgen.Base62, 8, ""), cfg)
+	shortenerHandler := NewShortenerHandler(shortenerService)
+
+	route := chi.NewRouter()
+	route.Get("/{id}", shortenerHandler.GetURL)
+	route.Post("/api/shorten", shortenerHandler.AddNewURL)
+
+	ts := httptest.NewServer(route)
+	defer ts.Close()
+
+	client := ts.Client()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	post := func(body string) *http.Response {
+		resp, err := client.Post(ts.URL+"/api/shorten", "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		return resp
+	}
+
+	get := func(id string) *http.Response {
+		resp, err := client.Get(ts.URL + "/" + id)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		return resp
+	}
+
+	assert.Equal(t, http.StatusBadRequest, post(`{"url": "https://yandex.ru/", "max_clicks": -1}`).StatusCode)
+	assert.Equal(t, http.StatusCreated, post(`{"url": "https://practicum.yandex.ru/", "alias": "secret", "max_clicks": 1}`).StatusCode)
+
+	assert.Equal(t, http.StatusTemporaryRedirect, get("secret").StatusCode)
+	assert.Equal(t, http.StatusGone, get("secret").StatusCode)
+}
+
+func TestHandlerGetURL_PasswordFileStorage(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Config{
+		BaseURL:             "http://test.local",
+		FilePath:            filepath.Join(t.TempDir(), "data.json"),
+		PasswordMaxAttempts: 2,
+		PasswordLockout:     config.Duration{Duration: time.Hour},
+	}
+
+	shortenerDB, err := storage.NewShortenerDB(cfg)
+	require.NoError(t, err)
+
+	shortenerRepository, err := fileStorage.NewShortenerRepository(*shortenerDB)
+	require.NoError(t, err)
+	defer shortenerRepository.Close()
+
+	shortenerService := service.NewShortenerService(shortenerRepository, idgen.NewRandom(idgen.Base62, 8, ""), cfg)
+	shortenerHandler := NewShortenerHandler(shortenerService)
+
+	route := chi.NewRouter()
+	route.Get("/{id}", shortenerHandler.GetURL)
+	route.Post("/{id}", shortenerHandler.UnlockURL)
+	route.Post("/api/shorten", shortenerHandler.AddNewURL)
+
+	ts := httptest.NewServer(route)
+	defer ts.Close()
+
+	client := ts.Client()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	get := func(id, password string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/"+id, nil)
+		require.NoError(t, err)
+		if password != "" {
+			req.Header.Set("X-Link-Password", password)
+		}
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		return resp
+	}
+
+	unlock := func(id, password string) *http.Response {
+		resp, err := client.PostForm(ts.URL+"/"+id, url.Values{"password": {password}})
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		return resp
+	}
+
+	resp, err := client.Post(ts.URL+"/api/shorten", "application/json",
+		strings.NewReader(`{"url": "https://practicum.yandex.ru/", "alias": "secret", "password": "qwerty"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// Без пароля отдаётся форма его ввода
+	resp, err = client.Get(ts.URL + "/secret")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/html")
+	assert.Contains(t, string(body), `name="password"`)
+
+	resp = get("secret", "qwerty")
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, "https://practicum.yandex.ru/", resp.Header.Get("Location"))
+
+	resp = unlock("secret", "qwerty")
+	assert.Equal(t, http.StatusSeeOther, resp.StatusCode)
+	assert.Equal(t, "https://practicum.yandex.ru/", resp.Header.Get("Location"))
+
+	assert.Equal(t, http.StatusUnauthorized, unlock("secret", "wrong").StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, get("secret", "wrong").StatusCode)
+	assert.Equal(t, http.StatusTooManyRequests, get("secret", "qwerty").StatusCode)
+}
+
 func TestHandlerGet(t *testing.T) {
 	t.Parallel()
 
@@ -159,7 +500,7 @@ func TestHandlerGet(t *testing.T) {
 	shortenerRepository, err := fileStorage.NewShortenerRepository(*shortenerDB)
 	require.NoError(t, err)
 
-	shortenerService := service.NewShortenerService(shortenerRepository, *cfg)
+	shortenerService := service.NewShortenerService(shortenerRepository, idgen.NewRandom(idgen.Base62, 8, ""), *cfg)
 	shortenerHandler := NewShortenerHandler(shortenerService)
 
 	route := chi.NewRouter()
@@ -239,7 +580,7 @@ func TestHandlerAddNewURLFromJson(t *testing.T) {
 			defer ts.Close()
 
 			if tt.mockErr != nil {
-				shortenerService.On("GenerateURL", mock.Anything, "https://practicum.yandex.ru", mock.Anything).
+				shortenerService.On("GenerateURL", mock.Anything, "https://practicum.yandex.ru", model.LinkOptions{}).
 					Return("", tt.mockErr).
 					Once()
 
@@ -249,7 +590,7 @@ func TestHandlerAddNewURLFromJson(t *testing.T) {
 						Once()
 				}
 			} else if tt.mockResult != "" {
-				shortenerService.On("GenerateURL", mock.Anything, "https://practicum.yandex.ru", mock.Anything).
+				shortenerService.On("GenerateURL", mock.Anything, "https://practicum.yandex.ru", model.LinkOptions{}).
 					Return(tt.mockResult, nil).
 					Once()
 			}
@@ -283,6 +624,160 @@ func TestHandlerAddNewURLFromJson(t *testing.T) {
 	}
 }
 
+func TestHandler_InvalidURL(t *testing.T) {
+	t.Parallel()
+
+	shortenerService := service.NewShortenerService(memory.NewShortenerRepository(), idgen.NewRandom(idgen.Base62, 8, ""), config.Config{
+		BaseURL:           "http://test.local",
+		MaxURLLength:      64,
+		URLAllowedSchemes: []string{"http", "https"},
+	})
+	handler := NewShortenerHandler(shortenerService)
+
+	router := chi.NewRouter()
+	router.Post("/", handler.CreateURL)
+	router.Post("/api/shorten", handler.AddNewURL)
+	router.Post("/api/shorten/batch", handler.Batch)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+		wantReason string
+	}{
+		{name: "text javascript", path: "/", body: "javascript:alert(1)", wantStatus: http.StatusBadRequest, wantReason: constants.URLReasonSchemeNotAllowed},
+		{name: "text empty", path: "/", body: "", wantStatus: http.StatusBadRequest, wantReason: constants.URLReasonEmpty},
+		{name: "text plain words", path: "/", body: "hello", wantStatus: http.StatusBadRequest, wantReason: constants.URLReasonMissingScheme},
+		{name: "text too long", path: "/", body: "https://a.com/" + strings.Repeat("a", 64), wantStatus: http.StatusRequestEntityTooLarge, wantReason: constants.URLReasonTooLong},
+		{name: "json relative", path: "/api/shorten", body: `{"url": "/a/b"}`, wantStatus: http.StatusBadRequest, wantReason: constants.URLReasonMissingScheme},
+		{name: "json control character", path: "/api/shorten", body: `{"url": "https://a.com/\u0007"}`, wantStatus: http.StatusBadRequest, wantReason: constants.URLReasonControlChars},
+		{name: "json no host", path: "/api/shorten", body: `{"url": "https:///a"}`, wantStatus: http.StatusBadRequest, wantReason: constants.URLReasonMissingHost},
+		{name: "json idn", path: "/api/shorten", body: `{"url": "https://пример.рф/"}`, wantStatus: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Post(ts.URL+tt.path, "application/json", strings.NewReader(tt.body))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			if tt.wantReason == "" {
+				return
+			}
+
+			var body model.ErrorResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+			assert.Equal(t, tt.wantReason, body.Reason)
+			assert.NotEmpty(t, body.Error)
+		})
+	}
+
+	// IDN сохраняется в punycode, поиск по исходному написанию находит ту же ссылку
+	shortURL, ok := shortenerService.GetURLByOriginalURL(context.Background(), "https://пример.рф/")
+	require.True(t, ok)
+	url, err := shortenerService.GetURLByID(context.Background(), strings.TrimPrefix(shortURL, "http://test.local/"), "")
+	require.NoError(t, err)
+	assert.Equal(t, "https://xn--e1afmkfd.xn--p1ai/", url)
+
+	resp, err := http.Post(ts.URL+"/api/shorten/batch", "application/json", strings.NewReader(`[
+		{"correlation_id": "a", "original_url": "https://b.com/"},
+		{"correlation_id": "b", "original_url": "javascript:alert(1)"},
+		{"correlation_id": "c", "original_url": "ftp://b.com/"}
+	]`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var items []model.ShortenerURLResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&items))
+	require.Len(t, items, 3)
+	assert.Equal(t, model.BatchStatusCreated, items[0].Status)
+	assert.Equal(t, model.BatchStatusInvalid, items[1].Status)
+	assert.Equal(t, constants.URLReasonSchemeNotAllowed, items[1].Reason)
+	assert.Equal(t, model.BatchStatusInvalid, items[2].Status)
+	assert.Equal(t, constants.URLReasonSchemeNotAllowed, items[2].Reason)
+}
+
+func TestHandler_ForbiddenURL(t *testing.T) {
+	t.Parallel()
+
+	blocklist := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(blocklist, []byte("*.evil.com\n"), 0o644))
+
+	cfg := config.Config{
+		BaseURL:               "http://test.local",
+		PolicyBlocklistFile:   blocklist,
+		PolicyDisableExisting: true,
+	}
+	domainPolicy, err := policy.New(cfg)
+	require.NoError(t, err)
+
+	shortenerService := service.NewShortenerService(memory.NewShortenerRepository(), idgen.NewRandom(idgen.Base62, 8, ""), cfg)
+	handler := NewShortenerHandler(shortenerService)
+
+	router := chi.NewRouter()
+	router.Get("/{id}", handler.GetURL)
+	router.Post("/", handler.CreateURL)
+	router.Post("/api/shorten", handler.AddNewURL)
+	router.Post("/api/shorten/batch", handler.Batch)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	client := ts.Client()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	// Ссылка создана до включения политики
+	shortURL, err := shortenerService.GenerateURL(context.Background(), "https://www.evil.com/old", model.LinkOptions{})
+	require.NoError(t, err)
+	shortenerService.SetPolicy(domainPolicy)
+
+	for _, tt := range []struct{ path, body string }{
+		{path: "/", body: "https://login.evil.com/"},
+		{path: "/api/shorten", body: `{"url": "https://a.b.evil.com/"}`},
+	} {
+		resp, err := client.Post(ts.URL+tt.path, "application/json", strings.NewReader(tt.body))
+		require.NoError(t, err)
+
+		var body model.ErrorResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, tt.path)
+		assert.Equal(t, constants.URLReasonBlockedDomain, body.Reason, tt.path)
+	}
+
+	resp, err := client.Post(ts.URL+"/api/shorten", "application/json", strings.NewReader(`{"url": "https://evil.com/"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, err = client.Post(ts.URL+"/api/shorten/batch", "application/json", strings.NewReader(`[
+		{"correlation_id": "a", "original_url": "https://b.com/"},
+		{"correlation_id": "b", "original_url": "https://x.evil.com/"}
+	]`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var items []model.ShortenerURLResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&items))
+	require.Len(t, items, 2)
+	assert.Equal(t, model.BatchStatusCreated, items[0].Status)
+	assert.Equal(t, model.BatchStatusForbidden, items[1].Status)
+	assert.Equal(t, constants.URLReasonBlockedDomain, items[1].Reason)
+
+	resp, err = client.Get(ts.URL + "/" + strings.TrimPrefix(shortURL, "http://test.local/"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
 func TestHandlerBatch(t *testing.T) {
 	t.Parallel()
 
@@ -302,7 +797,7 @@ func TestHandlerBatch(t *testing.T) {
 			data: `[ { "correlation_id": "test-1", "original_url": "http://google.com" }, { "correlation_id": "test-2", "original_url": "http://yandex.ru" }, { "correlation_id": "test-3", "original_url": "http://yandex.ru" } ]`,
 			want: want{
 				status: http.StatusCreated,
-				result: `[ { "correlation_id": "test-1", "short_url": "https://site.local/test-1" }, { "correlation_id": "test-2", "short_url": "https://site.local/test-2" }, { "correlation_id": "test-3", "short_url": "https://site.local/test-3" } ]`,
+				result: `[ { "correlation_id": "test-1", "short_url": "https://site.local/test-1", "status": "created" }, { "correlation_id": "test-2", "short_url": "https://site.local/test-2", "status": "created" }, { "correlation_id": "test-3", "short_url": "https://site.local/test-3", "status": "created" } ]`,
 			},
 			isError: false,
 		},
@@ -311,7 +806,7 @@ func TestHandlerBatch(t *testing.T) {
 			data: `[{ "correlation_id": "test-1", "original_url": "http://google.com" }, { "correlation_id": "test-1", "original_url": "http://yandex.ru" }]`,
 			want: want{
 				status: http.StatusCreated,
-				result: `[{ "correlation_id": "test-1", "short_url": "https://site.local/test-1" }, { "correlation_id": "test-1", "short_url": "https://site.local/test-1" }]`,
+				result: `[{ "correlation_id": "test-1", "short_url": "https://site.local/test-1", "status": "created" }, { "correlation_id": "test-1", "short_url": "https://site.local/test-1", "status": "created" }]`,
 			},
 			isError: false,
 		},
@@ -347,6 +842,7 @@ func TestHandlerBatch(t *testing.T) {
 					respItems = append(respItems, model.ShortenerURLResponse{
 						CorrelationID: item.CorrelationID,
 						ShortURL:      "https://site.local/" + item.CorrelationID,
+						Status:        model.BatchStatusCreated,
 					})
 				}
 
@@ -369,6 +865,68 @@ func TestHandlerBatch(t *testing.T) {
 	}
 }
 
+func TestHandlerBatch_FileStorage(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Config{
+		BaseURL:      "http://test.local",
+		FilePath:     filepath.Join(t.TempDir(), "data.json"),
+		MaxURLLength: 64,
+	}
+
+	shortenerDB, err := storage.NewShortenerDB(cfg)
+	require.NoError(t, err)
+
+	shortenerRepository, err := fileStorage.NewShortenerRepository(*shortenerDB)
+	require.NoError(t, err)
+	defer shortenerRepository.Close()
+
+	shortenerService := service.NewShortenerService(shortenerRepository, idgen.NewRandom(idgen.Base62, 8, ""), cfg)
+	shortenerHandler := NewShortenerHandler(shortenerService)
+
+	route := chi.NewRouter()
+	route.Post("/", shortenerHandler.CreateURL)
+	route.Post("/api/shorten/batch", shortenerHandler.Batch)
+
+	ts := httptest.NewServer(route)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL, "text/plain", strings.NewReader("https://practicum.yandex.ru/"))
+	require.NoError(t, err)
+	existing, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	resp, err = http.Post(ts.URL+"/api/shorten/batch", "application/json", strings.NewReader(`[
+		{"correlation_id": "a", "original_url": "https://yandex.ru/"},
+		{"correlation_id": "b", "original_url": "https://practicum.yandex.ru/"},
+		{"correlation_id": "c", "original_url": "https://yandex.ru/`+strings.Repeat("x", 64)+`"},
+		{"correlation_id": "d", "original_url": ""}
+	]`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var items []model.ShortenerURLResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&items))
+	require.Len(t, items, 4)
+
+	// correlation_id только возвращается клиенту и не становится коротким ID
+	assert.Equal(t, "a", items[0].CorrelationID)
+	assert.Equal(t, model.BatchStatusCreated, items[0].Status)
+	assert.NotEqual(t, "http://test.local/a", items[0].ShortURL)
+
+	id := strings.TrimPrefix(items[0].ShortURL, "http://test.local/")
+	url, err := shortenerService.GetURLByID(context.Background(), id, "")
+	require.NoError(t, err)
+	assert.Equal(t, "https://yandex.ru/", url)
+
+	assert.Equal(t, model.ShortenerURLResponse{CorrelationID: "b", ShortURL: string(existing), Status: model.BatchStatusExists}, items[1])
+	assert.Equal(t, model.ShortenerURLResponse{CorrelationID: "c", Status: model.BatchStatusInvalid, Error: constants.ErrURLTooLong.Error(), Reason: constants.URLReasonTooLong}, items[2])
+	assert.Equal(t, model.ShortenerURLResponse{CorrelationID: "d", Status: model.BatchStatusInvalid, Error: constants.ErrEmptyURL.Error(), Reason: constants.URLReasonEmpty}, items[3])
+}
+
 func TestShortenerHandler_GetUserURLS(t *testing.T) {
 	t.Parallel()
 
@@ -475,6 +1033,241 @@ func TestShortenerHandler_GetUserURLS(t *testing.T) {
 	}
 }
 
+func TestShortenerHandler_UpdateUserURL(t *testing.T) {
+	t.Parallel()
+
+	updated := model.ShortenerURLSForUserResponse{ShortURL: "http://short.url/abc", OriginalURL: "https://new.com"}
+
+	tests := []struct {
+		name       string
+		cookie     *http.Cookie
+		body       string
+		mockCalled bool
+		mockErr    error
+		wantStatus int
+	}{
+		{
+			name:       "No cookie present",
+			body:       `{"url": "https://new.com"}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Invalid JSON",
+			cookie:     &http.Cookie{Name: "user_id", Value: "user123"},
+			body:       `{"url":`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Updated",
+			cookie:     &http.Cookie{Name: "user_id", Value: "user123"},
+			body:       `{"url": "https://new.com"}`,
+			mockCalled: true,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Not found",
+			cookie:     &http.Cookie{Name: "user_id", Value: "user123"},
+			body:       `{"url": "https://new.com"}`,
+			mockCalled: true,
+			mockErr:    constants.ErrNotFound,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "Another owner",
+			cookie:     &http.Cookie{Name: "user_id", Value: "user123"},
+			body:       `{"url": "https://new.com"}`,
+			mockCalled: true,
+			mockErr:    constants.ErrNotOwner,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Deleted",
+			cookie:     &http.Cookie{Name: "user_id", Value: "user123"},
+			body:       `{"url": "https://new.com"}`,
+			mockCalled: true,
+			mockErr:    constants.ErrIsDeleted,
+			wantStatus: http.StatusGone,
+		},
+		{
+			name:       "URL already shortened",
+			cookie:     &http.Cookie{Name: "user_id", Value: "user123"},
+			body:       `{"url": "https://new.com"}`,
+			mockCalled: true,
+			mockErr:    constants.ErrUniqueIndex,
+			wantStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // захват переменной
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			mockService := NewMockShortenerService(t)
+			handler := ShortenerHandler{service: mockService}
+
+			router := chi.NewRouter()
+			router.Patch("/api/user/urls/{id}", handler.UpdateUserURL)
+			ts := httptest.NewServer(router)
+			defer ts.Close()
+
+			if tt.mockCalled {
+				mockService.On("UpdateURL", mock.Anything, "abc", "user123", "https://new.com").
+					Return(updated, tt.mockErr).
+					Once()
+			}
+
+			req, err := http.NewRequest(http.MethodPatch, ts.URL+"/api/user/urls/abc", strings.NewReader(tt.body))
+			require.NoError(t, err)
+
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+
+			if tt.wantStatus == http.StatusOK {
+				var got model.ShortenerURLSForUserResponse
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+				assert.Equal(t, updated, got)
+			}
+		})
+	}
+}
+
+func TestShortenerHandler_URLHistory(t *testing.T) {
+	t.Parallel()
+
+	mockService := NewMockShortenerService(t)
+	handler := ShortenerHandler{service: mockService}
+
+	router := chi.NewRouter()
+	router.Get("/api/user/urls/{id}/history", handler.GetURLHistory)
+	router.Post("/api/user/urls/{id}/history/{version}/restore", handler.RestoreURL)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	history := []model.URLEdit{
+		{Version: 2, OriginalURL: "https://b.com", ChangedAt: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{Version: 1, OriginalURL: "https://a.com", ChangedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	mockService.On("GetURLHistory", mock.Anything, "abc", "user123").Return(history, nil).Once()
+	mockService.On("GetURLHistory", mock.Anything, "new", "user123").Return(nil, nil).Once()
+	mockService.On("RestoreURL", mock.Anything, "abc", "user123", 1).
+		Return(model.ShortenerURLSForUserResponse{ShortURL: "http://short.url/abc", OriginalURL: "https://a.com"}, nil).
+		Once()
+	mockService.On("RestoreURL", mock.Anything, "abc", "user123", 5).
+		Return(model.ShortenerURLSForUserResponse{}, constants.ErrVersionNotFound).
+		Once()
+
+	do := func(method, path string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, nil)
+		require.NoError(t, err)
+		req.AddCookie(&http.Cookie{Name: "user_id", Value: "user123"})
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+
+		return resp
+	}
+
+	resp := do(http.MethodGet, "/api/user/urls/abc/history")
+	var got []model.URLEdit
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, history, got)
+
+	resp = do(http.MethodGet, "/api/user/urls/new/history")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp = do(http.MethodPost, "/api/user/urls/abc/history/1/restore")
+	var restored model.ShortenerURLSForUserResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&restored))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "https://a.com", restored.OriginalURL)
+
+	resp = do(http.MethodPost, "/api/user/urls/abc/history/5/restore")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = do(http.MethodPost, "/api/user/urls/abc/history/first/restore")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestShortenerHandler_Trash(t *testing.T) {
+	t.Parallel()
+
+	mockService := NewMockShortenerService(t)
+	handler := ShortenerHandler{service: mockService}
+
+	router := chi.NewRouter()
+	router.Get("/api/user/urls/trash", handler.GetDeletedURLs)
+	router.Post("/api/user/urls/trash/{id}/restore", handler.RestoreDeletedURL)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	deletedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	trash := []model.DeletedURLResponse{{
+		ShortURL:     "http://short.url/abc",
+		OriginalURL:  "https://a.com",
+		DeletedAt:    deletedAt,
+		RestoreUntil: deletedAt.Add(7 * 24 * time.Hour),
+	}}
+	mockService.On("GetDeletedURLs", mock.Anything, "user123").Return(trash, nil).Once()
+	mockService.On("GetDeletedURLs", mock.Anything, "empty").Return(nil, nil).Once()
+	mockService.On("RestoreDeletedURL", mock.Anything, "abc", "user123").Return(nil).Once()
+	mockService.On("RestoreDeletedURL", mock.Anything, "old", "user123").Return(constants.ErrRestoreWindowPassed).Once()
+	mockService.On("RestoreDeletedURL", mock.Anything, "foreign", "user123").Return(constants.ErrNotOwner).Once()
+
+	do := func(method, path, userID string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, nil)
+		require.NoError(t, err)
+		if userID != "" {
+			req.AddCookie(&http.Cookie{Name: "user_id", Value: userID})
+		}
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+
+		return resp
+	}
+
+	resp := do(http.MethodGet, "/api/user/urls/trash", "user123")
+	var got []model.DeletedURLResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, trash, got)
+
+	resp = do(http.MethodGet, "/api/user/urls/trash", "empty")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	tests := []struct {
+		id         string
+		userID     string
+		wantStatus int
+	}{
+		{id: "abc", userID: "user123", wantStatus: http.StatusNoContent},
+		{id: "abc", wantStatus: http.StatusUnauthorized},
+		{id: "old", userID: "user123", wantStatus: http.StatusGone},
+		{id: "foreign", userID: "user123", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		resp = do(http.MethodPost, "/api/user/urls/trash/"+tt.id+"/restore", tt.userID)
+		resp.Body.Close()
+		assert.Equal(t, tt.wantStatus, resp.StatusCode, tt.id)
+	}
+}
+
 func TestShortenerHandler_DeleteUserURLS(t *testing.T) {
 	t.Parallel()
 
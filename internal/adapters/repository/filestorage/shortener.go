@@ -5,19 +5,31 @@ package filestorage
 import (
 	"context"
 	"errors"
-	"strings"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/constants"
 	"github.com/bubaew95/yandex-go-learn/internal/adapters/storage"
 	"github.com/bubaew95/yandex-go-learn/internal/core/model"
+	"github.com/bubaew95/yandex-go-learn/pkg/crypto"
 )
 
 // ShortenerRepository реализует интерфейс репозитория для работы с сокращёнными URL.
 // Использует in-memory кэш с синхронизацией и файловое хранилище.
+//
+// Помимо кэша по короткому ID поддерживается обратный индекс оригинальный URL -> ID,
+// который, как и уникальный индекс в PostgreSQL, учитывает в том числе удалённые ссылки.
 type ShortenerRepository struct {
 	shortenerDB storage.ShortenerDB
 	mx          *sync.RWMutex
-	cache       map[string]string
+	cache       map[string]model.ShortenURL
+	index       map[string]string
+
+	// seq — последний выданный UUID. Не зависит от размера кэша, из которого
+	// окончательно удалённые ссылки могут быть убраны.
+	seq *atomic.Int64
 }
 
 // NewShortenerRepository инициализирует новый экземпляр ShortenerRepository.
@@ -30,10 +42,25 @@ func NewShortenerRepository(s storage.ShortenerDB) (*ShortenerRepository, error)
 		return nil, err
 	}
 
+	index := make(map[string]string, len(data))
+	seq := &atomic.Int64{}
+	for id, v := range data {
+		seq.Store(max(seq.Load(), int64(v.UUID)))
+
+		// У окончательно удалённых ссылок URL уже освобождён
+		if v.Purged {
+			continue
+		}
+
+		index[v.OriginalURL] = id
+	}
+
 	return &ShortenerRepository{
 		shortenerDB: s,
 		mx:          &sync.RWMutex{},
 		cache:       data,
+		index:       index,
+		seq:         seq,
 	}, nil
 }
 
@@ -42,50 +69,175 @@ func (s ShortenerRepository) Close() error {
 	return s.shortenerDB.Close()
 }
 
-// SetURL сохраняет соответствие между коротким ID и оригинальным URL.
+// SetURL сохраняет новую ссылку.
+// Владельцем ссылки становится пользователь из контекста запроса.
 // Добавляет запись в кэш и в файловое хранилище.
-func (s ShortenerRepository) SetURL(ctx context.Context, id string, url string) error {
+//
+// Если оригинальный URL уже есть в хранилище, возвращает ErrUniqueIndex,
+// а если занят короткий ID — ErrIDConflict.
+func (s ShortenerRepository) SetURL(ctx context.Context, link model.ShortenURL) error {
+	id, url := link.ShortURL, link.OriginalURL
+
 	s.mx.Lock()
 	defer s.mx.Unlock()
 
-	s.cache[id] = url
+	if _, ok := s.index[url]; ok {
+		return constants.ErrUniqueIndex
+	}
 
-	data := &model.ShortenURL{
-		UUID:        len(s.cache),
-		ShortURL:    id,
-		OriginalURL: url,
+	if _, ok := s.cache[id]; ok {
+		return constants.ErrIDConflict
 	}
 
-	return s.shortenerDB.Save(data)
+	return s.save(model.ShortenURL{
+		UUID:         int(s.seq.Add(1)),
+		ShortURL:     id,
+		OriginalURL:  url,
+		SubmittedURL: link.SubmittedURL,
+		UserID:       userIDFromContext(ctx),
+		ExpiresAt:    link.ExpiresAt,
+		ClicksLeft:   link.ClicksLeft,
+		PasswordHash: link.PasswordHash,
+	})
+}
+
+// save записывает запись в файл и обновляет кэш и обратный индекс.
+// Вызывается под блокировкой.
+func (s ShortenerRepository) save(data model.ShortenURL) error {
+	if err := s.shortenerDB.Save(&data); err != nil {
+		return err
+	}
+
+	if prev, ok := s.cache[data.ShortURL]; ok && prev.OriginalURL != data.OriginalURL {
+		delete(s.index, prev.OriginalURL)
+	}
+
+	s.cache[data.ShortURL] = data
+	s.index[data.OriginalURL] = data.ShortURL
+
+	return nil
 }
 
 // GetURLByID возвращает оригинальный URL по его короткому идентификатору.
-// Возвращает ошибку, если соответствие не найдено.
-func (s ShortenerRepository) GetURLByID(ctx context.Context, id string) (string, error) {
+// Возвращает ошибку, если соответствие не найдено, ErrIsDeleted, если ссылка
+// помечена как удалённая, и ErrExpired, если истёк срок её жизни.
+//
+// У ссылки с лимитом переходов под блокировкой на запись списывается один переход,
+// а в файл дописывается запись с новым остатком; если лимит исчерпан,
+// возвращается ErrNoClicksLeft. Для ссылки с паролем возвращается ErrPasswordRequired.
+func (s ShortenerRepository) GetURLByID(ctx context.Context, id string, check func(url string) error) (string, error) {
+	item, ok := s.lookup(id)
+	if !ok {
+		return "", errors.New("not found")
+	}
+
+	if err := checkAvailable(item); err != nil {
+		return "", err
+	}
+
+	if item.PasswordHash != "" {
+		return "", constants.ErrPasswordRequired
+	}
+
+	return s.follow(item, check)
+}
+
+// UnlockURL выполняет переход по ссылке после проверки её пароля функцией verify.
+// Для ссылки без пароля verify не вызывается. URL ссылки, как и в GetURLByID,
+// проверяется функцией check до списания перехода.
+func (s ShortenerRepository) UnlockURL(ctx context.Context, id string, verify func(passwordHash string) error, check func(url string) error) (string, error) {
+	item, ok := s.lookup(id)
+	if !ok {
+		return "", errors.New("not found")
+	}
+
+	if err := checkAvailable(item); err != nil {
+		return "", err
+	}
+
+	if item.PasswordHash != "" {
+		if err := verify(item.PasswordHash); err != nil {
+			return "", err
+		}
+	}
+
+	return s.follow(item, check)
+}
+
+// follow выполняет переход по доступной ссылке: проверяет URL функцией check, если она задана,
+// и только затем у ссылки с лимитом списывает переход.
+func (s ShortenerRepository) follow(item model.ShortenURL, check func(url string) error) (string, error) {
+	url := item.RedirectURL()
+	if check != nil {
+		if err := check(url); err != nil {
+			return "", err
+		}
+	}
+
+	if item.ClicksLeft == nil {
+		return url, nil
+	}
+
+	return s.consumeClick(item.ShortURL)
+}
+
+func (s ShortenerRepository) lookup(id string) (model.ShortenURL, bool) {
 	s.mx.RLock()
 	defer s.mx.RUnlock()
 
-	url, ok := s.cache[id]
+	item, ok := s.cache[id]
+	return item, ok
+}
+
+// checkAvailable проверяет, что по ссылке можно перейти.
+func checkAvailable(item model.ShortenURL) error {
+	if item.IsDeleted {
+		return constants.ErrIsDeleted
+	}
+
+	if item.Expired(time.Now()) {
+		return constants.ErrExpired
+	}
+
+	if item.ClicksLeft != nil && *item.ClicksLeft <= 0 {
+		return constants.ErrNoClicksLeft
+	}
+
+	return nil
+}
+
+// consumeClick списывает один переход по ссылке с лимитом.
+// Состояние ссылки перепроверяется под блокировкой на запись.
+func (s ShortenerRepository) consumeClick(id string) (string, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	item, ok := s.cache[id]
 	if !ok {
 		return "", errors.New("not found")
 	}
 
-	return url, nil
+	if err := checkAvailable(item); err != nil {
+		return "", err
+	}
+
+	clicks := *item.ClicksLeft - 1
+	item.ClicksLeft = &clicks
+	if err := s.save(item); err != nil {
+		return "", err
+	}
+
+	return item.RedirectURL(), nil
 }
 
 // GetURLByOriginalURL возвращает короткий ID по оригинальному URL.
-// Используется сравнение по вхождению (contains).
+// Используется точное сравнение по обратному индексу.
 func (s ShortenerRepository) GetURLByOriginalURL(ctx context.Context, originalURL string) (string, bool) {
 	s.mx.RLock()
 	defer s.mx.RUnlock()
 
-	for id, v := range s.cache {
-		if strings.Contains(v, originalURL) {
-			return id, true
-		}
-	}
-
-	return "", false
+	id, ok := s.index[originalURL]
+	return id, ok
 }
 
 // Ping реализует метод "пинга" для проверки доступности хранилища.
@@ -94,35 +246,66 @@ func (s ShortenerRepository) Ping(ctx context.Context) error {
 	return nil
 }
 
-// InsertURLs добавляет список URL в хранилище, если они ещё не существуют.
-// Пропускает уже существующие записи.
-func (s ShortenerRepository) InsertURLs(ctx context.Context, urls []model.ShortenerURLMapping) error {
-	for _, v := range urls {
-		_, err := s.GetURLByID(ctx, v.CorrelationID)
-		if err == nil {
+// InsertURLs добавляет список URL в хранилище под одной блокировкой и возвращает
+// результат для каждой записи. Записи с уже сокращённым URL или занятым ID пропускаются.
+func (s ShortenerRepository) InsertURLs(ctx context.Context, urls []model.BatchURL) ([]model.BatchURLResult, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	results := make([]model.BatchURLResult, len(urls))
+
+	userID := userIDFromContext(ctx)
+	for i, v := range urls {
+		results[i].ID = v.ID
+
+		if id, ok := s.index[v.OriginalURL]; ok {
+			results[i] = model.BatchURLResult{ID: id, Err: constants.ErrUniqueIndex}
+			continue
+		}
+
+		if _, ok := s.cache[v.ID]; ok {
+			results[i].Err = constants.ErrIDConflict
 			continue
 		}
 
-		err = s.SetURL(ctx, v.CorrelationID, v.OriginalURL)
+		err := s.save(model.ShortenURL{
+			UUID:         int(s.seq.Add(1)),
+			ShortURL:     v.ID,
+			OriginalURL:  v.OriginalURL,
+			SubmittedURL: v.SubmittedURL,
+			UserID:       userID,
+			ExpiresAt:    v.ExpiresAt,
+			ClicksLeft:   v.ClicksLeft,
+			PasswordHash: v.PasswordHash,
+		})
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	return nil
+	return results, nil
 }
 
 // InsertURLTwo обновляет только те записи, которые уже есть в кэше.
 // Полезно для обновления оригинальных URL.
-func (s ShortenerRepository) InsertURLTwo(ctx context.Context, urls []model.ShortenerURLMapping) error {
+//
+// Если новый URL уже принадлежит другой ссылке, возвращает ErrUniqueIndex.
+func (s ShortenerRepository) InsertURLTwo(ctx context.Context, urls []model.BatchURL) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
 	for _, v := range urls {
-		_, ok := s.cache[v.CorrelationID]
+		current, ok := s.cache[v.ID]
 		if !ok {
 			continue
 		}
 
-		err := s.SetURL(ctx, v.CorrelationID, v.OriginalURL)
-		if err != nil {
+		if id, taken := s.index[v.OriginalURL]; taken && id != v.ID {
+			return constants.ErrUniqueIndex
+		}
+
+		current.OriginalURL = v.OriginalURL
+		if err := s.save(current); err != nil {
 			return err
 		}
 	}
@@ -131,13 +314,271 @@ func (s ShortenerRepository) InsertURLTwo(ctx context.Context, urls []model.Shor
 }
 
 // GetURLSByUserID возвращает список URL, привязанных к конкретному пользователю.
-// В текущей реализации не реализован и всегда возвращает nil.
-func (s ShortenerRepository) GetURLSByUserID(ctx context.Context, userID string) (map[string]string, error) {
-	return nil, nil
+// Как и в PostgreSQL, в выборку попадают в том числе удалённые ссылки,
+// кроме окончательно удалённых.
+func (s ShortenerRepository) GetURLSByUserID(ctx context.Context, userID string) ([]model.ShortenURL, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	var items []model.ShortenURL
+	for _, v := range s.cache {
+		if v.UserID == userID && !v.Purged {
+			items = append(items, v)
+		}
+	}
+
+	return items, nil
 }
 
-// DeleteUserURLS удаляет список URL, привязанных к пользователю.
-// В текущей реализации не реализован и всегда возвращает nil.
+// DeleteUserURLS помечает ссылки пользователя как удалённые.
+//
+// Для каждой удалённой ссылки в файл дописывается запись-«надгробие»,
+// которая воспроизводится при следующей загрузке хранилища.
+// Ссылки, принадлежащие другим пользователям, не затрагиваются.
 func (s ShortenerRepository) DeleteUserURLS(ctx context.Context, items []model.URLToDelete) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for _, item := range items {
+		current, ok := s.cache[item.ShortLink]
+		if !ok || current.IsDeleted || current.UserID != item.UserID {
+			continue
+		}
+
+		now := time.Now().UTC()
+		current.IsDeleted = true
+		current.DeletedAt = &now
+
+		err := s.shortenerDB.Save(&model.ShortenURL{
+			UUID:      current.UUID,
+			ShortURL:  current.ShortURL,
+			UserID:    current.UserID,
+			IsDeleted: true,
+			DeletedAt: &now,
+		})
+		if err != nil {
+			return err
+		}
+
+		s.cache[item.ShortLink] = current
+	}
+
+	return nil
+}
+
+// UpdateURL заменяет оригинальный URL ссылки пользователя и дописывает прежний URL для перехода в её историю.
+//
+// В файл дописывается полная запись ссылки вместе с историей, поэтому история
+// восстанавливается при следующей загрузке хранилища и переживает сжатие.
+func (s ShortenerRepository) UpdateURL(ctx context.Context, id string, userID string, url string, submittedURL string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	current, ok := s.cache[id]
+	if !ok {
+		return constants.ErrNotFound
+	}
+
+	if err := checkOwner(current, userID); err != nil {
+		return err
+	}
+
+	if current.OriginalURL == url && current.SubmittedURL == submittedURL {
+		return nil
+	}
+
+	if owner, taken := s.index[url]; taken && owner != id {
+		return constants.ErrUniqueIndex
+	}
+
+	current.History = append(slices.Clip(current.History), model.URLEdit{
+		Version:     len(current.History) + 1,
+		OriginalURL: current.RedirectURL(),
+		ChangedAt:   time.Now().UTC(),
+	})
+	current.OriginalURL = url
+	current.SubmittedURL = submittedURL
+
+	return s.save(current)
+}
+
+// GetURLHistory возвращает прежние оригинальные URL ссылки пользователя.
+func (s ShortenerRepository) GetURLHistory(ctx context.Context, id string, userID string) ([]model.URLEdit, error) {
+	current, ok := s.lookup(id)
+	if !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	if err := checkOwner(current, userID); err != nil {
+		return nil, err
+	}
+
+	return slices.Clone(current.History), nil
+}
+
+// checkOwner проверяет, что ссылку может изменять пользователь userID.
+func checkOwner(item model.ShortenURL, userID string) error {
+	if item.UserID != userID {
+		return constants.ErrNotOwner
+	}
+
+	if item.IsDeleted {
+		return constants.ErrIsDeleted
+	}
+
+	return nil
+}
+
+// GetDeletedURLs возвращает удалённые ссылки пользователя, которые ещё можно восстановить.
+func (s ShortenerRepository) GetDeletedURLs(ctx context.Context, userID string, deletedAfter time.Time) ([]model.ShortenURL, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	var items []model.ShortenURL
+	for _, v := range s.cache {
+		if v.IsDeleted && checkUndelete(v, userID, deletedAfter) == nil {
+			items = append(items, v)
+		}
+	}
+
+	return items, nil
+}
+
+// UndeleteURL снимает пометку удаления со ссылки пользователя.
+//
+// В файл дописывается полная запись ссылки без пометки удаления: при загрузке
+// она заменяет ранее записанное «надгробие».
+func (s ShortenerRepository) UndeleteURL(ctx context.Context, id string, userID string, deletedAfter time.Time) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	current, ok := s.cache[id]
+	if !ok {
+		return constants.ErrNotFound
+	}
+
+	if current.UserID == userID && !current.IsDeleted {
+		return nil
+	}
+
+	if err := checkUndelete(current, userID, deletedAfter); err != nil {
+		return err
+	}
+
+	current.IsDeleted = false
+	current.DeletedAt = nil
+
+	return s.save(current)
+}
+
+// checkUndelete проверяет, что пользователь userID может восстановить удалённую ссылку:
+// она удалена не раньше deletedAfter, ещё не очищена и срок её жизни не истёк.
+func checkUndelete(item model.ShortenURL, userID string, deletedAfter time.Time) error {
+	if item.UserID != userID {
+		return constants.ErrNotOwner
+	}
+
+	if item.Purged || item.DeletedAt == nil || item.DeletedAt.Before(deletedAfter) {
+		return constants.ErrRestoreWindowPassed
+	}
+
+	if item.Expired(time.Now()) {
+		return constants.ErrExpired
+	}
+
 	return nil
 }
+
+// ExpireURLs помечает удалёнными не более limit ссылок, срок жизни которых истёк
+// к expiredBefore. Временем удаления становится время истечения.
+//
+// Как и при удалении пользователем, в файл дописывается запись-«надгробие».
+func (s ShortenerRepository) ExpireURLs(ctx context.Context, expiredBefore time.Time, limit int) (int, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	expired := 0
+	for id, current := range s.cache {
+		if expired >= limit {
+			break
+		}
+
+		if current.IsDeleted || !current.Expired(expiredBefore) {
+			continue
+		}
+
+		err := s.shortenerDB.Save(&model.ShortenURL{
+			UUID:      current.UUID,
+			ShortURL:  current.ShortURL,
+			UserID:    current.UserID,
+			IsDeleted: true,
+			DeletedAt: current.ExpiresAt,
+		})
+		if err != nil {
+			return expired, err
+		}
+
+		current.IsDeleted = true
+		current.DeletedAt = current.ExpiresAt
+		s.cache[id] = current
+
+		expired++
+	}
+
+	return expired, nil
+}
+
+// PurgeDeletedURLs окончательно удаляет не более limit ссылок, помеченных
+// удалёнными раньше deletedBefore, и освобождает их оригинальные URL.
+//
+// Для каждой ссылки в файл дописывается запись об окончательном удалении.
+// При reuseIDs запись удаляется из кэша целиком и ID может быть выдан снова,
+// иначе в кэше остаётся запись без URL, чтобы ID не достался другой ссылке.
+// Ссылки, удалённые до появления отметки времени удаления, не затрагиваются.
+func (s ShortenerRepository) PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time, limit int, reuseIDs bool) (int, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	purged := 0
+	for id, current := range s.cache {
+		if purged >= limit {
+			break
+		}
+
+		if !current.IsDeleted || current.Purged || current.DeletedAt == nil || !current.DeletedAt.Before(deletedBefore) {
+			continue
+		}
+
+		record := model.ShortenURL{
+			UUID:      current.UUID,
+			ShortURL:  current.ShortURL,
+			UserID:    current.UserID,
+			IsDeleted: !reuseIDs,
+			DeletedAt: current.DeletedAt,
+			Purged:    true,
+		}
+
+		if err := s.shortenerDB.Save(&record); err != nil {
+			return purged, err
+		}
+
+		if s.index[current.OriginalURL] == id {
+			delete(s.index, current.OriginalURL)
+		}
+
+		if reuseIDs {
+			delete(s.cache, id)
+		} else {
+			s.cache[id] = record
+		}
+
+		purged++
+	}
+
+	return purged, nil
+}
+
+func userIDFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(crypto.KeyUserID).(string)
+	return userID
+}
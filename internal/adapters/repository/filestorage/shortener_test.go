@@ -2,16 +2,21 @@ package filestorage
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/bubaew95/yandex-go-learn/config"
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/constants"
 	"github.com/bubaew95/yandex-go-learn/internal/adapters/storage"
 	"github.com/bubaew95/yandex-go-learn/internal/core/model"
+	"github.com/bubaew95/yandex-go-learn/pkg/crypto"
 )
 
 func BenchmarkShortenerRepository_InsertURLs(b *testing.B) {
@@ -27,14 +32,14 @@ func BenchmarkShortenerRepository_InsertURLs(b *testing.B) {
 
 	shortener, _ := NewShortenerRepository(*shortenerDB)
 
-	items := []model.ShortenerURLMapping{
+	items := []model.BatchURL{
 		{
-			CorrelationID: "rasf1D",
-			OriginalURL:   "http://test.local",
+			ID:          "rasf1D",
+			OriginalURL: "http://test.local",
 		},
 		{
-			CorrelationID: "rasf2D",
-			OriginalURL:   "http://test.local",
+			ID:          "rasf2D",
+			OriginalURL: "http://test.local",
 		},
 	}
 
@@ -70,16 +75,16 @@ func TestShortenerRepository_SetAndGet(t *testing.T) {
 	repo, err := NewShortenerRepository(*db)
 	require.NoError(t, err)
 
-	err = repo.SetURL(context.Background(), "abc123", "https://example.com")
+	err = repo.SetURL(context.Background(), model.ShortenURL{ShortURL: "abc123", OriginalURL: "https://example.com"})
 	require.NoError(t, err)
 
 	// Get by ID
-	got, err := repo.GetURLByID(context.Background(), "abc123")
+	got, err := repo.GetURLByID(context.Background(), "abc123", nil)
 	require.NoError(t, err)
 	assert.Equal(t, "https://example.com", got)
 
 	// Get by OriginalURL
-	id, found := repo.GetURLByOriginalURL(context.Background(), "example.com")
+	id, found := repo.GetURLByOriginalURL(context.Background(), "https://example.com")
 	assert.True(t, found)
 	assert.Equal(t, "abc123", id)
 }
@@ -94,19 +99,20 @@ func TestShortenerRepository_InsertURLs(t *testing.T) {
 	repo, err := NewShortenerRepository(*db)
 	require.NoError(t, err)
 
-	urls := []model.ShortenerURLMapping{
-		{CorrelationID: "id1", OriginalURL: "https://a.com"},
-		{CorrelationID: "id2", OriginalURL: "https://b.com"},
+	urls := []model.BatchURL{
+		{ID: "id1", OriginalURL: "https://a.com"},
+		{ID: "id2", OriginalURL: "https://b.com"},
 	}
 
-	err = repo.InsertURLs(context.Background(), urls)
+	results, err := repo.InsertURLs(context.Background(), urls)
 	require.NoError(t, err)
+	assert.Equal(t, []model.BatchURLResult{{ID: "id1"}, {ID: "id2"}}, results)
 
-	got1, err := repo.GetURLByID(context.Background(), "id1")
+	got1, err := repo.GetURLByID(context.Background(), "id1", nil)
 	require.NoError(t, err)
 	assert.Equal(t, "https://a.com", got1)
 
-	got2, err := repo.GetURLByID(context.Background(), "id2")
+	got2, err := repo.GetURLByID(context.Background(), "id2", nil)
 	require.NoError(t, err)
 	assert.Equal(t, "https://b.com", got2)
 }
@@ -136,29 +142,29 @@ func TestShortenerRepository_InsertURLTwo(t *testing.T) {
 	require.NoError(t, err)
 
 	// Сначала сохраним
-	err = repo.SetURL(context.Background(), "id1", "https://old.com")
+	err = repo.SetURL(context.Background(), model.ShortenURL{ShortURL: "id1", OriginalURL: "https://old.com"})
 	require.NoError(t, err)
 
 	// Попробуем обновить
-	update := []model.ShortenerURLMapping{
-		{CorrelationID: "id1", OriginalURL: "https://new.com"},
-		{CorrelationID: "missing", OriginalURL: "https://should-not-be-added.com"},
+	update := []model.BatchURL{
+		{ID: "id1", OriginalURL: "https://new.com"},
+		{ID: "missing", OriginalURL: "https://should-not-be-added.com"},
 	}
 
 	err = repo.InsertURLTwo(context.Background(), update)
 	require.NoError(t, err)
 
 	// Должен быть обновлён
-	got, err := repo.GetURLByID(context.Background(), "id1")
+	got, err := repo.GetURLByID(context.Background(), "id1", nil)
 	require.NoError(t, err)
 	assert.Equal(t, "https://new.com", got)
 
 	// Не должен быть добавлен
-	_, err = repo.GetURLByID(context.Background(), "missing")
+	_, err = repo.GetURLByID(context.Background(), "missing", nil)
 	assert.Error(t, err)
 }
 
-func TestShortenerRepository_NotImplemented(t *testing.T) {
+func TestShortenerRepository_UserURLs(t *testing.T) {
 	file := createTempStorageFile(t)
 
 	cfg := config.Config{FilePath: file}
@@ -168,12 +174,523 @@ func TestShortenerRepository_NotImplemented(t *testing.T) {
 	repo, err := NewShortenerRepository(*db)
 	require.NoError(t, err)
 
-	// DeleteUserURLS
-	err = repo.DeleteUserURLS(context.Background(), nil)
+	ctxUser1 := context.WithValue(context.Background(), crypto.KeyUserID, "user-1")
+	ctxUser2 := context.WithValue(context.Background(), crypto.KeyUserID, "user-2")
+
+	require.NoError(t, repo.SetURL(ctxUser1, model.ShortenURL{ShortURL: "id1", OriginalURL: "https://a.com"}))
+	require.NoError(t, repo.SetURL(ctxUser1, model.ShortenURL{ShortURL: "id2", OriginalURL: "https://b.com"}))
+	require.NoError(t, repo.SetURL(ctxUser2, model.ShortenURL{ShortURL: "id3", OriginalURL: "https://c.com"}))
+
+	urls, err := repo.GetURLSByUserID(context.Background(), "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"id1": "https://a.com", "id2": "https://b.com"}, originalURLs(urls))
+
+	urls, err = repo.GetURLSByUserID(context.Background(), "unknown")
+	require.NoError(t, err)
+	assert.Empty(t, urls)
+}
+
+func TestShortenerRepository_DeleteUserURLS(t *testing.T) {
+	file := createTempStorageFile(t)
+
+	cfg := config.Config{FilePath: file}
+	db, err := storage.NewShortenerDB(cfg)
+	require.NoError(t, err)
+
+	repo, err := NewShortenerRepository(*db)
+	require.NoError(t, err)
+
+	ctxUser1 := context.WithValue(context.Background(), crypto.KeyUserID, "user-1")
+	ctxUser2 := context.WithValue(context.Background(), crypto.KeyUserID, "user-2")
+
+	require.NoError(t, repo.SetURL(ctxUser1, model.ShortenURL{ShortURL: "id1", OriginalURL: "https://a.com"}))
+	require.NoError(t, repo.SetURL(ctxUser2, model.ShortenURL{ShortURL: "id2", OriginalURL: "https://b.com"}))
+
+	err = repo.DeleteUserURLS(context.Background(), []model.URLToDelete{
+		{ShortLink: "id1", UserID: "user-1"},
+		{ShortLink: "id2", UserID: "user-1"}, // чужая ссылка
+		{ShortLink: "missing", UserID: "user-1"},
+	})
+	require.NoError(t, err)
+
+	_, err = repo.GetURLByID(context.Background(), "id1", nil)
+	require.ErrorIs(t, err, constants.ErrIsDeleted)
+
+	got, err := repo.GetURLByID(context.Background(), "id2", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://b.com", got)
+
+	// Надгробия должны воспроизводиться после перезапуска
+	require.NoError(t, repo.Close())
+
+	db, err = storage.NewShortenerDB(cfg)
+	require.NoError(t, err)
+
+	repo, err = NewShortenerRepository(*db)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	_, err = repo.GetURLByID(context.Background(), "id1", nil)
+	require.ErrorIs(t, err, constants.ErrIsDeleted)
+
+	urls, err := repo.GetURLSByUserID(context.Background(), "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"id1": "https://a.com"}, originalURLs(urls))
+}
+
+func TestShortenerRepository_ExpireURLs(t *testing.T) {
+	file := createTempStorageFile(t)
+
+	cfg := config.Config{FilePath: file}
+	db, err := storage.NewShortenerDB(cfg)
+	require.NoError(t, err)
+
+	repo, err := NewShortenerRepository(*db)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	past := time.Now().Add(-time.Minute).UTC()
+	future := time.Now().Add(time.Hour).UTC()
+	require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id1", OriginalURL: "https://a.com", ExpiresAt: &past}))
+	require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id2", OriginalURL: "https://b.com", ExpiresAt: &future}))
+
+	_, err = repo.GetURLByID(ctx, "id1", nil)
+	require.ErrorIs(t, err, constants.ErrExpired)
+
+	expired, err := repo.ExpireURLs(ctx, time.Now(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, expired)
+
+	// Срок жизни и пометка об удалении должны восстанавливаться после перезапуска
+	require.NoError(t, repo.Close())
+
+	db, err = storage.NewShortenerDB(cfg)
+	require.NoError(t, err)
+
+	repo, err = NewShortenerRepository(*db)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	_, err = repo.GetURLByID(ctx, "id1", nil)
+	require.ErrorIs(t, err, constants.ErrIsDeleted)
+
+	got, err := repo.GetURLByID(ctx, "id2", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://b.com", got)
+
+	expired, err = repo.ExpireURLs(ctx, time.Now(), 10)
+	require.NoError(t, err)
+	assert.Zero(t, expired)
+}
+
+func TestShortenerRepository_OneTimeLink(t *testing.T) {
+	file := createTempStorageFile(t)
+
+	cfg := config.Config{FilePath: file}
+	db, err := storage.NewShortenerDB(cfg)
+	require.NoError(t, err)
+
+	repo, err := NewShortenerRepository(*db)
+	require.NoError(t, err)
+
+	ctx := context.WithValue(context.Background(), crypto.KeyUserID, "user-1")
+	once, twice := 1, 2
+	require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id1", OriginalURL: "https://a.com", ClicksLeft: &once}))
+	require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id2", OriginalURL: "https://b.com", ClicksLeft: &twice}))
+
+	got, err := repo.GetURLByID(ctx, "id1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://a.com", got)
+
+	_, err = repo.GetURLByID(ctx, "id1", nil)
+	require.ErrorIs(t, err, constants.ErrNoClicksLeft)
+
+	_, err = repo.GetURLByID(ctx, "id2", nil)
+	require.NoError(t, err)
+
+	// Остаток переходов должен восстанавливаться после перезапуска
+	require.NoError(t, repo.Close())
+
+	db, err = storage.NewShortenerDB(cfg)
+	require.NoError(t, err)
+
+	repo, err = NewShortenerRepository(*db)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	_, err = repo.GetURLByID(ctx, "id1", nil)
+	require.ErrorIs(t, err, constants.ErrNoClicksLeft)
+
+	urls, err := repo.GetURLSByUserID(ctx, "user-1")
+	require.NoError(t, err)
+
+	clicksLeft := make(map[string]int)
+	for _, v := range urls {
+		require.NotNil(t, v.ClicksLeft)
+		clicksLeft[v.ShortURL] = *v.ClicksLeft
+	}
+	assert.Equal(t, map[string]int{"id1": 0, "id2": 1}, clicksLeft)
+}
+
+func TestShortenerRepository_PasswordLink(t *testing.T) {
+	file := createTempStorageFile(t)
+
+	cfg := config.Config{FilePath: file}
+	db, err := storage.NewShortenerDB(cfg)
+	require.NoError(t, err)
+
+	repo, err := NewShortenerRepository(*db)
+	require.NoError(t, err)
+
+	ctx := context.WithValue(context.Background(), crypto.KeyUserID, "user-1")
+	once := 1
+	require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id1", OriginalURL: "https://a.com", ClicksLeft: &once, PasswordHash: "hash"}))
+
+	errWrong := errors.New("wrong")
+	verify := func(ok bool) func(string) error {
+		return func(hash string) error {
+			assert.Equal(t, "hash", hash)
+			if !ok {
+				return errWrong
+			}
+			return nil
+		}
+	}
+
+	_, err = repo.GetURLByID(ctx, "id1", nil)
+	require.ErrorIs(t, err, constants.ErrPasswordRequired)
+
+	// Хеш пароля должен восстанавливаться после перезапуска
+	require.NoError(t, repo.Close())
+
+	db, err = storage.NewShortenerDB(cfg)
+	require.NoError(t, err)
+
+	repo, err = NewShortenerRepository(*db)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	_, err = repo.UnlockURL(ctx, "id1", verify(false), nil)
+	require.ErrorIs(t, err, errWrong)
+
+	got, err := repo.UnlockURL(ctx, "id1", verify(true), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://a.com", got)
+
+	_, err = repo.UnlockURL(ctx, "id1", verify(true), nil)
+	require.ErrorIs(t, err, constants.ErrNoClicksLeft)
+}
+
+func TestShortenerRepository_DeleteUserURLS_SaveFailed(t *testing.T) {
+	file := createTempStorageFile(t)
+
+	db, err := storage.NewShortenerDB(config.Config{FilePath: file})
+	require.NoError(t, err)
+
+	repo, err := NewShortenerRepository(*db)
+	require.NoError(t, err)
+
+	ctx := context.WithValue(context.Background(), crypto.KeyUserID, "user-1")
+	require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id1", OriginalURL: "https://a.com"}))
+
+	// Запись в закрытое хранилище не удаётся: ссылка должна остаться доступной,
+	// как и в файле
+	require.NoError(t, repo.Close())
+	require.Error(t, repo.DeleteUserURLS(ctx, []model.URLToDelete{{ShortLink: "id1", UserID: "user-1"}}))
+
+	got, err := repo.GetURLByID(ctx, "id1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://a.com", got)
+}
+
+func TestShortenerRepository_UpdateURL(t *testing.T) {
+	file := createTempStorageFile(t)
+
+	cfg := config.Config{FilePath: file}
+	db, err := storage.NewShortenerDB(cfg)
+	require.NoError(t, err)
+
+	repo, err := NewShortenerRepository(*db)
+	require.NoError(t, err)
+
+	ctx := context.WithValue(context.Background(), crypto.KeyUserID, "user-1")
+	require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id1", OriginalURL: "https://a.com"}))
+	require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id2", OriginalURL: "https://b.com"}))
+
+	require.ErrorIs(t, repo.UpdateURL(ctx, "missing", "user-1", "https://c.com", ""), constants.ErrNotFound)
+	require.ErrorIs(t, repo.UpdateURL(ctx, "id1", "user-2", "https://c.com", ""), constants.ErrNotOwner)
+	require.ErrorIs(t, repo.UpdateURL(ctx, "id1", "user-1", "https://b.com", ""), constants.ErrUniqueIndex)
+	require.NoError(t, repo.UpdateURL(ctx, "id1", "user-1", "https://c.com", "https://c.com/"))
+
+	// Новый URL в обоих видах и история должны восстанавливаться после перезапуска
+	require.NoError(t, repo.Close())
+
+	db, err = storage.NewShortenerDB(cfg)
+	require.NoError(t, err)
+
+	repo, err = NewShortenerRepository(*db)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	got, err := repo.GetURLByID(ctx, "id1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://c.com/", got)
+
+	_, ok := repo.GetURLByOriginalURL(ctx, "https://a.com")
+	assert.False(t, ok)
+
+	history, err := repo.GetURLHistory(ctx, "id1", "user-1")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, 1, history[0].Version)
+	assert.Equal(t, "https://a.com", history[0].OriginalURL)
+	assert.False(t, history[0].ChangedAt.IsZero())
+}
+
+func TestShortenerRepository_UndeleteURL(t *testing.T) {
+	file := createTempStorageFile(t)
+
+	cfg := config.Config{FilePath: file}
+	db, err := storage.NewShortenerDB(cfg)
+	require.NoError(t, err)
+
+	repo, err := NewShortenerRepository(*db)
+	require.NoError(t, err)
+
+	ctx := context.WithValue(context.Background(), crypto.KeyUserID, "user-1")
+	require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id1", OriginalURL: "https://a.com"}))
+	require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id2", OriginalURL: "https://b.com"}))
+	require.NoError(t, repo.DeleteUserURLS(ctx, []model.URLToDelete{
+		{ShortLink: "id1", UserID: "user-1"},
+		{ShortLink: "id2", UserID: "user-1"},
+	}))
+
+	hourAgo := time.Now().Add(-time.Hour)
+
+	require.ErrorIs(t, repo.UndeleteURL(ctx, "id1", "user-2", hourAgo), constants.ErrNotOwner)
+	require.ErrorIs(t, repo.UndeleteURL(ctx, "id1", "user-1", time.Now().Add(time.Hour)), constants.ErrRestoreWindowPassed)
+	require.NoError(t, repo.UndeleteURL(ctx, "id1", "user-1", hourAgo))
+
+	// Восстановление и время удаления оставшейся ссылки должны сохраняться после перезапуска
+	require.NoError(t, repo.Close())
+
+	db, err = storage.NewShortenerDB(cfg)
+	require.NoError(t, err)
+
+	repo, err = NewShortenerRepository(*db)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	got, err := repo.GetURLByID(ctx, "id1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://a.com", got)
+
+	trash, err := repo.GetDeletedURLs(ctx, "user-1", hourAgo)
 	require.NoError(t, err)
+	require.Len(t, trash, 1)
+	assert.Equal(t, "id2", trash[0].ShortURL)
+	assert.Equal(t, "https://b.com", trash[0].OriginalURL)
+	require.NotNil(t, trash[0].DeletedAt)
+}
+
+func TestShortenerRepository_PurgeDeletedURLs(t *testing.T) {
+	tests := []struct {
+		name     string
+		reuseIDs bool
+	}{
+		{name: "keep ids", reuseIDs: false},
+		{name: "reuse ids", reuseIDs: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Config{FilePath: createTempStorageFile(t)}
+			db, err := storage.NewShortenerDB(cfg)
+			require.NoError(t, err)
+
+			repo, err := NewShortenerRepository(*db)
+			require.NoError(t, err)
+
+			ctx := context.WithValue(context.Background(), crypto.KeyUserID, "user-1")
+			require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id1", OriginalURL: "https://a.com"}))
+			require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id2", OriginalURL: "https://b.com"}))
+			require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id3", OriginalURL: "https://c.com"}))
+
+			require.NoError(t, repo.DeleteUserURLS(ctx, []model.URLToDelete{
+				{ShortLink: "id1", UserID: "user-1"},
+				{ShortLink: "id2", UserID: "user-1"},
+			}))
+
+			// Срок хранения ещё не истёк
+			purged, err := repo.PurgeDeletedURLs(ctx, time.Now().Add(-time.Hour), 10, tt.reuseIDs)
+			require.NoError(t, err)
+			assert.Zero(t, purged)
+
+			purged, err = repo.PurgeDeletedURLs(ctx, time.Now().Add(time.Second), 1, tt.reuseIDs)
+			require.NoError(t, err)
+			assert.Equal(t, 1, purged)
+
+			purged, err = repo.PurgeDeletedURLs(ctx, time.Now().Add(time.Second), 10, tt.reuseIDs)
+			require.NoError(t, err)
+			assert.Equal(t, 1, purged)
+
+			check := func(repo *ShortenerRepository) {
+				t.Helper()
+
+				_, err = repo.GetURLByID(ctx, "id1", nil)
+				if tt.reuseIDs {
+					require.Error(t, err)
+					assert.NotErrorIs(t, err, constants.ErrIsDeleted)
+				} else {
+					require.ErrorIs(t, err, constants.ErrIsDeleted)
+				}
+
+				_, found := repo.GetURLByOriginalURL(ctx, "https://a.com")
+				assert.False(t, found)
+
+				urls, err := repo.GetURLSByUserID(ctx, "user-1")
+				require.NoError(t, err)
+				assert.Equal(t, map[string]string{"id3": "https://c.com"}, originalURLs(urls))
+			}
+
+			check(repo)
+
+			// Записи об окончательном удалении воспроизводятся после перезапуска
+			require.NoError(t, repo.Close())
+
+			db, err = storage.NewShortenerDB(cfg)
+			require.NoError(t, err)
+
+			repo, err = NewShortenerRepository(*db)
+			require.NoError(t, err)
+			defer repo.Close()
+
+			check(repo)
+
+			// Освобождённый URL можно сократить снова, а ID — только при reuseIDs
+			require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id4", OriginalURL: "https://a.com"}))
+
+			err = repo.SetURL(ctx, model.ShortenURL{ShortURL: "id2", OriginalURL: "https://d.com"})
+			if tt.reuseIDs {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, constants.ErrIDConflict)
+			}
+
+			// UUID не повторяются, даже когда удалённые записи убраны из кэша
+			uuids := make(map[int]string, len(repo.cache))
+			for id, link := range repo.cache {
+				prev, ok := uuids[link.UUID]
+				assert.False(t, ok, "uuid %d of %s is already used by %s", link.UUID, id, prev)
+				uuids[link.UUID] = id
+			}
+		})
+	}
+}
+
+func TestShortenerRepository_OriginalURLIndex(t *testing.T) {
+	file := createTempStorageFile(t)
 
-	// GetURLSByUserID
-	urls, err := repo.GetURLSByUserID(context.Background(), "any")
+	cfg := config.Config{FilePath: file}
+	db, err := storage.NewShortenerDB(cfg)
 	require.NoError(t, err)
-	assert.Nil(t, urls)
+
+	repo, err := NewShortenerRepository(*db)
+	require.NoError(t, err)
+
+	require.NoError(t, repo.SetURL(context.Background(), model.ShortenURL{ShortURL: "id1", OriginalURL: "https://a.com/x"}))
+
+	// Префикс или подстрока не считаются совпадением
+	_, found := repo.GetURLByOriginalURL(context.Background(), "https://a.com")
+	assert.False(t, found)
+
+	err = repo.SetURL(context.Background(), model.ShortenURL{ShortURL: "id2", OriginalURL: "https://a.com/x"})
+	require.ErrorIs(t, err, constants.ErrUniqueIndex)
+
+	err = repo.SetURL(context.Background(), model.ShortenURL{ShortURL: "id1", OriginalURL: "https://b.com"})
+	require.ErrorIs(t, err, constants.ErrIDConflict)
+
+	// Пакетная вставка пропускает конфликтующие записи
+	results, err := repo.InsertURLs(context.Background(), []model.BatchURL{
+		{ID: "id3", OriginalURL: "https://a.com/x"},
+		{ID: "id4", OriginalURL: "https://a.com"},
+		{ID: "id1", OriginalURL: "https://d.com"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []model.BatchURLResult{
+		{ID: "id1", Err: constants.ErrUniqueIndex},
+		{ID: "id4"},
+		{ID: "id1", Err: constants.ErrIDConflict},
+	}, results)
+
+	_, err = repo.GetURLByID(context.Background(), "id3", nil)
+	require.Error(t, err)
+
+	id, found := repo.GetURLByOriginalURL(context.Background(), "https://a.com")
+	assert.True(t, found)
+	assert.Equal(t, "id4", id)
+
+	// Удалённая ссылка продолжает занимать URL, как и в уникальном индексе PostgreSQL
+	ctx := context.WithValue(context.Background(), crypto.KeyUserID, "user-1")
+	require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id5", OriginalURL: "https://c.com"}))
+	require.NoError(t, repo.DeleteUserURLS(ctx, []model.URLToDelete{{ShortLink: "id5", UserID: "user-1"}}))
+
+	err = repo.SetURL(ctx, model.ShortenURL{ShortURL: "id6", OriginalURL: "https://c.com"})
+	require.ErrorIs(t, err, constants.ErrUniqueIndex)
+
+	// Индекс восстанавливается при загрузке
+	require.NoError(t, repo.Close())
+
+	db, err = storage.NewShortenerDB(cfg)
+	require.NoError(t, err)
+
+	repo, err = NewShortenerRepository(*db)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	id, found = repo.GetURLByOriginalURL(context.Background(), "https://a.com/x")
+	assert.True(t, found)
+	assert.Equal(t, "id1", id)
+
+	id, found = repo.GetURLByOriginalURL(context.Background(), "https://c.com")
+	assert.True(t, found)
+	assert.Equal(t, "id5", id)
+}
+
+func TestShortenerRepository_MaxURLLengthLowered(t *testing.T) {
+	file := createTempStorageFile(t)
+	longURL := "https://a.com/" + strings.Repeat("x", 20)
+
+	db, err := storage.NewShortenerDB(config.Config{FilePath: file})
+	require.NoError(t, err)
+
+	repo, err := NewShortenerRepository(*db)
+	require.NoError(t, err)
+
+	clicks := 2
+	require.NoError(t, repo.SetURL(context.Background(), model.ShortenURL{ShortURL: "id1", OriginalURL: longURL, ClicksLeft: &clicks}))
+	require.NoError(t, repo.Close())
+
+	// После уменьшения лимита существующие длинные ссылки продолжают работать,
+	// хотя переход перезаписывает запись целиком
+	db, err = storage.NewShortenerDB(config.Config{FilePath: file, MaxURLLength: 20})
+	require.NoError(t, err)
+
+	repo, err = NewShortenerRepository(*db)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	got, err := repo.GetURLByID(context.Background(), "id1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, longURL, got)
+}
+
+// originalURLs возвращает оригинальные URL ссылок по их коротким ID.
+func originalURLs(items []model.ShortenURL) map[string]string {
+	urls := make(map[string]string, len(items))
+	for _, v := range items {
+		urls[v.ShortURL] = v.OriginalURL
+	}
+
+	return urls
 }
@@ -0,0 +1,627 @@
+// Package memory предоставляет реализацию репозитория сокращённых URL,
+// полностью хранящую данные в памяти процесса без какого-либо файла.
+//
+// Подходит для тестов, временных стендов и бенчмарков: данные теряются при перезапуске.
+package memory
+
+import (
+	"context"
+	"errors"
+	"hash/maphash"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/constants"
+	"github.com/bubaew95/yandex-go-learn/internal/core/model"
+	"github.com/bubaew95/yandex-go-learn/pkg/crypto"
+)
+
+// shardCount — число сегментов каждой карты. Степень двойки, чтобы номер
+// сегмента вычислялся маской.
+const shardCount = 64
+
+// shard — сегмент карты со своей блокировкой.
+type shard[T any] struct {
+	mx    sync.RWMutex
+	items map[string]T
+}
+
+// shardedMap — карта, разбитая на сегменты с независимыми блокировками,
+// чтобы операции над разными ключами не конкурировали за один мьютекс.
+type shardedMap[T any] struct {
+	seed   maphash.Seed
+	shards [shardCount]*shard[T]
+}
+
+func newShardedMap[T any]() *shardedMap[T] {
+	m := &shardedMap[T]{seed: maphash.MakeSeed()}
+	for i := range m.shards {
+		m.shards[i] = &shard[T]{items: make(map[string]T)}
+	}
+
+	return m
+}
+
+func (m *shardedMap[T]) shard(key string) *shard[T] {
+	return m.shards[maphash.String(m.seed, key)&(shardCount-1)]
+}
+
+// ShortenerRepository реализует интерфейс репозитория для работы с сокращёнными URL
+// поверх сегментированных карт в памяти.
+//
+// Помимо записей по короткому ID поддерживаются индекс оригинальный URL -> ID
+// (с той же семантикой, что и уникальный индекс в PostgreSQL, включая удалённые ссылки)
+// и индекс пользователь -> его ссылки.
+type ShortenerRepository struct {
+	links *shardedMap[model.ShortenURL]
+	urls  *shardedMap[string]
+	users *shardedMap[map[string]struct{}]
+	seq   *atomic.Int64
+}
+
+// NewShortenerRepository создаёт пустой репозиторий в памяти.
+func NewShortenerRepository() *ShortenerRepository {
+	return &ShortenerRepository{
+		links: newShardedMap[model.ShortenURL](),
+		urls:  newShardedMap[string](),
+		users: newShardedMap[map[string]struct{}](),
+		seq:   &atomic.Int64{},
+	}
+}
+
+// Close ничего не делает: репозиторий не держит внешних ресурсов.
+func (s ShortenerRepository) Close() error {
+	return nil
+}
+
+// Ping всегда возвращает nil.
+func (s ShortenerRepository) Ping(ctx context.Context) error {
+	return nil
+}
+
+// SetURL сохраняет новую ссылку.
+// Владельцем ссылки становится пользователь из контекста запроса.
+//
+// Если оригинальный URL уже есть в хранилище, возвращает ErrUniqueIndex,
+// а если занят короткий ID — ErrIDConflict.
+func (s ShortenerRepository) SetURL(ctx context.Context, link model.ShortenURL) error {
+	return s.insert(model.ShortenURL{
+		ShortURL:     link.ShortURL,
+		OriginalURL:  link.OriginalURL,
+		SubmittedURL: link.SubmittedURL,
+		UserID:       userIDFromContext(ctx),
+		ExpiresAt:    link.ExpiresAt,
+		ClicksLeft:   link.ClicksLeft,
+		PasswordHash: link.PasswordHash,
+	})
+}
+
+// insert атомарно проверяет уникальность и добавляет запись.
+//
+// Блокировки всегда берутся в порядке: сегмент URL, сегмент ссылки, сегмент пользователя.
+func (s ShortenerRepository) insert(link model.ShortenURL) error {
+	id, url, userID := link.ShortURL, link.OriginalURL, link.UserID
+
+	us := s.urls.shard(url)
+	us.mx.Lock()
+	defer us.mx.Unlock()
+
+	if _, ok := us.items[url]; ok {
+		return constants.ErrUniqueIndex
+	}
+
+	ls := s.links.shard(id)
+	ls.mx.Lock()
+	if _, ok := ls.items[id]; ok {
+		ls.mx.Unlock()
+		return constants.ErrIDConflict
+	}
+
+	link.UUID = int(s.seq.Add(1))
+	ls.items[id] = link
+	ls.mx.Unlock()
+
+	us.items[url] = id
+
+	if userID != "" {
+		s.addUserLink(userID, id)
+	}
+
+	return nil
+}
+
+func (s ShortenerRepository) addUserLink(userID string, id string) {
+	sh := s.users.shard(userID)
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
+
+	ids, ok := sh.items[userID]
+	if !ok {
+		ids = make(map[string]struct{})
+		sh.items[userID] = ids
+	}
+
+	ids[id] = struct{}{}
+}
+
+// GetURLByID возвращает оригинальный URL по его короткому идентификатору.
+// Возвращает ошибку, если соответствие не найдено, ErrIsDeleted, если ссылка
+// помечена как удалённая, и ErrExpired, если истёк срок её жизни.
+//
+// У ссылки с лимитом переходов под блокировкой сегмента списывается один переход;
+// если лимит исчерпан, возвращается ErrNoClicksLeft.
+// Для ссылки с паролем возвращается ErrPasswordRequired.
+func (s ShortenerRepository) GetURLByID(ctx context.Context, id string, check func(url string) error) (string, error) {
+	item, ok := s.get(id)
+	if !ok {
+		return "", errors.New("not found")
+	}
+
+	if err := checkAvailable(item); err != nil {
+		return "", err
+	}
+
+	if item.PasswordHash != "" {
+		return "", constants.ErrPasswordRequired
+	}
+
+	return s.follow(item, check)
+}
+
+// UnlockURL выполняет переход по ссылке после проверки её пароля функцией verify.
+// Для ссылки без пароля verify не вызывается. URL ссылки, как и в GetURLByID,
+// проверяется функцией check до списания перехода.
+func (s ShortenerRepository) UnlockURL(ctx context.Context, id string, verify func(passwordHash string) error, check func(url string) error) (string, error) {
+	item, ok := s.get(id)
+	if !ok {
+		return "", errors.New("not found")
+	}
+
+	if err := checkAvailable(item); err != nil {
+		return "", err
+	}
+
+	if item.PasswordHash != "" {
+		if err := verify(item.PasswordHash); err != nil {
+			return "", err
+		}
+	}
+
+	return s.follow(item, check)
+}
+
+// follow выполняет переход по доступной ссылке: проверяет URL функцией check, если она задана,
+// и только затем у ссылки с лимитом списывает переход.
+func (s ShortenerRepository) follow(item model.ShortenURL, check func(url string) error) (string, error) {
+	url := item.RedirectURL()
+	if check != nil {
+		if err := check(url); err != nil {
+			return "", err
+		}
+	}
+
+	if item.ClicksLeft == nil {
+		return url, nil
+	}
+
+	return s.consumeClick(item.ShortURL)
+}
+
+// checkAvailable проверяет, что по ссылке можно перейти.
+func checkAvailable(item model.ShortenURL) error {
+	if item.IsDeleted {
+		return constants.ErrIsDeleted
+	}
+
+	if item.Expired(time.Now()) {
+		return constants.ErrExpired
+	}
+
+	if item.ClicksLeft != nil && *item.ClicksLeft <= 0 {
+		return constants.ErrNoClicksLeft
+	}
+
+	return nil
+}
+
+// consumeClick списывает один переход по ссылке с лимитом.
+// Состояние ссылки перепроверяется под блокировкой на запись; счётчик
+// заменяется новым значением, а не изменяется по указателю, поэтому
+// ранее выданные копии записи не меняются.
+func (s ShortenerRepository) consumeClick(id string) (string, error) {
+	sh := s.links.shard(id)
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
+
+	item := sh.items[id]
+	if err := checkAvailable(item); err != nil {
+		return "", err
+	}
+
+	clicks := *item.ClicksLeft - 1
+	item.ClicksLeft = &clicks
+	sh.items[id] = item
+
+	return item.RedirectURL(), nil
+}
+
+func (s ShortenerRepository) get(id string) (model.ShortenURL, bool) {
+	sh := s.links.shard(id)
+	sh.mx.RLock()
+	defer sh.mx.RUnlock()
+
+	item, ok := sh.items[id]
+	return item, ok
+}
+
+// GetURLByOriginalURL возвращает короткий ID по точному совпадению оригинального URL.
+func (s ShortenerRepository) GetURLByOriginalURL(ctx context.Context, originalURL string) (string, bool) {
+	sh := s.urls.shard(originalURL)
+	sh.mx.RLock()
+	defer sh.mx.RUnlock()
+
+	id, ok := sh.items[originalURL]
+	return id, ok
+}
+
+// InsertURLs добавляет список URL в хранилище и возвращает результат для каждой записи.
+// Записи с уже сокращённым URL или занятым ID пропускаются.
+func (s ShortenerRepository) InsertURLs(ctx context.Context, urls []model.BatchURL) ([]model.BatchURLResult, error) {
+	results := make([]model.BatchURLResult, len(urls))
+
+	userID := userIDFromContext(ctx)
+	for i, v := range urls {
+		results[i].ID = v.ID
+
+		err := s.insert(model.ShortenURL{
+			ShortURL:     v.ID,
+			OriginalURL:  v.OriginalURL,
+			SubmittedURL: v.SubmittedURL,
+			UserID:       userID,
+			ExpiresAt:    v.ExpiresAt,
+			ClicksLeft:   v.ClicksLeft,
+			PasswordHash: v.PasswordHash,
+		})
+		if errors.Is(err, constants.ErrUniqueIndex) {
+			if id, ok := s.GetURLByOriginalURL(ctx, v.OriginalURL); ok {
+				results[i].ID = id
+			}
+			results[i].Err = err
+			continue
+		}
+
+		if errors.Is(err, constants.ErrIDConflict) {
+			results[i].Err = err
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+// GetURLSByUserID возвращает все ссылки пользователя, в том числе удалённые,
+// кроме окончательно удалённых.
+func (s ShortenerRepository) GetURLSByUserID(ctx context.Context, userID string) ([]model.ShortenURL, error) {
+	sh := s.users.shard(userID)
+	sh.mx.RLock()
+	ids := make([]string, 0, len(sh.items[userID]))
+	for id := range sh.items[userID] {
+		ids = append(ids, id)
+	}
+	sh.mx.RUnlock()
+
+	items := make([]model.ShortenURL, 0, len(ids))
+	for _, id := range ids {
+		if item, ok := s.get(id); ok && !item.Purged {
+			items = append(items, item)
+		}
+	}
+
+	return items, nil
+}
+
+// DeleteUserURLS помечает ссылки пользователя как удалённые.
+// Ссылки, принадлежащие другим пользователям, не затрагиваются.
+func (s ShortenerRepository) DeleteUserURLS(ctx context.Context, items []model.URLToDelete) error {
+	for _, item := range items {
+		sh := s.links.shard(item.ShortLink)
+
+		sh.mx.Lock()
+		current, ok := sh.items[item.ShortLink]
+		if ok && current.UserID == item.UserID && !current.IsDeleted {
+			now := time.Now().UTC()
+			current.IsDeleted = true
+			current.DeletedAt = &now
+			sh.items[item.ShortLink] = current
+		}
+		sh.mx.Unlock()
+	}
+
+	return nil
+}
+
+// UpdateURL заменяет оригинальный URL ссылки пользователя и дописывает прежний URL для перехода в её историю.
+//
+// Новый URL резервируется в индексе под блокировкой его сегмента, затем под блокировкой
+// сегмента ссылки запись перепроверяется и заменяется целиком; прежний URL освобождается
+// последним. Если ссылку успели изменить параллельно, замена повторяется.
+func (s ShortenerRepository) UpdateURL(ctx context.Context, id string, userID string, url string, submittedURL string) error {
+	for {
+		item, ok := s.get(id)
+		if !ok {
+			return constants.ErrNotFound
+		}
+
+		if err := checkOwner(item, userID); err != nil {
+			return err
+		}
+
+		if item.OriginalURL == url && item.SubmittedURL == submittedURL {
+			return nil
+		}
+
+		updated, err := s.replaceURL(id, userID, item, url, submittedURL)
+		if err != nil {
+			return err
+		}
+
+		if updated {
+			if item.OriginalURL != url {
+				s.removeURL(item.OriginalURL, id)
+			}
+
+			return nil
+		}
+	}
+}
+
+// replaceURL заменяет URL ссылки id с URL из prev на url и submittedURL. Возвращает false, если URL ссылки
+// уже не совпадают с prev. Блокировки берутся в том же порядке, что и в insert.
+func (s ShortenerRepository) replaceURL(id string, userID string, prev model.ShortenURL, url string, submittedURL string) (bool, error) {
+	us := s.urls.shard(url)
+	us.mx.Lock()
+	defer us.mx.Unlock()
+
+	if owner, ok := us.items[url]; ok && owner != id {
+		return false, constants.ErrUniqueIndex
+	}
+
+	ls := s.links.shard(id)
+	ls.mx.Lock()
+	defer ls.mx.Unlock()
+
+	item, ok := ls.items[id]
+	if !ok {
+		return false, constants.ErrNotFound
+	}
+
+	if err := checkOwner(item, userID); err != nil {
+		return false, err
+	}
+
+	if item.OriginalURL != prev.OriginalURL || item.SubmittedURL != prev.SubmittedURL {
+		return false, nil
+	}
+
+	// История заменяется новым срезом: ранее выданные копии записи не меняются
+	item.History = append(slices.Clip(item.History), model.URLEdit{
+		Version:     len(item.History) + 1,
+		OriginalURL: item.RedirectURL(),
+		ChangedAt:   time.Now().UTC(),
+	})
+	item.OriginalURL = url
+	item.SubmittedURL = submittedURL
+	ls.items[id] = item
+
+	us.items[url] = id
+
+	return true, nil
+}
+
+// GetURLHistory возвращает прежние оригинальные URL ссылки пользователя.
+func (s ShortenerRepository) GetURLHistory(ctx context.Context, id string, userID string) ([]model.URLEdit, error) {
+	item, ok := s.get(id)
+	if !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	if err := checkOwner(item, userID); err != nil {
+		return nil, err
+	}
+
+	return slices.Clone(item.History), nil
+}
+
+// checkOwner проверяет, что ссылку может изменять пользователь userID.
+func checkOwner(item model.ShortenURL, userID string) error {
+	if item.UserID != userID {
+		return constants.ErrNotOwner
+	}
+
+	if item.IsDeleted {
+		return constants.ErrIsDeleted
+	}
+
+	return nil
+}
+
+// GetDeletedURLs возвращает удалённые ссылки пользователя, которые ещё можно восстановить.
+func (s ShortenerRepository) GetDeletedURLs(ctx context.Context, userID string, deletedAfter time.Time) ([]model.ShortenURL, error) {
+	items, err := s.GetURLSByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []model.ShortenURL
+	for _, item := range items {
+		if item.IsDeleted && checkUndelete(item, userID, deletedAfter) == nil {
+			deleted = append(deleted, item)
+		}
+	}
+
+	return deleted, nil
+}
+
+// UndeleteURL снимает пометку удаления со ссылки пользователя под блокировкой её сегмента.
+// Оригинальный URL удалённой ссылки остаётся в индексе, поэтому восстановление
+// не может нарушить уникальность.
+func (s ShortenerRepository) UndeleteURL(ctx context.Context, id string, userID string, deletedAfter time.Time) error {
+	sh := s.links.shard(id)
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
+
+	item, ok := sh.items[id]
+	if !ok {
+		return constants.ErrNotFound
+	}
+
+	if item.UserID == userID && !item.IsDeleted {
+		return nil
+	}
+
+	if err := checkUndelete(item, userID, deletedAfter); err != nil {
+		return err
+	}
+
+	item.IsDeleted = false
+	item.DeletedAt = nil
+	sh.items[id] = item
+
+	return nil
+}
+
+// checkUndelete проверяет, что пользователь userID может восстановить удалённую ссылку:
+// она удалена не раньше deletedAfter, ещё не очищена и срок её жизни не истёк.
+func checkUndelete(item model.ShortenURL, userID string, deletedAfter time.Time) error {
+	if item.UserID != userID {
+		return constants.ErrNotOwner
+	}
+
+	if item.Purged || item.DeletedAt == nil || item.DeletedAt.Before(deletedAfter) {
+		return constants.ErrRestoreWindowPassed
+	}
+
+	if item.Expired(time.Now()) {
+		return constants.ErrExpired
+	}
+
+	return nil
+}
+
+// ExpireURLs помечает удалёнными не более limit ссылок, срок жизни которых истёк
+// к expiredBefore. Временем удаления становится время истечения.
+func (s ShortenerRepository) ExpireURLs(ctx context.Context, expiredBefore time.Time, limit int) (int, error) {
+	expired := 0
+
+	for _, sh := range s.links.shards {
+		if expired >= limit {
+			break
+		}
+
+		if err := ctx.Err(); err != nil {
+			return expired, err
+		}
+
+		sh.mx.Lock()
+		for id, item := range sh.items {
+			if expired >= limit {
+				break
+			}
+
+			if item.IsDeleted || !item.Expired(expiredBefore) {
+				continue
+			}
+
+			item.IsDeleted = true
+			item.DeletedAt = item.ExpiresAt
+			sh.items[id] = item
+			expired++
+		}
+		sh.mx.Unlock()
+	}
+
+	return expired, nil
+}
+
+// PurgeDeletedURLs окончательно удаляет не более limit ссылок, помеченных
+// удалёнными раньше deletedBefore, и освобождает их оригинальные URL.
+//
+// При reuseIDs запись удаляется целиком и ID может быть выдан снова,
+// иначе запись остаётся без URL, чтобы ID не достался другой ссылке.
+func (s ShortenerRepository) PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time, limit int, reuseIDs bool) (int, error) {
+	var purged []model.ShortenURL
+
+	for _, sh := range s.links.shards {
+		if len(purged) >= limit {
+			break
+		}
+
+		if err := ctx.Err(); err != nil {
+			return len(purged), err
+		}
+
+		sh.mx.Lock()
+		for id, item := range sh.items {
+			if len(purged) >= limit {
+				break
+			}
+
+			if !item.IsDeleted || item.Purged || item.DeletedAt == nil || !item.DeletedAt.Before(deletedBefore) {
+				continue
+			}
+
+			purged = append(purged, item)
+			if reuseIDs {
+				delete(sh.items, id)
+				continue
+			}
+
+			item.OriginalURL = ""
+			item.Purged = true
+			sh.items[id] = item
+		}
+		sh.mx.Unlock()
+	}
+
+	for _, item := range purged {
+		s.removeURL(item.OriginalURL, item.ShortURL)
+		if reuseIDs && item.UserID != "" {
+			s.removeUserLink(item.UserID, item.ShortURL)
+		}
+	}
+
+	return len(purged), nil
+}
+
+// removeURL освобождает оригинальный URL, если он всё ещё принадлежит ссылке id.
+func (s ShortenerRepository) removeURL(url string, id string) {
+	sh := s.urls.shard(url)
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
+
+	if sh.items[url] == id {
+		delete(sh.items, url)
+	}
+}
+
+func (s ShortenerRepository) removeUserLink(userID string, id string) {
+	sh := s.users.shard(userID)
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
+
+	delete(sh.items[userID], id)
+	if len(sh.items[userID]) == 0 {
+		delete(sh.items, userID)
+	}
+}
+
+func userIDFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(crypto.KeyUserID).(string)
+	return userID
+}
@@ -0,0 +1,398 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/constants"
+	"github.com/bubaew95/yandex-go-learn/internal/core/model"
+	"github.com/bubaew95/yandex-go-learn/pkg/crypto"
+)
+
+func TestShortenerRepository_SetAndGet(t *testing.T) {
+	repo := NewShortenerRepository()
+
+	err := repo.SetURL(context.Background(), model.ShortenURL{ShortURL: "abc123", OriginalURL: "https://example.com"})
+	require.NoError(t, err)
+
+	got, err := repo.GetURLByID(context.Background(), "abc123", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", got)
+
+	id, found := repo.GetURLByOriginalURL(context.Background(), "https://example.com")
+	assert.True(t, found)
+	assert.Equal(t, "abc123", id)
+
+	_, found = repo.GetURLByOriginalURL(context.Background(), "example.com")
+	assert.False(t, found)
+
+	_, err = repo.GetURLByID(context.Background(), "missing", nil)
+	require.Error(t, err)
+
+	require.NoError(t, repo.Ping(context.Background()))
+	require.NoError(t, repo.Close())
+}
+
+func TestShortenerRepository_Uniqueness(t *testing.T) {
+	repo := NewShortenerRepository()
+
+	require.NoError(t, repo.SetURL(context.Background(), model.ShortenURL{ShortURL: "id1", OriginalURL: "https://a.com"}))
+
+	err := repo.SetURL(context.Background(), model.ShortenURL{ShortURL: "id2", OriginalURL: "https://a.com"})
+	require.ErrorIs(t, err, constants.ErrUniqueIndex)
+
+	err = repo.SetURL(context.Background(), model.ShortenURL{ShortURL: "id1", OriginalURL: "https://b.com"})
+	require.ErrorIs(t, err, constants.ErrIDConflict)
+
+	// URL из отклонённой записи не должен попасть в индекс
+	_, found := repo.GetURLByOriginalURL(context.Background(), "https://b.com")
+	assert.False(t, found)
+
+	results, err := repo.InsertURLs(context.Background(), []model.BatchURL{
+		{ID: "id3", OriginalURL: "https://a.com"},
+		{ID: "id4", OriginalURL: "https://c.com"},
+		{ID: "id1", OriginalURL: "https://d.com"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []model.BatchURLResult{
+		{ID: "id1", Err: constants.ErrUniqueIndex},
+		{ID: "id4"},
+		{ID: "id1", Err: constants.ErrIDConflict},
+	}, results)
+
+	_, err = repo.GetURLByID(context.Background(), "id3", nil)
+	require.Error(t, err)
+
+	got, err := repo.GetURLByID(context.Background(), "id4", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://c.com", got)
+}
+
+func TestShortenerRepository_UserURLs(t *testing.T) {
+	repo := NewShortenerRepository()
+
+	ctxUser1 := context.WithValue(context.Background(), crypto.KeyUserID, "user-1")
+	ctxUser2 := context.WithValue(context.Background(), crypto.KeyUserID, "user-2")
+
+	require.NoError(t, repo.SetURL(ctxUser1, model.ShortenURL{ShortURL: "id1", OriginalURL: "https://a.com"}))
+	require.NoError(t, repo.SetURL(ctxUser1, model.ShortenURL{ShortURL: "id2", OriginalURL: "https://b.com"}))
+	require.NoError(t, repo.SetURL(ctxUser2, model.ShortenURL{ShortURL: "id3", OriginalURL: "https://c.com"}))
+
+	urls, err := repo.GetURLSByUserID(context.Background(), "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"id1": "https://a.com", "id2": "https://b.com"}, originalURLs(urls))
+
+	err = repo.DeleteUserURLS(context.Background(), []model.URLToDelete{
+		{ShortLink: "id1", UserID: "user-1"},
+		{ShortLink: "id3", UserID: "user-1"}, // чужая ссылка
+	})
+	require.NoError(t, err)
+
+	_, err = repo.GetURLByID(context.Background(), "id1", nil)
+	require.ErrorIs(t, err, constants.ErrIsDeleted)
+
+	got, err := repo.GetURLByID(context.Background(), "id3", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://c.com", got)
+
+	// Удалённая ссылка продолжает занимать URL
+	err = repo.SetURL(ctxUser2, model.ShortenURL{ShortURL: "id4", OriginalURL: "https://a.com"})
+	require.ErrorIs(t, err, constants.ErrUniqueIndex)
+}
+
+func TestShortenerRepository_PurgeDeletedURLs(t *testing.T) {
+	for _, reuseIDs := range []bool{false, true} {
+		t.Run(fmt.Sprintf("reuse=%v", reuseIDs), func(t *testing.T) {
+			repo := NewShortenerRepository()
+
+			ctx := context.WithValue(context.Background(), crypto.KeyUserID, "user-1")
+			require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id1", OriginalURL: "https://a.com"}))
+			require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id2", OriginalURL: "https://b.com"}))
+			require.NoError(t, repo.DeleteUserURLS(ctx, []model.URLToDelete{{ShortLink: "id1", UserID: "user-1"}}))
+
+			purged, err := repo.PurgeDeletedURLs(ctx, time.Now().Add(-time.Hour), 10, reuseIDs)
+			require.NoError(t, err)
+			assert.Zero(t, purged)
+
+			purged, err = repo.PurgeDeletedURLs(ctx, time.Now().Add(time.Second), 10, reuseIDs)
+			require.NoError(t, err)
+			assert.Equal(t, 1, purged)
+
+			// Повторный запуск не находит уже удалённых ссылок
+			purged, err = repo.PurgeDeletedURLs(ctx, time.Now().Add(time.Second), 10, reuseIDs)
+			require.NoError(t, err)
+			assert.Zero(t, purged)
+
+			urls, err := repo.GetURLSByUserID(ctx, "user-1")
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{"id2": "https://b.com"}, originalURLs(urls))
+
+			require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id3", OriginalURL: "https://a.com"}))
+
+			err = repo.SetURL(ctx, model.ShortenURL{ShortURL: "id1", OriginalURL: "https://c.com"})
+			if reuseIDs {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, constants.ErrIDConflict)
+			}
+		})
+	}
+}
+
+func TestShortenerRepository_ExpireURLs(t *testing.T) {
+	repo := NewShortenerRepository()
+	ctx := context.Background()
+
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id1", OriginalURL: "https://a.com", ExpiresAt: &past}))
+	require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id2", OriginalURL: "https://b.com", ExpiresAt: &future}))
+	require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id3", OriginalURL: "https://c.com"}))
+
+	// Истёкшая ссылка не открывается ещё до фоновой пометки
+	_, err := repo.GetURLByID(ctx, "id1", nil)
+	require.ErrorIs(t, err, constants.ErrExpired)
+
+	expired, err := repo.ExpireURLs(ctx, time.Now(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, expired)
+
+	_, err = repo.GetURLByID(ctx, "id1", nil)
+	require.ErrorIs(t, err, constants.ErrIsDeleted)
+
+	for _, id := range []string{"id2", "id3"} {
+		_, err = repo.GetURLByID(ctx, id, nil)
+		require.NoError(t, err)
+	}
+
+	// Временем удаления считается время истечения, поэтому ссылку можно удалить окончательно
+	purged, err := repo.PurgeDeletedURLs(ctx, time.Now(), 10, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+}
+
+func TestShortenerRepository_ClickLimit(t *testing.T) {
+	repo := NewShortenerRepository()
+	ctx := context.WithValue(context.Background(), crypto.KeyUserID, "user-1")
+
+	clicks := 5
+	require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id1", OriginalURL: "https://a.com", ClicksLeft: &clicks}))
+
+	// Параллельные переходы не должны списать больше лимита
+	var (
+		wg        sync.WaitGroup
+		succeeded atomic.Int32
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := repo.GetURLByID(ctx, "id1", nil)
+			if err == nil {
+				succeeded.Add(1)
+				return
+			}
+			assert.ErrorIs(t, err, constants.ErrNoClicksLeft)
+		}()
+	}
+	wg.Wait()
+
+	assert.EqualValues(t, 5, succeeded.Load())
+	assert.Equal(t, 5, clicks)
+
+	urls, err := repo.GetURLSByUserID(ctx, "user-1")
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	require.NotNil(t, urls[0].ClicksLeft)
+	assert.Zero(t, *urls[0].ClicksLeft)
+}
+
+func TestShortenerRepository_UnlockURL(t *testing.T) {
+	repo := NewShortenerRepository()
+	ctx := context.WithValue(context.Background(), crypto.KeyUserID, "user-1")
+
+	require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id1", OriginalURL: "https://a.com", PasswordHash: "hash"}))
+	require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id2", OriginalURL: "https://b.com"}))
+
+	_, err := repo.GetURLByID(ctx, "id1", nil)
+	require.ErrorIs(t, err, constants.ErrPasswordRequired)
+
+	errWrong := errors.New("wrong")
+	_, err = repo.UnlockURL(ctx, "id1", func(hash string) error {
+		assert.Equal(t, "hash", hash)
+		return errWrong
+	}, nil)
+	require.ErrorIs(t, err, errWrong)
+
+	got, err := repo.UnlockURL(ctx, "id1", func(string) error { return nil }, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://a.com", got)
+
+	// У ссылки без пароля verify не вызывается
+	got, err = repo.UnlockURL(ctx, "id2", func(string) error { return errWrong }, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://b.com", got)
+}
+
+func TestShortenerRepository_UpdateURL(t *testing.T) {
+	repo := NewShortenerRepository()
+	ctx := context.WithValue(context.Background(), crypto.KeyUserID, "user-1")
+
+	require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id1", OriginalURL: "https://a.com"}))
+	require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id2", OriginalURL: "https://b.com"}))
+
+	require.ErrorIs(t, repo.UpdateURL(ctx, "missing", "user-1", "https://c.com", ""), constants.ErrNotFound)
+	require.ErrorIs(t, repo.UpdateURL(ctx, "id1", "user-2", "https://c.com", ""), constants.ErrNotOwner)
+	require.ErrorIs(t, repo.UpdateURL(ctx, "id1", "user-1", "https://b.com", ""), constants.ErrUniqueIndex)
+
+	require.NoError(t, repo.UpdateURL(ctx, "id1", "user-1", "https://c.com", ""))
+	require.NoError(t, repo.UpdateURL(ctx, "id1", "user-1", "https://c.com", ""))
+
+	got, err := repo.GetURLByID(ctx, "id1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://c.com", got)
+
+	// Прежний URL освобождается, новый занят ссылкой
+	_, ok := repo.GetURLByOriginalURL(ctx, "https://a.com")
+	assert.False(t, ok)
+	id, ok := repo.GetURLByOriginalURL(ctx, "https://c.com")
+	assert.True(t, ok)
+	assert.Equal(t, "id1", id)
+
+	require.NoError(t, repo.UpdateURL(ctx, "id1", "user-1", "https://a.com", ""))
+
+	history, err := repo.GetURLHistory(ctx, "id1", "user-1")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, 1, history[0].Version)
+	assert.Equal(t, "https://a.com", history[0].OriginalURL)
+	assert.Equal(t, 2, history[1].Version)
+	assert.Equal(t, "https://c.com", history[1].OriginalURL)
+
+	// Тот же канонический URL в другом виде: переход идёт на новый вид, индекс не освобождается
+	require.NoError(t, repo.UpdateURL(ctx, "id1", "user-1", "https://a.com", "https://a.com/"))
+
+	got, err = repo.GetURLByID(ctx, "id1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://a.com/", got)
+
+	id, ok = repo.GetURLByOriginalURL(ctx, "https://a.com")
+	assert.True(t, ok)
+	assert.Equal(t, "id1", id)
+
+	_, err = repo.GetURLHistory(ctx, "id1", "user-2")
+	require.ErrorIs(t, err, constants.ErrNotOwner)
+
+	require.NoError(t, repo.DeleteUserURLS(ctx, []model.URLToDelete{{ShortLink: "id2", UserID: "user-1"}}))
+	require.ErrorIs(t, repo.UpdateURL(ctx, "id2", "user-1", "https://d.com", ""), constants.ErrIsDeleted)
+}
+
+func TestShortenerRepository_UndeleteURL(t *testing.T) {
+	repo := NewShortenerRepository()
+	ctx := context.WithValue(context.Background(), crypto.KeyUserID, "user-1")
+
+	require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id1", OriginalURL: "https://a.com"}))
+	require.NoError(t, repo.SetURL(ctx, model.ShortenURL{ShortURL: "id2", OriginalURL: "https://b.com"}))
+	require.NoError(t, repo.DeleteUserURLS(ctx, []model.URLToDelete{
+		{ShortLink: "id1", UserID: "user-1"},
+		{ShortLink: "id2", UserID: "user-1"},
+	}))
+
+	hourAgo := time.Now().Add(-time.Hour)
+
+	trash, err := repo.GetDeletedURLs(ctx, "user-1", hourAgo)
+	require.NoError(t, err)
+	assert.Len(t, trash, 2)
+
+	trash, err = repo.GetDeletedURLs(ctx, "user-2", hourAgo)
+	require.NoError(t, err)
+	assert.Empty(t, trash)
+
+	require.ErrorIs(t, repo.UndeleteURL(ctx, "missing", "user-1", hourAgo), constants.ErrNotFound)
+	require.ErrorIs(t, repo.UndeleteURL(ctx, "id1", "user-2", hourAgo), constants.ErrNotOwner)
+	require.ErrorIs(t, repo.UndeleteURL(ctx, "id1", "user-1", time.Now().Add(time.Hour)), constants.ErrRestoreWindowPassed)
+
+	require.NoError(t, repo.UndeleteURL(ctx, "id1", "user-1", hourAgo))
+	require.NoError(t, repo.UndeleteURL(ctx, "id1", "user-1", hourAgo))
+
+	got, err := repo.GetURLByID(ctx, "id1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://a.com", got)
+
+	trash, err = repo.GetDeletedURLs(ctx, "user-1", hourAgo)
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+	assert.Equal(t, "id2", trash[0].ShortURL)
+
+	// Окончательно удалённую ссылку восстановить нельзя
+	_, err = repo.PurgeDeletedURLs(ctx, time.Now().Add(time.Minute), 10, false)
+	require.NoError(t, err)
+	require.ErrorIs(t, repo.UndeleteURL(ctx, "id2", "user-1", hourAgo), constants.ErrRestoreWindowPassed)
+}
+
+func TestShortenerRepository_ConcurrentSetURL(t *testing.T) {
+	repo := NewShortenerRepository()
+
+	const workers = 16
+
+	var (
+		wg       sync.WaitGroup
+		mx       sync.Mutex
+		accepted int
+	)
+
+	// Все горутины пытаются сохранить один и тот же URL: успешной должна быть ровно одна.
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			err := repo.SetURL(context.Background(), model.ShortenURL{ShortURL: fmt.Sprintf("id%d", i), OriginalURL: "https://same.com"})
+			if err == nil {
+				mx.Lock()
+				accepted++
+				mx.Unlock()
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	assert.Equal(t, 1, accepted)
+}
+
+func BenchmarkShortenerRepository_GetURLByID(b *testing.B) {
+	repo := NewShortenerRepository()
+
+	const links = 10000
+	for i := 0; i < links; i++ {
+		_ = repo.SetURL(context.Background(), model.ShortenURL{ShortURL: fmt.Sprintf("id%d", i), OriginalURL: fmt.Sprintf("https://site.com/%d", i)})
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			_, _ = repo.GetURLByID(context.Background(), fmt.Sprintf("id%d", i%links), nil)
+			i++
+		}
+	})
+}
+
+// originalURLs возвращает оригинальные URL ссылок по их коротким ID.
+func originalURLs(items []model.ShortenURL) map[string]string {
+	urls := make(map[string]string, len(items))
+	for _, v := range items {
+		urls[v.ShortURL] = v.OriginalURL
+	}
+
+	return urls
+}
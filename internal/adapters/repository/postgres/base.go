@@ -1,13 +1,266 @@
 package postgres
 
-import "database/sql"
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
-func dbConnect(connStr string) (*sql.DB, error) {
-	db, err := sql.Open("pgx", connStr)
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 
+	"github.com/bubaew95/yandex-go-learn/config"
+)
+
+// pgxPool — минимальный набор операций пула, которым пользуется репозиторий.
+// Вынесен в интерфейс, чтобы в тестах пул можно было заменить на pgxmock.
+type pgxPool interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Ping(ctx context.Context) error
+	Close()
+}
+
+// PoolStats — снимок состояния пула соединений для мониторинга.
+type PoolStats struct {
+	MaxConns             int32         `json:"max_conns"`
+	TotalConns           int32         `json:"total_conns"`
+	IdleConns            int32         `json:"idle_conns"`
+	AcquiredConns        int32         `json:"acquired_conns"`
+	ConstructingConns    int32         `json:"constructing_conns"`
+	AcquireCount         int64         `json:"acquire_count"`
+	EmptyAcquireCount    int64         `json:"empty_acquire_count"`
+	CanceledAcquireCount int64         `json:"canceled_acquire_count"`
+	AcquireTimeouts      int64         `json:"acquire_timeouts"`
+	AcquireDuration      time.Duration `json:"acquire_duration"`
+}
+
+// Pool — пул соединений pgx, ограничивающий время ожидания свободного соединения.
+//
+// Ожидание соединения ограничено acquireTimeout независимо от дедлайна запроса,
+// а сам запрос выполняется с исходным контекстом.
+type Pool struct {
+	pool            *pgxpool.Pool
+	acquireTimeout  time.Duration
+	acquireTimeouts atomic.Int64
+}
+
+// NewPool создаёт пул соединений с PostgreSQL по параметрам конфигурации
+// и проверяет доступность базы данных.
+func NewPool(ctx context.Context, cfg config.Config) (*Pool, error) {
+	p, err := openPool(ctx, cfg, cfg.DataBaseDSN)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = p.Ping(ctx); err != nil {
+		p.Close()
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// openPool создаёт пул для строки подключения dsn с лимитами из конфигурации.
+// Соединения открываются лениво, поэтому доступность базы не проверяется.
+func openPool(ctx context.Context, cfg config.Config, dsn string) (*Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.DBMaxConns > 0 {
+		poolConfig.MaxConns = cfg.DBMaxConns
+	}
+
+	if cfg.DBMinConns > 0 {
+		poolConfig.MinConns = min(cfg.DBMinConns, poolConfig.MaxConns)
+	}
+
+	if cfg.DBMaxConnLifetime.Duration > 0 {
+		poolConfig.MaxConnLifetime = cfg.DBMaxConnLifetime.Duration
+	}
+
+	if cfg.DBStatementTimeout.Duration > 0 {
+		poolConfig.ConnConfig.RuntimeParams["statement_timeout"] =
+			strconv.FormatInt(cfg.DBStatementTimeout.Milliseconds(), 10)
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pool{
+		pool:           pool,
+		acquireTimeout: cfg.DBAcquireTimeout.Duration,
+	}, nil
+}
+
+// acquire берёт соединение из пула, ожидая не дольше acquireTimeout.
+func (p *Pool) acquire(ctx context.Context) (*pgxpool.Conn, error) {
+	if p.acquireTimeout <= 0 {
+		return p.pool.Acquire(ctx)
+	}
+
+	acquireCtx, cancel := context.WithTimeout(ctx, p.acquireTimeout)
+	defer cancel()
+
+	conn, err := p.pool.Acquire(acquireCtx)
+	if err != nil && errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		p.acquireTimeouts.Add(1)
+	}
+
+	return conn, err
+}
+
+// Exec выполняет запрос, не возвращающий строк.
+func (p *Pool) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	defer conn.Release()
+
+	return conn.Exec(ctx, sql, args...)
+}
+
+// Query выполняет запрос. Соединение возвращается в пул при закрытии строк.
+func (p *Pool) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query(ctx, sql, args...)
 	if err != nil {
+		conn.Release()
 		return nil, err
 	}
 
-	return db, nil
+	return &poolRows{Rows: rows, conn: conn}, nil
+}
+
+// QueryRow выполняет запрос, возвращающий не более одной строки.
+// Соединение возвращается в пул после Scan.
+func (p *Pool) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return errRow{err: err}
+	}
+
+	return &poolRow{row: conn.QueryRow(ctx, sql, args...), conn: conn}
+}
+
+// Begin начинает транзакцию. Соединение возвращается в пул после Commit или Rollback.
+func (p *Pool) Begin(ctx context.Context) (pgx.Tx, error) {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		conn.Release()
+		return nil, err
+	}
+
+	return &poolTx{Tx: tx, conn: conn}, nil
+}
+
+// Ping проверяет доступность базы данных.
+func (p *Pool) Ping(ctx context.Context) error {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	return conn.Ping(ctx)
+}
+
+// Close закрывает все соединения пула.
+func (p *Pool) Close() {
+	p.pool.Close()
+}
+
+// Stats возвращает текущее состояние пула.
+func (p *Pool) Stats() PoolStats {
+	stat := p.pool.Stat()
+
+	return PoolStats{
+		MaxConns:             stat.MaxConns(),
+		TotalConns:           stat.TotalConns(),
+		IdleConns:            stat.IdleConns(),
+		AcquiredConns:        stat.AcquiredConns(),
+		ConstructingConns:    stat.ConstructingConns(),
+		AcquireCount:         stat.AcquireCount(),
+		EmptyAcquireCount:    stat.EmptyAcquireCount(),
+		CanceledAcquireCount: stat.CanceledAcquireCount(),
+		AcquireTimeouts:      p.acquireTimeouts.Load(),
+		AcquireDuration:      stat.AcquireDuration(),
+	}
+}
+
+// poolRows возвращает соединение в пул, когда строки закрыты или прочитаны до конца.
+type poolRows struct {
+	pgx.Rows
+	conn *pgxpool.Conn
+	once sync.Once
+}
+
+func (r *poolRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+
+	r.Close()
+	return false
+}
+
+func (r *poolRows) Close() {
+	r.Rows.Close()
+	r.once.Do(r.conn.Release)
+}
+
+type poolRow struct {
+	row  pgx.Row
+	conn *pgxpool.Conn
+}
+
+func (r *poolRow) Scan(dest ...any) error {
+	defer r.conn.Release()
+	return r.row.Scan(dest...)
+}
+
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(...any) error {
+	return r.err
+}
+
+// poolTx возвращает соединение в пул по завершении транзакции.
+type poolTx struct {
+	pgx.Tx
+	conn *pgxpool.Conn
+	once sync.Once
+}
+
+func (t *poolTx) Commit(ctx context.Context) error {
+	err := t.Tx.Commit(ctx)
+	t.once.Do(t.conn.Release)
+	return err
+}
+
+func (t *poolTx) Rollback(ctx context.Context) error {
+	err := t.Tx.Rollback(ctx)
+	t.once.Do(t.conn.Release)
+	return err
 }
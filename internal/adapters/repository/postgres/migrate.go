@@ -0,0 +1,326 @@
+package postgres
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey — ключ advisory-блокировки, под которой выполняются миграции,
+// чтобы несколько экземпляров сервиса не применяли их одновременно.
+const migrationLockKey int64 = 7_202_604_180
+
+// ErrSchemaTooNew возвращается, если схема базы данных новее, чем поддерживает текущая сборка.
+var ErrSchemaTooNew = errors.New("database schema is newer than supported")
+
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus описывает состояние одной миграции.
+type MigrationStatus struct {
+	// Version — порядковый номер миграции.
+	Version int
+
+	// Name — имя миграции (часть имени файла после номера).
+	Name string
+
+	// AppliedAt — время применения; nil, если миграция ещё не применена.
+	AppliedAt *time.Time
+}
+
+// Migrator применяет и откатывает версионированные миграции схемы,
+// встроенные в бинарный файл. Применённые версии хранятся в таблице schema_version.
+type Migrator struct {
+	db         pgxPool
+	migrations []migration
+}
+
+// NewMigrator создаёт Migrator для указанного пула соединений.
+//
+// Возвращает ошибку, если встроенные файлы миграций имеют неверные имена.
+func NewMigrator(db *Pool) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+// loadMigrations читает пары файлов NNNN_name.up.sql / NNNN_name.down.sql.
+func loadMigrations(fsys fs.FS, dir string) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, entry := range entries {
+		name := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		prefix, title, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name %q", name)
+		}
+
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %q", name)
+		}
+
+		body, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: title}
+			byVersion[version] = m
+		}
+
+		if m.name != title {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.name, title)
+		}
+
+		if direction == "up" {
+			m.up = string(body)
+		} else {
+			m.down = string(body)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %d has no up script", m.version)
+		}
+
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+
+	for i, m := range migrations {
+		if m.version != i+1 {
+			return nil, fmt.Errorf("migration versions must be sequential, missing %d", i+1)
+		}
+	}
+
+	return migrations, nil
+}
+
+// Latest возвращает номер последней миграции, известной этой сборке.
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].version
+}
+
+// Version возвращает текущую версию схемы базы данных (0 для пустой базы).
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	var version int
+	err := m.inLockedTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		version, err = currentVersion(ctx, tx)
+		return err
+	})
+
+	return version, err
+}
+
+// Up применяет все ещё не применённые миграции по порядку.
+// Каждая миграция выполняется в отдельной транзакции.
+//
+// Возвращает ErrSchemaTooNew, если схема базы данных новее поддерживаемой.
+func (m *Migrator) Up(ctx context.Context) error {
+	for {
+		done := false
+
+		err := m.inLockedTx(ctx, func(tx pgx.Tx) error {
+			// Версия перечитывается под блокировкой: другой экземпляр
+			// мог применить миграцию, пока мы ждали.
+			version, err := currentVersion(ctx, tx)
+			if err != nil {
+				return err
+			}
+
+			if version > m.Latest() {
+				return fmt.Errorf("%w: database version %d, supported %d", ErrSchemaTooNew, version, m.Latest())
+			}
+
+			if version == m.Latest() {
+				done = true
+				return nil
+			}
+
+			mg := m.migrations[version]
+			if _, err = tx.Exec(ctx, mg.up); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", mg.version, mg.name, err)
+			}
+
+			_, err = tx.Exec(ctx,
+				"INSERT INTO schema_version (version, name) VALUES ($1, $2)",
+				mg.version, mg.name)
+			return err
+		})
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// Down откатывает steps последних применённых миграций в обратном порядке.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	for i := 0; i < steps; i++ {
+		done := false
+
+		err := m.inLockedTx(ctx, func(tx pgx.Tx) error {
+			version, err := currentVersion(ctx, tx)
+			if err != nil {
+				return err
+			}
+
+			if version > m.Latest() {
+				return fmt.Errorf("%w: database version %d, supported %d", ErrSchemaTooNew, version, m.Latest())
+			}
+
+			if version == 0 {
+				done = true
+				return nil
+			}
+
+			mg := m.migrations[version-1]
+			if mg.down == "" {
+				return fmt.Errorf("migration %d_%s has no down script", mg.version, mg.name)
+			}
+
+			if _, err = tx.Exec(ctx, mg.down); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", mg.version, mg.name, err)
+			}
+
+			_, err = tx.Exec(ctx, "DELETE FROM schema_version WHERE version = $1", mg.version)
+			return err
+		})
+		if err != nil || done {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Status возвращает список всех известных миграций с отметкой о применении.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied := make(map[int]time.Time)
+
+	err := m.inLockedTx(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, "SELECT version, applied_at FROM schema_version ORDER BY version")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var (
+				version   int
+				appliedAt time.Time
+			)
+			if err = rows.Scan(&version, &appliedAt); err != nil {
+				return err
+			}
+
+			applied[version] = appliedAt
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]MigrationStatus, 0, len(m.migrations))
+	for _, mg := range m.migrations {
+		status := MigrationStatus{Version: mg.version, Name: mg.name}
+		if appliedAt, ok := applied[mg.version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+
+		result = append(result, status)
+	}
+
+	return result, nil
+}
+
+// inLockedTx выполняет fn в транзакции под транзакционной advisory-блокировкой,
+// предварительно создав таблицу schema_version. Блокировка снимается
+// автоматически при завершении транзакции, поэтому выделенное соединение не требуется.
+func (m *Migrator) inLockedTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	tx, err := m.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.WithoutCancel(ctx))
+
+	if _, err = tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", migrationLockKey); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_version (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func currentVersion(ctx context.Context, tx pgx.Tx) (int, error) {
+	var version int
+	err := tx.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+
+	return version, err
+}
@@ -0,0 +1,237 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		want    []int
+		wantErr bool
+	}{
+		{
+			name: "ordered",
+			files: fstest.MapFS{
+				"m/0002_second.up.sql":   {Data: []byte("SELECT 2")},
+				"m/0001_first.up.sql":    {Data: []byte("SELECT 1")},
+				"m/0001_first.down.sql":  {Data: []byte("SELECT -1")},
+				"m/README.md":            {Data: []byte("ignored")},
+				"m/0002_second.down.sql": {Data: []byte("SELECT -2")},
+			},
+			want: []int{1, 2},
+		},
+		{
+			name: "gap in versions",
+			files: fstest.MapFS{
+				"m/0001_first.up.sql": {Data: []byte("SELECT 1")},
+				"m/0003_third.up.sql": {Data: []byte("SELECT 3")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "down without up",
+			files: fstest.MapFS{
+				"m/0001_first.down.sql": {Data: []byte("SELECT 1")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid name",
+			files: fstest.MapFS{
+				"m/first.up.sql": {Data: []byte("SELECT 1")},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := loadMigrations(tt.files, "m")
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+
+			var versions []int
+			for _, m := range migrations {
+				versions = append(versions, m.version)
+			}
+			assert.Equal(t, tt.want, versions)
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	t.Parallel()
+
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for _, m := range migrations {
+		assert.NotEmpty(t, m.down, "migration %d must have a down script", m.version)
+	}
+}
+
+func TestEmbeddedMigrations_URLUniqueness(t *testing.T) {
+	t.Parallel()
+
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	require.NoError(t, err)
+
+	// Последняя миграция, затрагивающая idx_url_hash, не должна делать хеш уникальным ключом
+	var last migration
+	for _, m := range migrations {
+		if strings.Contains(m.up, "idx_url_hash") {
+			last = m
+		}
+	}
+
+	assert.NotContains(t, last.up, "CREATE UNIQUE INDEX IF NOT EXISTS idx_url_hash")
+	assert.Contains(t, last.up, "EXCLUDE USING hash (url WITH =)")
+}
+
+func newTestMigrator(t *testing.T) (*Migrator, pgxmock.PgxPoolIface) {
+	t.Helper()
+
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	t.Cleanup(mock.Close)
+
+	return &Migrator{
+		db: mock,
+		migrations: []migration{
+			{version: 1, name: "first", up: "CREATE TABLE first", down: "DROP TABLE first"},
+			{version: 2, name: "second", up: "CREATE TABLE second", down: "DROP TABLE second"},
+		},
+	}, mock
+}
+
+func expectLock(mock pgxmock.PgxPoolIface) {
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock`).WithArgs(migrationLockKey).WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_version`).WillReturnResult(pgxmock.NewResult("CREATE TABLE", 0))
+}
+
+func expectVersion(mock pgxmock.PgxPoolIface, version int) {
+	expectLock(mock)
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(version\), 0\) FROM schema_version`).
+		WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(version))
+}
+
+func TestMigrator_Up(t *testing.T) {
+	t.Parallel()
+
+	m, mock := newTestMigrator(t)
+
+	expectVersion(mock, 1)
+	mock.ExpectExec(`CREATE TABLE second`).WillReturnResult(pgxmock.NewResult("CREATE TABLE", 0))
+	mock.ExpectExec(`INSERT INTO schema_version`).WithArgs(2, "second").WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+
+	// Повторная проверка версии под блокировкой: применять больше нечего
+	expectVersion(mock, 2)
+	mock.ExpectCommit()
+
+	require.NoError(t, m.Up(context.Background()))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrator_UpSkipsAppliedConcurrently(t *testing.T) {
+	t.Parallel()
+
+	m, mock := newTestMigrator(t)
+
+	// Пока ждали блокировку, другой экземпляр уже применил все миграции
+	expectVersion(mock, 2)
+	mock.ExpectCommit()
+
+	require.NoError(t, m.Up(context.Background()))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrator_UpRollsBackFailedMigration(t *testing.T) {
+	t.Parallel()
+
+	m, mock := newTestMigrator(t)
+
+	expectVersion(mock, 0)
+	mock.ExpectExec(`CREATE TABLE first`).WillReturnError(assert.AnError)
+	mock.ExpectRollback()
+
+	err := m.Up(context.Background())
+	require.ErrorIs(t, err, assert.AnError)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrator_UpSchemaTooNew(t *testing.T) {
+	t.Parallel()
+
+	m, mock := newTestMigrator(t)
+
+	expectVersion(mock, 3)
+	mock.ExpectRollback()
+
+	err := m.Up(context.Background())
+	require.ErrorIs(t, err, ErrSchemaTooNew)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrator_Down(t *testing.T) {
+	t.Parallel()
+
+	m, mock := newTestMigrator(t)
+
+	expectVersion(mock, 2)
+	mock.ExpectExec(`DROP TABLE second`).WillReturnResult(pgxmock.NewResult("DROP TABLE", 0))
+	mock.ExpectExec(`DELETE FROM schema_version`).WithArgs(2).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mock.ExpectCommit()
+
+	expectVersion(mock, 1)
+	mock.ExpectExec(`DROP TABLE first`).WillReturnResult(pgxmock.NewResult("DROP TABLE", 0))
+	mock.ExpectExec(`DELETE FROM schema_version`).WithArgs(1).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mock.ExpectCommit()
+
+	expectVersion(mock, 0)
+	mock.ExpectCommit()
+
+	require.NoError(t, m.Down(context.Background(), 5))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrator_Status(t *testing.T) {
+	t.Parallel()
+
+	m, mock := newTestMigrator(t)
+	appliedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	expectLock(mock)
+	mock.ExpectQuery(`SELECT version, applied_at FROM schema_version`).
+		WillReturnRows(pgxmock.NewRows([]string{"version", "applied_at"}).AddRow(1, appliedAt))
+	mock.ExpectCommit()
+
+	status, err := m.Status(context.Background())
+	require.NoError(t, err)
+	require.Len(t, status, 2)
+
+	require.NotNil(t, status[0].AppliedAt)
+	assert.Equal(t, appliedAt, *status[0].AppliedAt)
+	assert.Nil(t, status[1].AppliedAt)
+	assert.Equal(t, 2, m.Latest())
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
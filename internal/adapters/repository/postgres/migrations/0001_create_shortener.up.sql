@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS shortener (
+	id VARCHAR(100) PRIMARY KEY,
+	url VARCHAR(1024),
+	user_id VARCHAR(255),
+	is_deleted BOOLEAN DEFAULT FALSE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_original_url ON shortener (url);
+CREATE INDEX IF NOT EXISTS idx_user_id ON shortener (user_id);
@@ -0,0 +1,12 @@
+-- VARCHAR(1024) не вмещает сохранённые после этой миграции длинные URL:
+-- откат прерывается, пока такие ссылки есть в таблице.
+DO $$
+BEGIN
+	IF EXISTS (SELECT 1 FROM shortener WHERE length(url) > 1024) THEN
+		RAISE EXCEPTION 'cannot revert url to VARCHAR(1024): table shortener has urls longer than 1024 characters';
+	END IF;
+END $$;
+DROP INDEX IF EXISTS idx_url_hash;
+ALTER TABLE shortener DROP COLUMN IF EXISTS url_hash;
+ALTER TABLE shortener ALTER COLUMN url TYPE VARCHAR(1024);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_original_url ON shortener (url);
@@ -0,0 +1,6 @@
+-- URL хранится как TEXT без ограничения длины. Уникальность обеспечивается
+-- индексом по хешу: btree-индекс по самому URL не вмещает длинные значения.
+ALTER TABLE shortener ALTER COLUMN url TYPE TEXT;
+ALTER TABLE shortener ADD COLUMN IF NOT EXISTS url_hash CHAR(32) GENERATED ALWAYS AS (md5(url)) STORED;
+DROP INDEX IF EXISTS idx_original_url;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_url_hash ON shortener (url_hash);
@@ -0,0 +1,5 @@
+-- Время удаления нужно для окончательной очистки ссылок после срока хранения.
+-- Ссылкам, удалённым до миграции, срок отсчитывается с момента её применения.
+ALTER TABLE shortener ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+UPDATE shortener SET deleted_at = now() WHERE is_deleted AND deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_deleted_at ON shortener (deleted_at) WHERE is_deleted;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS id_ranges;
+DROP TABLE IF EXISTS id_sequence;
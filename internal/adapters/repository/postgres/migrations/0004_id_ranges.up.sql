@@ -0,0 +1,13 @@
+-- Счётчик и аренды блоков номеров для генератора коротких ID (стратегия block).
+-- Строка id_ranges с owner = NULL — освобождённый остаток блока, доступный для повторной аренды.
+CREATE TABLE IF NOT EXISTS id_sequence (
+	name VARCHAR(64) PRIMARY KEY,
+	next_value BIGINT NOT NULL
+);
+INSERT INTO id_sequence (name, next_value) VALUES ('short_id', 0) ON CONFLICT DO NOTHING;
+CREATE TABLE IF NOT EXISTS id_ranges (
+	range_start BIGINT PRIMARY KEY,
+	range_end BIGINT NOT NULL,
+	owner VARCHAR(255),
+	expires_at TIMESTAMPTZ
+);
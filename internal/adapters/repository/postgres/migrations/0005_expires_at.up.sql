@@ -0,0 +1,3 @@
+-- Срок жизни ссылки. NULL — бессрочная ссылка.
+ALTER TABLE shortener ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_expires_at ON shortener (expires_at) WHERE NOT is_deleted AND expires_at IS NOT NULL;
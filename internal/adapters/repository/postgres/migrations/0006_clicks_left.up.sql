@@ -0,0 +1,2 @@
+-- Оставшееся число переходов по ссылке. NULL — без ограничения.
+ALTER TABLE shortener ADD COLUMN IF NOT EXISTS clicks_left INTEGER;
@@ -0,0 +1,2 @@
+-- bcrypt-хеш пароля ссылки. NULL — ссылка без пароля.
+ALTER TABLE shortener ADD COLUMN IF NOT EXISTS password_hash TEXT;
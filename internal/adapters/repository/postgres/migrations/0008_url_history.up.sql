@@ -0,0 +1,9 @@
+-- История изменений оригинального URL ссылки её владельцем.
+-- version — номер изменения внутри ссылки начиная с 1.
+CREATE TABLE IF NOT EXISTS shortener_history (
+	short_id VARCHAR(100) NOT NULL REFERENCES shortener (id) ON DELETE CASCADE,
+	version INTEGER NOT NULL,
+	url TEXT NOT NULL,
+	changed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (short_id, version)
+);
@@ -0,0 +1,2 @@
+-- URL в том виде, в каком его передал пользователь. NULL — совпадает с каноническим url.
+ALTER TABLE shortener ADD COLUMN IF NOT EXISTS submitted_url TEXT;
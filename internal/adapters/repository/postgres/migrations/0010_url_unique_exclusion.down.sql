@@ -0,0 +1,4 @@
+-- Не выполнится, если в таблице уже есть разные URL с одинаковым md5.
+ALTER TABLE shortener DROP CONSTRAINT IF EXISTS shortener_url_excl;
+DROP INDEX IF EXISTS idx_url_hash;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_url_hash ON shortener (url_hash);
@@ -0,0 +1,7 @@
+-- Уникальный индекс по одному md5 не даёт сохранить второй URL с тем же хешем.
+-- Уникальность самого URL обеспечивает ограничение исключения на hash-индексе:
+-- он, в отличие от btree, не ограничивает длину значения. Индекс по хешу
+-- остаётся обычным и используется для поиска.
+DROP INDEX IF EXISTS idx_url_hash;
+CREATE INDEX IF NOT EXISTS idx_url_hash ON shortener (url_hash);
+ALTER TABLE shortener ADD CONSTRAINT shortener_url_excl EXCLUDE USING hash (url WITH =);
@@ -0,0 +1,135 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/bubaew95/yandex-go-learn/internal/core/idgen"
+)
+
+// idSequenceName — имя счётчика коротких ID в таблице id_sequence.
+const idSequenceName = "short_id"
+
+// RangeStore хранит аренды блоков номеров для генератора коротких ID в таблицах
+// id_sequence и id_ranges, общих для всех экземпляров сервиса.
+//
+// Аренда экземпляра, не продлившего её за ttl (например, после аварийного завершения),
+// считается свободной и может быть выдана другому экземпляру.
+type RangeStore struct {
+	db    pgxPool
+	owner string
+	ttl   time.Duration
+}
+
+// RangeStore возвращает хранилище аренд блоков номеров для этого экземпляра сервиса.
+func (p ShortenerRepository) RangeStore(ttl time.Duration) *RangeStore {
+	return newRangeStore(p.db, instanceName(), ttl)
+}
+
+func newRangeStore(db pgxPool, owner string, ttl time.Duration) *RangeStore {
+	return &RangeStore{
+		db:    db,
+		owner: owner,
+		ttl:   ttl,
+	}
+}
+
+// instanceName возвращает имя экземпляра сервиса для колонки owner.
+func instanceName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return fmt.Sprintf("%s:%d:%d", host, os.Getpid(), time.Now().UnixNano())
+}
+
+// Lease арендует освобождённый или просроченный блок, а если такого нет —
+// новый блок из size номеров, сдвигая счётчик.
+func (s *RangeStore) Lease(ctx context.Context, size uint64) (idgen.Range, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return idgen.Range{}, err
+	}
+	defer tx.Rollback(context.WithoutCancel(ctx))
+
+	var start, end int64
+	err = tx.QueryRow(ctx, `
+		SELECT range_start, range_end FROM id_ranges
+		WHERE owner IS NULL OR expires_at < now()
+		ORDER BY range_start LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`).Scan(&start, &end)
+
+	switch {
+	case err == nil:
+		_, err = tx.Exec(ctx,
+			"UPDATE id_ranges SET owner = $2, expires_at = now() + $3::interval WHERE range_start = $1",
+			start, s.owner, s.ttl)
+	case errors.Is(err, pgx.ErrNoRows):
+		err = tx.QueryRow(ctx,
+			"UPDATE id_sequence SET next_value = next_value + $2 WHERE name = $1 RETURNING next_value - $2",
+			idSequenceName, int64(size)).Scan(&start)
+		if err != nil {
+			return idgen.Range{}, err
+		}
+
+		end = start + int64(size)
+		_, err = tx.Exec(ctx,
+			"INSERT INTO id_ranges (range_start, range_end, owner, expires_at) VALUES ($1, $2, $3, now() + $4::interval)",
+			start, end, s.owner, s.ttl)
+	}
+	if err != nil {
+		return idgen.Range{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return idgen.Range{}, err
+	}
+
+	return idgen.Range{Start: uint64(start), End: uint64(end)}, nil
+}
+
+// Renew продлевает аренды экземпляра на ttl.
+// Если часть блоков уже принадлежит другому экземпляру (аренда истекла и блок
+// выдан заново), возвращает ErrLeaseLost.
+func (s *RangeStore) Renew(ctx context.Context, leases []idgen.Range) error {
+	starts := make([]int64, len(leases))
+	for i, r := range leases {
+		starts[i] = int64(r.Start)
+	}
+
+	tag, err := s.db.Exec(ctx,
+		"UPDATE id_ranges SET expires_at = now() + $3::interval WHERE owner = $1 AND range_start = ANY($2)",
+		s.owner, starts, s.ttl)
+	if err != nil {
+		return err
+	}
+
+	if renewed := tag.RowsAffected(); renewed != int64(len(leases)) {
+		return fmt.Errorf("%w: renewed %d of %d blocks", idgen.ErrLeaseLost, renewed, len(leases))
+	}
+
+	return nil
+}
+
+// Release удаляет израсходованный блок или освобождает его остаток [next, End).
+func (s *RangeStore) Release(ctx context.Context, lease idgen.Range, next uint64) error {
+	if next >= lease.End {
+		_, err := s.db.Exec(ctx,
+			"DELETE FROM id_ranges WHERE range_start = $1 AND owner = $2",
+			int64(lease.Start), s.owner)
+		return err
+	}
+
+	_, err := s.db.Exec(ctx,
+		"UPDATE id_ranges SET range_start = $3, owner = NULL, expires_at = NULL WHERE range_start = $1 AND owner = $2",
+		int64(lease.Start), s.owner, int64(next))
+
+	return err
+}
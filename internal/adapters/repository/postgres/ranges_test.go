@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bubaew95/yandex-go-learn/internal/core/idgen"
+)
+
+func TestRangeStore_Lease(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		expect func(mock pgxmock.PgxPoolIface)
+		want   idgen.Range
+	}{
+		{
+			name: "new block",
+			expect: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`SELECT range_start, range_end FROM id_ranges\s+WHERE owner IS NULL OR expires_at < now\(\)`).
+					WillReturnError(pgx.ErrNoRows)
+				mock.ExpectQuery(`UPDATE id_sequence SET next_value = next_value \+ \$2 WHERE name = \$1 RETURNING next_value - \$2`).
+					WithArgs("short_id", int64(100)).
+					WillReturnRows(pgxmock.NewRows([]string{"start"}).AddRow(int64(300)))
+				mock.ExpectExec(`INSERT INTO id_ranges \(range_start, range_end, owner, expires_at\)`).
+					WithArgs(int64(300), int64(400), "node-1", time.Minute).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+			},
+			want: idgen.Range{Start: 300, End: 400},
+		},
+		{
+			name: "released block",
+			expect: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`SELECT range_start, range_end FROM id_ranges`).
+					WillReturnRows(pgxmock.NewRows([]string{"range_start", "range_end"}).AddRow(int64(150), int64(200)))
+				mock.ExpectExec(`UPDATE id_ranges SET owner = \$2, expires_at = now\(\) \+ \$3::interval WHERE range_start = \$1`).
+					WithArgs(int64(150), "node-1", time.Minute).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+			},
+			want: idgen.Range{Start: 150, End: 200},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			require.NoError(t, err)
+			defer mock.Close()
+
+			store := newRangeStore(mock, "node-1", time.Minute)
+
+			mock.ExpectBegin()
+			tt.expect(mock)
+			mock.ExpectCommit()
+
+			r, err := store.Lease(context.Background(), 100)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, r)
+
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRangeStore_RenewAndRelease(t *testing.T) {
+	t.Parallel()
+
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	store := newRangeStore(mock, "node-1", time.Minute)
+	ctx := context.Background()
+
+	mock.ExpectExec(`UPDATE id_ranges SET expires_at = now\(\) \+ \$3::interval WHERE owner = \$1 AND range_start = ANY\(\$2\)`).
+		WithArgs("node-1", []int64{0, 100}, time.Minute).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 2))
+	require.NoError(t, store.Renew(ctx, []idgen.Range{{Start: 0, End: 100}, {Start: 100, End: 200}}))
+
+	// Блок 0 после истечения аренды выдан другому экземпляру
+	mock.ExpectExec(`UPDATE id_ranges SET expires_at = now\(\) \+ \$3::interval WHERE owner = \$1 AND range_start = ANY\(\$2\)`).
+		WithArgs("node-1", []int64{0, 100}, time.Minute).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	require.ErrorIs(t, store.Renew(ctx, []idgen.Range{{Start: 0, End: 100}, {Start: 100, End: 200}}), idgen.ErrLeaseLost)
+
+	// Израсходованный блок удаляется
+	mock.ExpectExec(`DELETE FROM id_ranges WHERE range_start = \$1 AND owner = \$2`).
+		WithArgs(int64(0), "node-1").
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	require.NoError(t, store.Release(ctx, idgen.Range{Start: 0, End: 100}, 100))
+
+	// Остаток освобождается для других экземпляров
+	mock.ExpectExec(`UPDATE id_ranges SET range_start = \$3, owner = NULL, expires_at = NULL WHERE range_start = \$1 AND owner = \$2`).
+		WithArgs(int64(100), "node-1", int64(142)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	require.NoError(t, store.Release(ctx, idgen.Range{Start: 100, End: 200}, 142))
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,196 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+
+	"github.com/bubaew95/yandex-go-learn/config"
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/constants"
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/logger"
+)
+
+// replicaCheckInterval — период фоновой проверки доступности реплик.
+const replicaCheckInterval = 5 * time.Second
+
+// replica — пул соединений с одной репликой и её текущее состояние.
+type replica struct {
+	name    string
+	pool    pgxPool
+	healthy atomic.Bool
+}
+
+// ReplicaHealth описывает состояние одной реплики.
+type ReplicaHealth struct {
+	// Name — адрес реплики (хост и порт из строки подключения).
+	Name string `json:"name"`
+
+	// Healthy — признак того, что реплика принимает запросы на чтение.
+	Healthy bool `json:"healthy"`
+}
+
+// replicaSet распределяет запросы на чтение по доступным репликам по кругу.
+// Недоступная реплика исключается из ротации до следующей успешной проверки.
+type replicaSet struct {
+	replicas []*replica
+	next     atomic.Uint64
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// openReplicas создаёт пулы для всех реплик из конфигурации и запускает
+// их фоновую проверку. Недоступность реплики при старте не считается ошибкой.
+func openReplicas(ctx context.Context, cfg config.Config) (*replicaSet, error) {
+	if len(cfg.DataBaseReplicaDSNs) == 0 {
+		return nil, nil
+	}
+
+	replicas := make([]*replica, 0, len(cfg.DataBaseReplicaDSNs))
+	for _, dsn := range cfg.DataBaseReplicaDSNs {
+		pool, err := openPool(ctx, cfg, dsn)
+		if err != nil {
+			for _, r := range replicas {
+				r.pool.Close()
+			}
+
+			return nil, fmt.Errorf("replica: %w", err)
+		}
+
+		replicas = append(replicas, &replica{name: replicaName(dsn), pool: pool})
+	}
+
+	set := newReplicaSet(replicas)
+	set.check(ctx)
+	set.run(replicaCheckInterval)
+
+	return set, nil
+}
+
+func newReplicaSet(replicas []*replica) *replicaSet {
+	return &replicaSet{
+		replicas: replicas,
+		done:     make(chan struct{}),
+	}
+}
+
+// replicaName возвращает адрес реплики без учётных данных для логов и мониторинга.
+func replicaName(dsn string) string {
+	cfg, err := pgconn.ParseConfig(dsn)
+	if err != nil {
+		return "unknown"
+	}
+
+	return fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+}
+
+// pick возвращает следующую доступную реплику или nil, если доступных нет.
+func (s *replicaSet) pick() *replica {
+	if s == nil {
+		return nil
+	}
+
+	n := uint64(len(s.replicas))
+	start := s.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		r := s.replicas[(start+i)%n]
+		if r.healthy.Load() {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// markFailed исключает реплику из ротации, если ошибка говорит о её недоступности.
+func (r *replica) markFailed(err error) {
+	if !isReplicaFailure(err) {
+		return
+	}
+
+	if r.healthy.CompareAndSwap(true, false) {
+		logger.Log.Warn("Replica marked unhealthy", zap.String("replica", r.name), zap.Error(err))
+	}
+}
+
+// isReplicaFailure отличает отказ реплики от обычного результата запроса.
+func isReplicaFailure(err error) bool {
+	return err != nil &&
+		!errors.Is(err, pgx.ErrNoRows) &&
+		!errors.Is(err, context.Canceled) &&
+		!errors.Is(err, constants.ErrIsDeleted) &&
+		!errors.Is(err, constants.ErrExpired) &&
+		!errors.Is(err, constants.ErrNoClicksLeft)
+}
+
+// check проверяет все реплики и обновляет их состояние.
+func (s *replicaSet) check(ctx context.Context) {
+	for _, r := range s.replicas {
+		err := r.pool.Ping(ctx)
+		healthy := err == nil
+
+		if r.healthy.Swap(healthy) != healthy {
+			if healthy {
+				logger.Log.Info("Replica is healthy", zap.String("replica", r.name))
+			} else {
+				logger.Log.Warn("Replica is unhealthy", zap.String("replica", r.name), zap.Error(err))
+			}
+		}
+	}
+}
+
+// run периодически проверяет реплики до вызова close.
+func (s *replicaSet) run(interval time.Duration) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				s.check(ctx)
+				cancel()
+			case <-s.done:
+				return
+			}
+		}
+	}()
+}
+
+// health возвращает состояние всех реплик.
+func (s *replicaSet) health() []ReplicaHealth {
+	if s == nil {
+		return nil
+	}
+
+	result := make([]ReplicaHealth, 0, len(s.replicas))
+	for _, r := range s.replicas {
+		result = append(result, ReplicaHealth{Name: r.name, Healthy: r.healthy.Load()})
+	}
+
+	return result
+}
+
+// close останавливает проверку и закрывает пулы реплик.
+func (s *replicaSet) close() {
+	if s == nil {
+		return
+	}
+
+	close(s.done)
+	s.wg.Wait()
+
+	for _, r := range s.replicas {
+		r.pool.Close()
+	}
+}
@@ -3,13 +3,14 @@ package postgres
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
-	_ "github.com/jackc/pgx/v5/stdlib"
 	"go.uber.org/zap"
 
 	"github.com/bubaew95/yandex-go-learn/config"
@@ -19,101 +20,277 @@ import (
 	"github.com/bubaew95/yandex-go-learn/pkg/crypto"
 )
 
+// constraintPrimaryKey — имя ограничения первичного ключа (короткого ID) таблицы shortener.
+const constraintPrimaryKey = "shortener_pkey"
+
 // ShortenerRepository реализует интерфейс репозитория для работы с сокращёнными URL.
 // Использует PostgreSQL как хранилище данных.
+//
+// Если заданы реплики, запросы на чтение направляются на них,
+// а запись и повторные проверки промахов выполняются на основной базе.
 type ShortenerRepository struct {
-	db *sql.DB
+	db       pgxPool
+	replicas *replicaSet
 }
 
 // NewShortenerRepository создаёт и инициализирует новый экземпляр ShortenerRepository,
-// выполняет подключение к БД и создаёт таблицы, если их нет.
+// открывает пулы соединений с основной БД и репликами и применяет недостающие миграции схемы.
 //
-// Возвращает ошибку, если соединение с БД или инициализация схемы завершились неудачно.
+// Возвращает ошибку, если соединение с БД или миграция завершились неудачно,
+// а также ErrSchemaTooNew, если схема базы данных новее поддерживаемой этой сборкой.
 func NewShortenerRepository(ctg config.Config) (*ShortenerRepository, error) {
-	db, err := dbConnect(ctg.DataBaseDSN)
+	ctx := context.Background()
+
+	db, err := NewPool(ctx, ctg)
 	if err != nil {
 		return nil, err
 	}
 
-	err = createTable(db)
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
 
+	if err = migrator.Up(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	replicas, err := openReplicas(ctx, ctg)
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return &ShortenerRepository{
-		db: db,
+		db:       db,
+		replicas: replicas,
 	}, nil
 }
 
-func createTable(db *sql.DB) error {
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS shortener (
-			id VARCHAR(100) PRIMARY KEY,
-			url VARCHAR(1024),
-			user_id VARCHAR(255),
-			is_deleted BOOLEAN DEFAULT FALSE
-		);
-		CREATE UNIQUE INDEX IF NOT EXISTS idx_original_url ON shortener (url);
-		CREATE INDEX IF NOT EXISTS idx_user_id ON shortener (user_id);
-	`)
+// Close закрывает пулы соединений с базой данных и репликами.
+func (p ShortenerRepository) Close() error {
+	p.replicas.close()
+	p.db.Close()
+	return nil
+}
 
-	return err
+// Ping проверяет доступность основной базы данных и реплик.
+//
+// Возвращает ошибку основной базы, если она недоступна. Если основная база
+// доступна, но часть реплик нет, возвращает ErrDegraded с перечнем недоступных реплик.
+func (p ShortenerRepository) Ping(ctx context.Context) error {
+	if err := p.db.Ping(ctx); err != nil {
+		return err
+	}
+
+	if p.replicas == nil {
+		return nil
+	}
+
+	p.replicas.check(ctx)
+
+	var unhealthy []string
+	for _, h := range p.replicas.health() {
+		if !h.Healthy {
+			unhealthy = append(unhealthy, h.Name)
+		}
+	}
+
+	if len(unhealthy) > 0 {
+		return fmt.Errorf("%w: unhealthy replicas %s", constants.ErrDegraded, strings.Join(unhealthy, ", "))
+	}
+
+	return nil
 }
 
-// Close закрывает соединение с базой данных.
-func (p ShortenerRepository) Close() error {
-	return p.db.Close()
+// Replicas возвращает состояние реплик.
+func (p ShortenerRepository) Replicas() []ReplicaHealth {
+	return p.replicas.health()
 }
 
-// Ping проверяет доступность подключения к базе данных.
-func (p ShortenerRepository) Ping(ctx context.Context) error {
-	return p.db.PingContext(ctx)
+// read выполняет запрос на чтение на доступной реплике, а при её отказе — на основной базе.
+//
+// Если retryMiss, отсутствие строки на реплике тоже перепроверяется на основной базе:
+// из-за задержки репликации только что созданной записи на реплике может ещё не быть.
+func (p ShortenerRepository) read(retryMiss bool, fn func(db pgxPool) error) error {
+	if r := p.replicas.pick(); r != nil {
+		err := fn(r.pool)
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(err, pgx.ErrNoRows):
+			if !retryMiss {
+				return err
+			}
+		case !isReplicaFailure(err):
+			return err
+		default:
+			r.markFailed(err)
+		}
+	}
+
+	return fn(p.db)
+}
+
+// Stats возвращает состояние пула соединений.
+func (p ShortenerRepository) Stats() PoolStats {
+	pool, ok := p.db.(*Pool)
+	if !ok {
+		return PoolStats{}
+	}
+
+	return pool.Stats()
 }
 
 // SetURL сохраняет новый сокращённый URL в базу данных.
-// В случае конфликта уникального ключа возвращает ошибку ErrUniqueIndex.
-func (p ShortenerRepository) SetURL(ctx context.Context, id string, url string) error {
+// Если занят короткий ID, возвращает ErrIDConflict,
+// при любом другом нарушении уникальности — ErrUniqueIndex.
+func (p ShortenerRepository) SetURL(ctx context.Context, link model.ShortenURL) error {
 	userID := ctx.Value(crypto.KeyUserID)
 
 	logger.Log.Debug("SetURL", zap.Any("user_id", userID))
-	_, err := p.db.ExecContext(ctx,
-		"INSERT INTO shortener (id, url, user_id) VALUES($1, $2, $3)",
-		id, url, userID)
+	_, err := p.db.Exec(ctx,
+		"INSERT INTO shortener (id, url, user_id, expires_at, clicks_left, password_hash, submitted_url) VALUES($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''))",
+		link.ShortURL, link.OriginalURL, userID, link.ExpiresAt, link.ClicksLeft, link.PasswordHash, link.SubmittedURL)
 
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgerrcode.IsIntegrityConstraintViolation(pgErr.Code) {
 			err = constants.ErrUniqueIndex
+			if pgErr.ConstraintName == constraintPrimaryKey {
+				err = constants.ErrIDConflict
+			}
 		}
 	}
 
 	return err
 }
 
-// GetURLByID возвращает оригинальный URL по его сокращённому идентификатору.
-// Если запись помечена как удалённая, возвращает ошибку ErrIsDeleted.
-func (p ShortenerRepository) GetURLByID(ctx context.Context, id string) (string, error) {
-	var (
-		url       string
-		isDeleted bool
-	)
+// linkState — состояние ссылки, по которому решается, можно ли по ней перейти.
+type linkState struct {
+	url          string
+	isDeleted    bool
+	isExpired    bool
+	clicksLeft   *int
+	passwordHash string
+}
+
+// check проверяет, что ссылка не удалена, не истекла и не исчерпала лимит переходов.
+func (l linkState) check() error {
+	if l.isDeleted {
+		return constants.ErrIsDeleted
+	}
+
+	if l.isExpired {
+		return constants.ErrExpired
+	}
+
+	if l.clicksLeft != nil && *l.clicksLeft <= 0 {
+		return constants.ErrNoClicksLeft
+	}
+
+	return nil
+}
+
+// lookup читает состояние ссылки с реплики или, если её там ещё нет, с основной базы.
+func (p ShortenerRepository) lookup(ctx context.Context, id string) (linkState, error) {
+	var l linkState
+	err := p.read(true, func(db pgxPool) error {
+		return db.QueryRow(ctx,
+			"SELECT COALESCE(submitted_url, url, ''), is_deleted, COALESCE(expires_at <= now(), false), clicks_left, COALESCE(password_hash, '') FROM shortener WHERE id = $1",
+			id).Scan(&l.url, &l.isDeleted, &l.isExpired, &l.clicksLeft, &l.passwordHash)
+	})
+
+	return l, err
+}
 
-	row := p.db.QueryRowContext(ctx,
-		"SELECT url, is_deleted FROM shortener WHERE id = $1", id)
-	err := row.Scan(&url, &isDeleted)
+// GetURLByID возвращает URL для перехода по сокращённому идентификатору: переданный пользователем,
+// если он сохранён, иначе канонический.
+// Если запись помечена как удалённая (в том числе окончательно), возвращает ошибку ErrIsDeleted,
+// если срок жизни ссылки истёк — ErrExpired, если ссылка защищена паролем — ErrPasswordRequired.
+//
+// Ссылка с лимитом переходов читается с реплики, как и остальные, а переход списывается
+// на основной базе условным UPDATE: параллельные переходы не могут уйти в минус.
+// Если лимит исчерпан, возвращает ErrNoClicksLeft.
+func (p ShortenerRepository) GetURLByID(ctx context.Context, id string, check func(url string) error) (string, error) {
+	l, err := p.lookup(ctx, id)
 	if err != nil {
 		return "", err
 	}
 
-	if isDeleted {
-		return "", constants.ErrIsDeleted
+	if err = l.check(); err != nil {
+		return "", err
+	}
+
+	if l.passwordHash != "" {
+		return "", constants.ErrPasswordRequired
+	}
+
+	return p.follow(ctx, id, l, check)
+}
+
+// UnlockURL выполняет переход по ссылке после проверки её пароля функцией verify.
+// Для ссылки без пароля verify не вызывается. URL ссылки, как и в GetURLByID,
+// проверяется функцией check до списания перехода.
+func (p ShortenerRepository) UnlockURL(ctx context.Context, id string, verify func(passwordHash string) error, check func(url string) error) (string, error) {
+	l, err := p.lookup(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	if err = l.check(); err != nil {
+		return "", err
+	}
+
+	if l.passwordHash != "" {
+		if err = verify(l.passwordHash); err != nil {
+			return "", err
+		}
+	}
+
+	return p.follow(ctx, id, l, check)
+}
+
+// follow выполняет переход по доступной ссылке: проверяет URL функцией check, если она задана,
+// и только затем у ссылки с лимитом списывает переход.
+func (p ShortenerRepository) follow(ctx context.Context, id string, l linkState, check func(url string) error) (string, error) {
+	if check != nil {
+		if err := check(l.url); err != nil {
+			return "", err
+		}
+	}
+
+	if l.clicksLeft == nil {
+		return l.url, nil
+	}
+
+	return p.consumeClick(ctx, id)
+}
+
+// consumeClick списывает один переход, только если он ещё остался.
+// Ссылку, удалённую или истёкшую после чтения, тоже считает исчерпанной.
+func (p ShortenerRepository) consumeClick(ctx context.Context, id string) (string, error) {
+	var url string
+	err := p.db.QueryRow(ctx, `
+		UPDATE shortener SET clicks_left = clicks_left - 1
+		WHERE id = $1 AND clicks_left > 0 AND NOT is_deleted AND (expires_at IS NULL OR expires_at > now())
+		RETURNING COALESCE(submitted_url, url)
+	`, id).Scan(&url)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", constants.ErrNoClicksLeft
+	}
+
+	if err != nil {
+		return "", err
 	}
 
 	return url, nil
 }
 
 // GetURLByOriginalURL ищет короткий ID по оригинальному URL.
+// Поиск идёт по индексу хеша URL, сравнение самого URL исключает коллизии.
 // Возвращает false, если совпадение не найдено.
 func (p ShortenerRepository) GetURLByOriginalURL(ctx context.Context, originalURL string) (string, bool) {
 	var (
@@ -121,9 +298,10 @@ func (p ShortenerRepository) GetURLByOriginalURL(ctx context.Context, originalUR
 		url string
 	)
 
-	row := p.db.QueryRowContext(ctx,
-		"SELECT id, url FROM shortener WHERE url = $1", originalURL)
-	err := row.Scan(&id, &url)
+	err := p.read(true, func(db pgxPool) error {
+		return db.QueryRow(ctx,
+			"SELECT id, url FROM shortener WHERE url_hash = md5($1) AND url = $1", originalURL).Scan(&id, &url)
+	})
 	if err != nil {
 		return "", false
 	}
@@ -131,83 +309,393 @@ func (p ShortenerRepository) GetURLByOriginalURL(ctx context.Context, originalUR
 	return id, true
 }
 
-// InsertURLs добавляет список URL в БД, пропуская уже существующие записи (ON CONFLICT DO NOTHING).
-func (p ShortenerRepository) InsertURLs(ctx context.Context, urls []model.ShortenerURLMapping) error {
-	tx, err := p.db.Begin()
+// InsertURLs сохраняет пакет одним запросом: вставка с ON CONFLICT DO NOTHING и поиск
+// уже сокращённых URL выполняются в одной инструкции и потому в одной транзакции.
+//
+// Существующие URL ищутся в снимке данных до вставки. Запись, которая не вставлена
+// и URL которой в снимке не найден, конфликтует по ID (или её URL сохранили
+// параллельно) и возвращается с ErrIDConflict — сервис повторит её с новым ID.
+func (p ShortenerRepository) InsertURLs(ctx context.Context, urls []model.BatchURL) ([]model.BatchURLResult, error) {
+	if len(urls) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, len(urls))
+	originalURLs := make([]string, len(urls))
+	expiresAt := make([]*time.Time, len(urls))
+	clicksLeft := make([]*int, len(urls))
+	passwordHashes := make([]string, len(urls))
+	submittedURLs := make([]string, len(urls))
+	for i, v := range urls {
+		ids[i] = v.ID
+		originalURLs[i] = v.OriginalURL
+		expiresAt[i] = v.ExpiresAt
+		clicksLeft[i] = v.ClicksLeft
+		passwordHashes[i] = v.PasswordHash
+		submittedURLs[i] = v.SubmittedURL
+	}
+
+	rows, err := p.db.Query(ctx, `
+		WITH input AS (
+			SELECT id, url, expires_at, clicks_left, password_hash, submitted_url, ord
+			FROM unnest($1::VARCHAR[], $2::TEXT[], $4::TIMESTAMPTZ[], $5::INTEGER[], $6::TEXT[], $7::TEXT[])
+				WITH ORDINALITY AS t(id, url, expires_at, clicks_left, password_hash, submitted_url, ord)
+		), inserted AS (
+			INSERT INTO shortener (id, url, user_id, expires_at, clicks_left, password_hash, submitted_url)
+			SELECT id, url, $3::VARCHAR, expires_at, clicks_left, NULLIF(password_hash, ''), NULLIF(submitted_url, '') FROM input
+			ON CONFLICT DO NOTHING
+			RETURNING id, url
+		)
+		SELECT inserted.id IS NOT NULL, existing.id
+		FROM input
+		LEFT JOIN inserted ON inserted.id = input.id AND inserted.url = input.url
+		LEFT JOIN shortener existing ON existing.url_hash = md5(input.url) AND existing.url = input.url
+		ORDER BY input.ord
+	`, ids, originalURLs, ctx.Value(crypto.KeyUserID), expiresAt, clicksLeft, passwordHashes, submittedURLs)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer tx.Rollback()
+	defer rows.Close()
 
-	userID := ctx.Value(crypto.KeyUserID)
+	results := make([]model.BatchURLResult, 0, len(urls))
+	for rows.Next() {
+		if len(results) == len(urls) {
+			return nil, fmt.Errorf("insert urls: more results than %d urls", len(urls))
+		}
+
+		var (
+			created    bool
+			existingID *string
+		)
+		if err = rows.Scan(&created, &existingID); err != nil {
+			return nil, err
+		}
+
+		result := model.BatchURLResult{ID: urls[len(results)].ID}
+		switch {
+		case created:
+		case existingID != nil:
+			result = model.BatchURLResult{ID: *existingID, Err: constants.ErrUniqueIndex}
+		default:
+			result.Err = constants.ErrIDConflict
+		}
+
+		results = append(results, result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(results) != len(urls) {
+		return nil, fmt.Errorf("insert urls: got %d results for %d urls", len(results), len(urls))
+	}
 
-	smtp, err := tx.PrepareContext(ctx, "INSERT INTO shortener (id, url, user_id) VALUES($1, $2, $3) ON CONFLICT DO NOTHING")
+	return results, nil
+}
+
+// GetURLSByUserID возвращает все сокращённые ссылки, созданные пользователем,
+// кроме окончательно удалённых.
+func (p ShortenerRepository) GetURLSByUserID(ctx context.Context, userID string) ([]model.ShortenURL, error) {
+	var items []model.ShortenURL
+	err := p.read(false, func(db pgxPool) error {
+		rows, err := db.Query(ctx, "SELECT id, url, COALESCE(submitted_url, ''), clicks_left FROM shortener WHERE user_id = $1 AND url IS NOT NULL", userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		items = nil
+		for rows.Next() {
+			item := model.ShortenURL{UserID: userID}
+			err = rows.Scan(&item.ShortURL, &item.OriginalURL, &item.SubmittedURL, &item.ClicksLeft)
+			if err != nil {
+				return err
+			}
+
+			items = append(items, item)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// DeleteUserURLS помечает указанные пользователем URL как удалённые (is_deleted = true)
+// и запоминает время первого удаления.
+//
+// Ссылки группируются по владельцу, и для каждого из них выполняется один UPDATE
+// по массиву ID; все обновления выполняются в одной транзакции.
+func (p ShortenerRepository) DeleteUserURLS(ctx context.Context, items []model.URLToDelete) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	var users []string
+	byUser := make(map[string][]string)
+	for _, item := range items {
+		if _, ok := byUser[item.UserID]; !ok {
+			users = append(users, item.UserID)
+		}
+
+		byUser[item.UserID] = append(byUser[item.UserID], item.ShortLink)
+	}
+
+	tx, err := p.db.Begin(ctx)
 	if err != nil {
-		fmt.Println("test")
 		return err
 	}
-	defer smtp.Close()
+	defer tx.Rollback(context.WithoutCancel(ctx))
 
-	for _, v := range urls {
-		_, err := smtp.ExecContext(ctx, v.CorrelationID, v.OriginalURL, userID)
+	for _, userID := range users {
+		logger.Log.Debug("Delete user urls", zap.String("user_id", userID), zap.Int("count", len(byUser[userID])))
+		_, err = tx.Exec(ctx,
+			"UPDATE shortener SET is_deleted = true, deleted_at = COALESCE(deleted_at, now()) WHERE user_id = $1 AND id = ANY($2)",
+			userID, byUser[userID])
 		if err != nil {
 			return err
 		}
 	}
 
-	return tx.Commit()
+	return tx.Commit(ctx)
 }
 
-// GetURLSByUserID возвращает все сокращённые ссылки, созданные пользователем.
-func (p ShortenerRepository) GetURLSByUserID(ctx context.Context, userID string) (map[string]string, error) {
-	rows, err := p.db.QueryContext(ctx, "SELECT id, url FROM shortener WHERE user_id = $1", userID)
+// UpdateURL заменяет оригинальный URL ссылки пользователя и записывает прежний URL для перехода
+// в shortener_history.
+//
+// Строка ссылки блокируется SELECT ... FOR UPDATE, поэтому параллельные изменения
+// одной ссылки выполняются по очереди и номера версий не повторяются.
+// Уникальность нового URL обеспечивает индекс таблицы shortener.
+func (p ShortenerRepository) UpdateURL(ctx context.Context, id string, userID string, url string, submittedURL string) error {
+	tx, err := p.db.Begin(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	defer tx.Rollback(context.WithoutCancel(ctx))
 
-	items := make(map[string]string)
-	for rows.Next() {
-		var (
-			ID  string
-			URL string
-		)
-		err = rows.Scan(&ID, &URL)
+	prev, err := checkOwner(ctx, tx, id, userID, true)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return constants.ErrNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if prev.OriginalURL == url && prev.SubmittedURL == submittedURL {
+		return nil
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE shortener SET url = $2, submitted_url = NULLIF($3, '') WHERE id = $1", id, url, submittedURL)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgerrcode.IsIntegrityConstraintViolation(pgErr.Code) {
+			return constants.ErrUniqueIndex
+		}
+
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO shortener_history (short_id, version, url)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2 FROM shortener_history WHERE short_id = $1`,
+		id, prev.RedirectURL())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetURLHistory возвращает прежние оригинальные URL ссылки пользователя в порядке версий.
+func (p ShortenerRepository) GetURLHistory(ctx context.Context, id string, userID string) ([]model.URLEdit, error) {
+	var history []model.URLEdit
+	err := p.read(true, func(db pgxPool) error {
+		if _, err := checkOwner(ctx, db, id, userID, false); err != nil {
+			return err
+		}
+
+		rows, err := db.Query(ctx,
+			"SELECT version, url, changed_at FROM shortener_history WHERE short_id = $1 ORDER BY version",
+			id)
 		if err != nil {
-			return nil, err
+			return err
 		}
+		defer rows.Close()
 
-		items[ID] = URL
+		history = nil
+		for rows.Next() {
+			var e model.URLEdit
+			if err = rows.Scan(&e.Version, &e.OriginalURL, &e.ChangedAt); err != nil {
+				return err
+			}
+
+			history = append(history, e)
+		}
+
+		return rows.Err()
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, constants.ErrNotFound
 	}
 
-	if err = rows.Err(); err != nil {
+	return history, err
+}
+
+// rowQuerier — общий для пула и транзакции метод чтения одной строки.
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// checkOwner проверяет, что ссылку id может изменять пользователь userID,
+// и возвращает её текущие URL. При forUpdate строка ссылки блокируется до конца транзакции.
+// Для отсутствующей ссылки возвращает pgx.ErrNoRows.
+func checkOwner(ctx context.Context, db rowQuerier, id string, userID string, forUpdate bool) (model.ShortenURL, error) {
+	query := "SELECT COALESCE(user_id, ''), COALESCE(url, ''), COALESCE(submitted_url, ''), is_deleted FROM shortener WHERE id = $1"
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+
+	var (
+		owner     string
+		link      model.ShortenURL
+		isDeleted bool
+	)
+	if err := db.QueryRow(ctx, query, id).Scan(&owner, &link.OriginalURL, &link.SubmittedURL, &isDeleted); err != nil {
+		return model.ShortenURL{}, err
+	}
+
+	if owner != userID {
+		return model.ShortenURL{}, constants.ErrNotOwner
+	}
+
+	if isDeleted {
+		return model.ShortenURL{}, constants.ErrIsDeleted
+	}
+
+	return link, nil
+}
+
+// GetDeletedURLs возвращает удалённые ссылки пользователя, которые ещё можно восстановить:
+// удалённые не раньше deletedAfter, не очищенные и с неистёкшим сроком жизни.
+func (p ShortenerRepository) GetDeletedURLs(ctx context.Context, userID string, deletedAfter time.Time) ([]model.ShortenURL, error) {
+	var items []model.ShortenURL
+	err := p.read(false, func(db pgxPool) error {
+		rows, err := db.Query(ctx, `
+			SELECT id, url, deleted_at FROM shortener
+			WHERE user_id = $1 AND is_deleted AND url IS NOT NULL AND deleted_at >= $2
+				AND NOT COALESCE(expires_at <= now(), false)`,
+			userID, deletedAfter)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		items = nil
+		for rows.Next() {
+			item := model.ShortenURL{UserID: userID, IsDeleted: true}
+			if err = rows.Scan(&item.ShortURL, &item.OriginalURL, &item.DeletedAt); err != nil {
+				return err
+			}
+
+			items = append(items, item)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	return items, nil
 }
 
-// DeleteUserURLS помечает указанные пользователем URL как удалённые (is_deleted = true).
-func (p ShortenerRepository) DeleteUserURLS(ctx context.Context, items []model.URLToDelete) error {
-	tx, err := p.db.Begin()
+// UndeleteURL снимает пометку удаления со ссылки пользователя.
+//
+// Строка ссылки блокируется SELECT ... FOR UPDATE, чтобы условия восстановления
+// проверялись и применялись атомарно относительно очистки и повторного удаления.
+func (p ShortenerRepository) UndeleteURL(ctx context.Context, id string, userID string, deletedAfter time.Time) error {
+	tx, err := p.db.Begin(ctx)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
+	defer tx.Rollback(context.WithoutCancel(ctx))
+
+	var (
+		owner                          string
+		isDeleted, isPurged, isExpired bool
+		deletedAt                      *time.Time
+	)
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE(user_id, ''), is_deleted, url IS NULL, deleted_at, COALESCE(expires_at <= now(), false)
+		FROM shortener WHERE id = $1 FOR UPDATE`,
+		id).Scan(&owner, &isDeleted, &isPurged, &deletedAt, &isExpired)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return constants.ErrNotFound
+	}
 
-	stmt, err := tx.PrepareContext(ctx, "UPDATE shortener SET is_deleted = true WHERE user_id = $1 and id = $2")
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
 
-	for _, item := range items {
-		logger.Log.Debug("v_id", zap.String("id", item.ShortLink))
-		_, err := stmt.ExecContext(ctx, item.UserID, item.ShortLink)
-		if err != nil {
-			return err
-		}
+	switch {
+	case owner != userID:
+		return constants.ErrNotOwner
+	case !isDeleted:
+		return nil
+	case isPurged || deletedAt == nil || deletedAt.Before(deletedAfter):
+		return constants.ErrRestoreWindowPassed
+	case isExpired:
+		return constants.ErrExpired
+	}
+
+	if _, err = tx.Exec(ctx, "UPDATE shortener SET is_deleted = false, deleted_at = NULL WHERE id = $1", id); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ExpireURLs помечает удалёнными не более limit ссылок, срок жизни которых истёк
+// к expiredBefore, и возвращает их число. Временем удаления становится время истечения,
+// поэтому срок хранения до окончательной очистки отсчитывается от него.
+func (p ShortenerRepository) ExpireURLs(ctx context.Context, expiredBefore time.Time, limit int) (int, error) {
+	tag, err := p.db.Exec(ctx, `
+		UPDATE shortener SET is_deleted = true, deleted_at = expires_at WHERE id IN (
+			SELECT id FROM shortener WHERE NOT is_deleted AND expires_at <= $1 LIMIT $2
+		)`, expiredBefore, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+// PurgeDeletedURLs окончательно удаляет не более limit ссылок, помеченных
+// удалёнными раньше deletedBefore, и возвращает их число.
+//
+// При reuseIDs строки удаляются целиком и ID может быть выдан снова. Иначе у строки
+// обнуляется url: оригинальный URL освобождается, а ID остаётся занятым.
+func (p ShortenerRepository) PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time, limit int, reuseIDs bool) (int, error) {
+	query := `
+		DELETE FROM shortener WHERE id IN (
+			SELECT id FROM shortener WHERE is_deleted AND deleted_at < $1 LIMIT $2
+		)`
+	if !reuseIDs {
+		query = `
+		UPDATE shortener SET url = NULL WHERE id IN (
+			SELECT id FROM shortener WHERE is_deleted AND deleted_at < $1 AND url IS NOT NULL LIMIT $2
+		)`
+	}
+
+	tag, err := p.db.Exec(ctx, query, deletedBefore, limit)
+	if err != nil {
+		return 0, err
 	}
 
-	return tx.Commit()
+	return int(tag.RowsAffected()), nil
 }
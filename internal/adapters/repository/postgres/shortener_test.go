@@ -2,53 +2,121 @@ package postgres
 
 import (
 	"context"
-	"database/sql"
 	"errors"
+	"fmt"
+	"os"
 	"testing"
+	"time"
 
-	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bubaew95/yandex-go-learn/config"
 	"github.com/bubaew95/yandex-go-learn/internal/adapters/constants"
 	"github.com/bubaew95/yandex-go-learn/internal/core/model"
 	"github.com/bubaew95/yandex-go-learn/pkg/crypto"
 	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestSetURL(t *testing.T) {
-	db, mock, err := sqlmock.New()
+	mock, err := pgxmock.NewPool()
 	if err != nil {
 		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
 	}
-	defer db.Close()
+	defer mock.Close()
 
-	repo := ShortenerRepository{db: db}
+	repo := ShortenerRepository{db: mock}
 
 	t.Run("Success added", func(t *testing.T) {
 		ctx := context.WithValue(context.Background(), crypto.KeyUserID, "1")
 
+		expiresAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+		clicksLeft := 1
+		mock.ExpectExec(`INSERT INTO shortener \(id, url, user_id, expires_at, clicks_left, password_hash, submitted_url\)`).
+			WithArgs("124f", "https://local.site", "1", &expiresAt, &clicksLeft, "hash", "https://Local.site:443").
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+		err = repo.SetURL(ctx, model.ShortenURL{
+			ShortURL:     "124f",
+			OriginalURL:  "https://local.site",
+			SubmittedURL: "https://Local.site:443",
+			ExpiresAt:    &expiresAt,
+			ClicksLeft:   &clicksLeft,
+			PasswordHash: "hash",
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Unique constraint violation", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), crypto.KeyUserID, "2")
+
+		pgErr := &pgconn.PgError{Code: pgerrcode.UniqueViolation, ConstraintName: "idx_url_hash"}
+
 		mock.ExpectExec(`INSERT INTO shortener`).
-			WithArgs("124f", "https://local.site", "1").
-			WillReturnResult(sqlmock.NewResult(1, 1))
+			WithArgs("124f", "https://local.site", "2", (*time.Time)(nil), (*int)(nil), "", "").
+			WillReturnError(pgErr)
+
+		err = repo.SetURL(ctx, model.ShortenURL{ShortURL: "124f", OriginalURL: "https://local.site"})
+		require.ErrorIs(t, err, constants.ErrUniqueIndex)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Same url hash, different url", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), crypto.KeyUserID, "2")
 
-		err = repo.SetURL(ctx, "124f", "https://local.site")
+		// Совпадение md5 у разных URL не нарушает уникальность: её обеспечивает
+		// ограничение исключения по самому URL
+		mock.ExpectExec(`INSERT INTO shortener`).
+			WithArgs("125f", "https://collision.site/b", "2", (*time.Time)(nil), (*int)(nil), "", "").
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+		err = repo.SetURL(ctx, model.ShortenURL{ShortURL: "125f", OriginalURL: "https://collision.site/b"})
 		require.NoError(t, err)
 
+		mock.ExpectQuery(`SELECT id, url FROM shortener WHERE url_hash = md5\(\$1\) AND url = \$1`).
+			WithArgs("https://collision.site/b").
+			WillReturnRows(pgxmock.NewRows([]string{"id", "url"}).AddRow("125f", "https://collision.site/b"))
+
+		id, ok := repo.GetURLByOriginalURL(ctx, "https://collision.site/b")
+		require.True(t, ok)
+		assert.Equal(t, "125f", id)
+
 		require.NoError(t, mock.ExpectationsWereMet())
 	})
 
-	t.Run("Unique constraint violation", func(t *testing.T) {
+	t.Run("Same url", func(t *testing.T) {
 		ctx := context.WithValue(context.Background(), crypto.KeyUserID, "2")
 
-		pgErr := &pgconn.PgError{Code: pgerrcode.UniqueViolation}
+		pgErr := &pgconn.PgError{Code: pgerrcode.ExclusionViolation, ConstraintName: "shortener_url_excl"}
 
 		mock.ExpectExec(`INSERT INTO shortener`).
-			WithArgs("124f", "https://local.site", "2").
+			WithArgs("126f", "https://local.site", "2", (*time.Time)(nil), (*int)(nil), "", "").
 			WillReturnError(pgErr)
 
-		err = repo.SetURL(ctx, "124f", "https://local.site")
+		err = repo.SetURL(ctx, model.ShortenURL{ShortURL: "126f", OriginalURL: "https://local.site"})
 		require.ErrorIs(t, err, constants.ErrUniqueIndex)
+		assert.NotErrorIs(t, err, constants.ErrIDConflict)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ID conflict", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), crypto.KeyUserID, "2")
+
+		pgErr := &pgconn.PgError{Code: pgerrcode.UniqueViolation, ConstraintName: "shortener_pkey"}
+
+		mock.ExpectExec(`INSERT INTO shortener`).
+			WithArgs("124f", "https://other.site", "2", (*time.Time)(nil), (*int)(nil), "", "").
+			WillReturnError(pgErr)
+
+		err = repo.SetURL(ctx, model.ShortenURL{ShortURL: "124f", OriginalURL: "https://other.site"})
+		require.ErrorIs(t, err, constants.ErrIDConflict)
+		assert.NotErrorIs(t, err, constants.ErrUniqueIndex)
 
 		require.NoError(t, mock.ExpectationsWereMet())
 	})
@@ -57,54 +125,166 @@ func TestSetURL(t *testing.T) {
 func TestShortenerRepository_GetURLByID(t *testing.T) {
 	t.Parallel()
 
+	columns := []string{"url", "is_deleted", "is_expired", "clicks_left", "password_hash"}
+
 	tests := []struct {
 		name      string
 		id        string
-		mockRow   *sqlmock.Rows
+		mockRow   *pgxmock.Rows
 		mockError error
+		consume   *pgxmock.Rows
 		wantURL   string
 		wantErr   error
 	}{
 		{
 			name:    "found and not deleted",
 			id:      "123",
-			mockRow: sqlmock.NewRows([]string{"url", "is_deleted"}).AddRow("https://site.com", false),
+			mockRow: pgxmock.NewRows(columns).AddRow("https://site.com", false, false, nil, ""),
 			wantURL: "https://site.com",
 			wantErr: nil,
 		},
 		{
 			name:    "found but deleted",
 			id:      "456",
-			mockRow: sqlmock.NewRows([]string{"url", "is_deleted"}).AddRow("https://site.com", true),
+			mockRow: pgxmock.NewRows(columns).AddRow("https://site.com", true, false, nil, ""),
 			wantErr: constants.ErrIsDeleted,
 		},
+		{
+			name:    "found but expired",
+			id:      "457",
+			mockRow: pgxmock.NewRows(columns).AddRow("https://site.com", false, true, nil, ""),
+			wantErr: constants.ErrExpired,
+		},
+		{
+			name:    "click consumed",
+			id:      "458",
+			mockRow: pgxmock.NewRows(columns).AddRow("https://site.com", false, false, ptr(2), ""),
+			consume: pgxmock.NewRows([]string{"url"}).AddRow("https://site.com"),
+			wantURL: "https://site.com",
+		},
+		{
+			name:    "password required",
+			id:      "461",
+			mockRow: pgxmock.NewRows(columns).AddRow("https://site.com", false, false, ptr(1), "hash"),
+			wantErr: constants.ErrPasswordRequired,
+		},
+		{
+			name:    "no clicks left",
+			id:      "459",
+			mockRow: pgxmock.NewRows(columns).AddRow("https://site.com", false, false, ptr(0), ""),
+			wantErr: constants.ErrNoClicksLeft,
+		},
+		{
+			name:    "last click taken concurrently",
+			id:      "460",
+			mockRow: pgxmock.NewRows(columns).AddRow("https://site.com", false, false, ptr(1), ""),
+			consume: pgxmock.NewRows([]string{"url"}),
+			wantErr: constants.ErrNoClicksLeft,
+		},
 		{
 			name:      "not found",
 			id:        "789",
-			mockError: sql.ErrNoRows,
-			wantErr:   sql.ErrNoRows,
+			mockError: pgx.ErrNoRows,
+			wantErr:   pgx.ErrNoRows,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			db, mock, _ := sqlmock.New()
-			defer db.Close()
+			mock, _ := pgxmock.NewPool()
+			defer mock.Close()
 
-			repo := ShortenerRepository{db: db}
+			repo := ShortenerRepository{db: mock}
 			ctx := context.Background()
 
 			if tt.mockRow != nil {
-				mock.ExpectQuery(`SELECT url, is_deleted FROM shortener WHERE id = \$1`).
+				mock.ExpectQuery(`SELECT COALESCE\(submitted_url, url, ''\), is_deleted, COALESCE\(expires_at <= now\(\), false\), clicks_left, COALESCE\(password_hash, ''\) FROM shortener WHERE id = \$1`).
 					WithArgs(tt.id).
 					WillReturnRows(tt.mockRow)
 			} else {
-				mock.ExpectQuery(`SELECT url, is_deleted FROM shortener WHERE id = \$1`).
+				mock.ExpectQuery(`SELECT COALESCE\(submitted_url, url, ''\), is_deleted, COALESCE\(expires_at <= now\(\), false\), clicks_left, COALESCE\(password_hash, ''\) FROM shortener WHERE id = \$1`).
 					WithArgs(tt.id).
 					WillReturnError(tt.mockError)
 			}
 
-			got, err := repo.GetURLByID(ctx, tt.id)
+			if tt.consume != nil {
+				mock.ExpectQuery(`UPDATE shortener SET clicks_left = clicks_left - 1\s+WHERE id = \$1 AND clicks_left > 0`).
+					WithArgs(tt.id).
+					WillReturnRows(tt.consume)
+			}
+
+			got, err := repo.GetURLByID(ctx, tt.id, nil)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.wantURL, got)
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestShortenerRepository_UnlockURL(t *testing.T) {
+	t.Parallel()
+
+	columns := []string{"url", "is_deleted", "is_expired", "clicks_left", "password_hash"}
+	errWrong := errors.New("wrong")
+
+	tests := []struct {
+		name      string
+		mockRow   *pgxmock.Rows
+		verifyErr error
+		consume   *pgxmock.Rows
+		wantURL   string
+		wantErr   error
+	}{
+		{
+			name:    "password accepted",
+			mockRow: pgxmock.NewRows(columns).AddRow("https://site.com", false, false, nil, "hash"),
+			wantURL: "https://site.com",
+		},
+		{
+			name:    "password accepted and click consumed",
+			mockRow: pgxmock.NewRows(columns).AddRow("https://site.com", false, false, ptr(1), "hash"),
+			consume: pgxmock.NewRows([]string{"url"}).AddRow("https://site.com"),
+			wantURL: "https://site.com",
+		},
+		{
+			name:      "password rejected",
+			mockRow:   pgxmock.NewRows(columns).AddRow("https://site.com", false, false, ptr(1), "hash"),
+			verifyErr: errWrong,
+			wantErr:   errWrong,
+		},
+		{
+			name:    "deleted link is not verified",
+			mockRow: pgxmock.NewRows(columns).AddRow("https://site.com", true, false, nil, "hash"),
+			wantErr: constants.ErrIsDeleted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, _ := pgxmock.NewPool()
+			defer mock.Close()
+
+			repo := ShortenerRepository{db: mock}
+
+			mock.ExpectQuery(`SELECT COALESCE\(submitted_url, url, ''\), is_deleted, COALESCE\(expires_at <= now\(\), false\), clicks_left, COALESCE\(password_hash, ''\) FROM shortener WHERE id = \$1`).
+				WithArgs("abc").
+				WillReturnRows(tt.mockRow)
+
+			if tt.consume != nil {
+				mock.ExpectQuery(`UPDATE shortener SET clicks_left = clicks_left - 1\s+WHERE id = \$1 AND clicks_left > 0`).
+					WithArgs("abc").
+					WillReturnRows(tt.consume)
+			}
+
+			got, err := repo.UnlockURL(context.Background(), "abc", func(hash string) error {
+				assert.Equal(t, "hash", hash)
+				return tt.verifyErr
+			}, nil)
 			if tt.wantErr != nil {
 				require.ErrorIs(t, err, tt.wantErr)
 			} else {
@@ -123,7 +303,7 @@ func TestShortenerRepository_GetURLByOriginalURL(t *testing.T) {
 	tests := []struct {
 		name      string
 		url       string
-		mockRow   *sqlmock.Rows
+		mockRow   *pgxmock.Rows
 		mockError error
 		wantID    string
 		wantFound bool
@@ -131,32 +311,32 @@ func TestShortenerRepository_GetURLByOriginalURL(t *testing.T) {
 		{
 			name:      "found",
 			url:       "https://site.com",
-			mockRow:   sqlmock.NewRows([]string{"id", "url"}).AddRow("abc", "https://site.com"),
+			mockRow:   pgxmock.NewRows([]string{"id", "url"}).AddRow("abc", "https://site.com"),
 			wantID:    "abc",
 			wantFound: true,
 		},
 		{
 			name:      "not found",
 			url:       "https://missing.com",
-			mockError: sql.ErrNoRows,
+			mockError: pgx.ErrNoRows,
 			wantFound: false,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			db, mock, _ := sqlmock.New()
-			defer db.Close()
+			mock, _ := pgxmock.NewPool()
+			defer mock.Close()
 
-			repo := ShortenerRepository{db: db}
+			repo := ShortenerRepository{db: mock}
 			ctx := context.Background()
 
 			if tt.mockRow != nil {
-				mock.ExpectQuery(`SELECT id, url FROM shortener WHERE url = \$1`).
+				mock.ExpectQuery(`SELECT id, url FROM shortener WHERE url_hash = md5\(\$1\) AND url = \$1`).
 					WithArgs(tt.url).
 					WillReturnRows(tt.mockRow)
 			} else {
-				mock.ExpectQuery(`SELECT id, url FROM shortener WHERE url = \$1`).
+				mock.ExpectQuery(`SELECT id, url FROM shortener WHERE url_hash = md5\(\$1\) AND url = \$1`).
 					WithArgs(tt.url).
 					WillReturnError(tt.mockError)
 			}
@@ -176,40 +356,42 @@ func TestShortenerRepository_GetURLSByUserID(t *testing.T) {
 	tests := []struct {
 		name      string
 		userID    string
-		mockRows  *sqlmock.Rows
+		mockRows  *pgxmock.Rows
 		mockError error
-		wantMap   map[string]string
+		want      []model.ShortenURL
 	}{
 		{
 			name:   "multiple urls",
 			userID: "1",
-			mockRows: sqlmock.NewRows([]string{"id", "url"}).
-				AddRow("id1", "http://1").
-				AddRow("id2", "http://2"),
-			wantMap: map[string]string{"id1": "http://1", "id2": "http://2"},
+			mockRows: pgxmock.NewRows([]string{"id", "url", "submitted_url", "clicks_left"}).
+				AddRow("id1", "http://1/", "HTTP://1", nil).
+				AddRow("id2", "http://2", "", ptr(3)),
+			want: []model.ShortenURL{
+				{ShortURL: "id1", OriginalURL: "http://1/", SubmittedURL: "HTTP://1", UserID: "1"},
+				{ShortURL: "id2", OriginalURL: "http://2", UserID: "1", ClicksLeft: ptr(3)},
+			},
 		},
 		{
 			name:      "query error",
 			userID:    "2",
 			mockError: errors.New("db fail"),
-			wantMap:   nil,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			db, mock, _ := sqlmock.New()
-			defer db.Close()
+			mock, _ := pgxmock.NewPool()
+			defer mock.Close()
 
-			repo := ShortenerRepository{db: db}
+			repo := ShortenerRepository{db: mock}
 			ctx := context.Background()
 
 			if tt.mockRows != nil {
-				mock.ExpectQuery(`SELECT id, url FROM shortener WHERE user_id = \$1`).
+				mock.ExpectQuery(`SELECT id, url, COALESCE\(submitted_url, ''\), clicks_left FROM shortener WHERE user_id = \$1`).
 					WithArgs(tt.userID).
 					WillReturnRows(tt.mockRows)
 			} else {
-				mock.ExpectQuery(`SELECT id, url FROM shortener WHERE user_id = \$1`).
+				mock.ExpectQuery(`SELECT id, url, COALESCE\(submitted_url, ''\), clicks_left FROM shortener WHERE user_id = \$1`).
 					WithArgs(tt.userID).
 					WillReturnError(tt.mockError)
 			}
@@ -220,7 +402,7 @@ func TestShortenerRepository_GetURLSByUserID(t *testing.T) {
 				require.Error(t, err)
 			} else {
 				require.NoError(t, err)
-				assert.Equal(t, tt.wantMap, result)
+				assert.Equal(t, tt.want, result)
 			}
 
 			require.NoError(t, mock.ExpectationsWereMet())
@@ -231,61 +413,498 @@ func TestShortenerRepository_GetURLSByUserID(t *testing.T) {
 func TestShortenerRepository_InsertURLs(t *testing.T) {
 	t.Parallel()
 
-	db, mock, _ := sqlmock.New()
-	defer db.Close()
+	mock, _ := pgxmock.NewPool()
+	defer mock.Close()
 
-	repo := ShortenerRepository{db: db}
+	repo := ShortenerRepository{db: mock}
 	ctx := context.WithValue(context.Background(), crypto.KeyUserID, "user-1")
 
-	mock.ExpectBegin()
-
-	stmt := mock.ExpectPrepare(`INSERT INTO shortener`)
-
-	stmt.ExpectExec().
-		WithArgs("abc", "http://1", "user-1").
-		WillReturnResult(sqlmock.NewResult(1, 1))
-
-	stmt.ExpectExec().
-		WithArgs("def", "http://2", "user-1").
-		WillReturnResult(sqlmock.NewResult(1, 1))
-
-	mock.ExpectCommit()
-
-	err := repo.InsertURLs(ctx, []model.ShortenerURLMapping{
-		{CorrelationID: "abc", OriginalURL: "http://1"},
-		{CorrelationID: "def", OriginalURL: "http://2"},
+	// Вторая запись с уже сокращённым URL, третья — с занятым ID
+	mock.ExpectQuery(`WITH input AS .* unnest\(\$1::VARCHAR\[\], \$2::TEXT\[\], \$4::TIMESTAMPTZ\[\], \$5::INTEGER\[\], \$6::TEXT\[\], \$7::TEXT\[\]\)\s+WITH ORDINALITY .*ON CONFLICT DO NOTHING\s+RETURNING id, url`).
+		WithArgs([]string{"abc", "def", "ghi"}, []string{"http://1", "http://2", "http://3"}, "user-1", []*time.Time{nil, nil, nil}, []*int{nil, nil, nil}, []string{"", "", ""}, []string{"", "", ""}).
+		WillReturnRows(pgxmock.NewRows([]string{"created", "existing_id"}).
+			AddRow(true, nil).
+			AddRow(false, ptr("old")).
+			AddRow(false, nil))
+
+	results, err := repo.InsertURLs(ctx, []model.BatchURL{
+		{ID: "abc", OriginalURL: "http://1"},
+		{ID: "def", OriginalURL: "http://2"},
+		{ID: "ghi", OriginalURL: "http://3"},
 	})
 	require.NoError(t, err)
+	assert.Equal(t, []model.BatchURLResult{
+		{ID: "abc"},
+		{ID: "old", Err: constants.ErrUniqueIndex},
+		{ID: "ghi", Err: constants.ErrIDConflict},
+	}, results)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
+func ptr[T any](v T) *T {
+	return &v
+}
+
 func TestShortenerRepository_DeleteUserURLS(t *testing.T) {
 	t.Parallel()
 
-	db, mock, _ := sqlmock.New()
-	defer db.Close()
+	mock, _ := pgxmock.NewPool()
+	defer mock.Close()
 
-	repo := ShortenerRepository{db: db}
+	repo := ShortenerRepository{db: mock}
 	ctx := context.Background()
 
 	mock.ExpectBegin()
 
-	stmt := mock.ExpectPrepare(`UPDATE shortener SET is_deleted = true`)
+	mock.ExpectExec(`UPDATE shortener SET is_deleted = true, deleted_at = COALESCE\(deleted_at, now\(\)\) WHERE user_id = \$1 AND id = ANY\(\$2\)`).
+		WithArgs("u1", []string{"id1", "id3"}).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 2))
 
-	stmt.ExpectExec().
-		WithArgs("u1", "id1").
-		WillReturnResult(sqlmock.NewResult(1, 1))
-
-	stmt.ExpectExec().
-		WithArgs("u1", "id2").
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE shortener SET is_deleted = true, deleted_at = COALESCE\(deleted_at, now\(\)\) WHERE user_id = \$1 AND id = ANY\(\$2\)`).
+		WithArgs("u2", []string{"id2"}).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
 
 	mock.ExpectCommit()
 
 	err := repo.DeleteUserURLS(ctx, []model.URLToDelete{
 		{ShortLink: "id1", UserID: "u1"},
-		{ShortLink: "id2", UserID: "u1"},
+		{ShortLink: "id2", UserID: "u2"},
+		{ShortLink: "id3", UserID: "u1"},
 	})
 	require.NoError(t, err)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestShortenerRepository_UpdateURL(t *testing.T) {
+	t.Parallel()
+
+	columns := []string{"user_id", "url", "submitted_url", "is_deleted"}
+	selectOwner := `SELECT COALESCE\(user_id, ''\), COALESCE\(url, ''\), COALESCE\(submitted_url, ''\), is_deleted FROM shortener WHERE id = \$1 FOR UPDATE`
+
+	tests := []struct {
+		name      string
+		submitted string
+		owner     *pgxmock.Rows
+		ownerErr  error
+		updateErr error
+		history   string
+		wantErr   error
+	}{
+		{
+			name:    "updated",
+			owner:   pgxmock.NewRows(columns).AddRow("u1", "https://a.com", "", false),
+			history: "https://a.com",
+		},
+		{
+			name:    "submitted url kept in history",
+			owner:   pgxmock.NewRows(columns).AddRow("u1", "https://a.com", "https://a.com/", false),
+			history: "https://a.com/",
+		},
+		{
+			name:  "same url",
+			owner: pgxmock.NewRows(columns).AddRow("u1", "https://b.com", "", false),
+		},
+		{
+			name:      "same url in another form",
+			submitted: "https://b.com/",
+			owner:     pgxmock.NewRows(columns).AddRow("u1", "https://b.com", "", false),
+			history:   "https://b.com",
+		},
+		{
+			name:     "not found",
+			ownerErr: pgx.ErrNoRows,
+			wantErr:  constants.ErrNotFound,
+		},
+		{
+			name:    "another owner",
+			owner:   pgxmock.NewRows(columns).AddRow("u2", "https://a.com", "", false),
+			wantErr: constants.ErrNotOwner,
+		},
+		{
+			name:    "deleted",
+			owner:   pgxmock.NewRows(columns).AddRow("u1", "https://a.com", "", true),
+			wantErr: constants.ErrIsDeleted,
+		},
+		{
+			name:      "url taken",
+			owner:     pgxmock.NewRows(columns).AddRow("u1", "https://a.com", "", false),
+			updateErr: &pgconn.PgError{Code: pgerrcode.UniqueViolation, ConstraintName: "idx_url_hash"},
+			wantErr:   constants.ErrUniqueIndex,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			require.NoError(t, err)
+			defer mock.Close()
+
+			repo := ShortenerRepository{db: mock}
+
+			mock.ExpectBegin()
+			if tt.owner != nil {
+				mock.ExpectQuery(selectOwner).WithArgs("abc").WillReturnRows(tt.owner)
+			} else {
+				mock.ExpectQuery(selectOwner).WithArgs("abc").WillReturnError(tt.ownerErr)
+			}
+
+			switch {
+			case tt.updateErr != nil:
+				mock.ExpectExec(`UPDATE shortener SET url = \$2, submitted_url = NULLIF\(\$3, ''\) WHERE id = \$1`).
+					WithArgs("abc", "https://b.com", tt.submitted).
+					WillReturnError(tt.updateErr)
+				mock.ExpectRollback()
+			case tt.history != "":
+				mock.ExpectExec(`UPDATE shortener SET url = \$2, submitted_url = NULLIF\(\$3, ''\) WHERE id = \$1`).
+					WithArgs("abc", "https://b.com", tt.submitted).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				mock.ExpectExec(`INSERT INTO shortener_history \(short_id, version, url\)\s+SELECT \$1, COALESCE\(MAX\(version\), 0\) \+ 1, \$2`).
+					WithArgs("abc", tt.history).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				mock.ExpectCommit()
+			default:
+				mock.ExpectRollback()
+			}
+
+			err = repo.UpdateURL(context.Background(), "abc", "u1", "https://b.com", tt.submitted)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestShortenerRepository_GetURLHistory(t *testing.T) {
+	t.Parallel()
+
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := ShortenerRepository{db: mock}
+	changedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT COALESCE\(user_id, ''\), COALESCE\(url, ''\), COALESCE\(submitted_url, ''\), is_deleted FROM shortener WHERE id = \$1`).
+		WithArgs("abc").
+		WillReturnRows(pgxmock.NewRows([]string{"user_id", "url", "submitted_url", "is_deleted"}).AddRow("u1", "https://c.com", "", false))
+	mock.ExpectQuery(`SELECT version, url, changed_at FROM shortener_history WHERE short_id = \$1 ORDER BY version`).
+		WithArgs("abc").
+		WillReturnRows(pgxmock.NewRows([]string{"version", "url", "changed_at"}).
+			AddRow(1, "https://a.com", changedAt).
+			AddRow(2, "https://b.com", changedAt))
+
+	history, err := repo.GetURLHistory(context.Background(), "abc", "u1")
+	require.NoError(t, err)
+	assert.Equal(t, []model.URLEdit{
+		{Version: 1, OriginalURL: "https://a.com", ChangedAt: changedAt},
+		{Version: 2, OriginalURL: "https://b.com", ChangedAt: changedAt},
+	}, history)
+
+	mock.ExpectQuery(`SELECT COALESCE\(user_id, ''\), COALESCE\(url, ''\), COALESCE\(submitted_url, ''\), is_deleted FROM shortener WHERE id = \$1`).
+		WithArgs("missing").
+		WillReturnError(pgx.ErrNoRows)
+
+	_, err = repo.GetURLHistory(context.Background(), "missing", "u1")
+	require.ErrorIs(t, err, constants.ErrNotFound)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestShortenerRepository_UndeleteURL(t *testing.T) {
+	t.Parallel()
+
+	columns := []string{"user_id", "is_deleted", "is_purged", "deleted_at", "is_expired"}
+	selectLink := `SELECT COALESCE\(user_id, ''\), is_deleted, url IS NULL, deleted_at, COALESCE\(expires_at <= now\(\), false\)\s+FROM shortener WHERE id = \$1 FOR UPDATE`
+
+	deletedAfter := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	recent := deletedAfter.Add(time.Hour)
+	old := deletedAfter.Add(-time.Hour)
+
+	tests := []struct {
+		name     string
+		row      *pgxmock.Rows
+		rowErr   error
+		restored bool
+		wantErr  error
+	}{
+		{
+			name:     "restored",
+			row:      pgxmock.NewRows(columns).AddRow("u1", true, false, &recent, false),
+			restored: true,
+		},
+		{
+			name: "not deleted",
+			row:  pgxmock.NewRows(columns).AddRow("u1", false, false, nil, false),
+		},
+		{
+			name:    "not found",
+			rowErr:  pgx.ErrNoRows,
+			wantErr: constants.ErrNotFound,
+		},
+		{
+			name:    "another owner",
+			row:     pgxmock.NewRows(columns).AddRow("u2", true, false, &recent, false),
+			wantErr: constants.ErrNotOwner,
+		},
+		{
+			name:    "window passed",
+			row:     pgxmock.NewRows(columns).AddRow("u1", true, false, &old, false),
+			wantErr: constants.ErrRestoreWindowPassed,
+		},
+		{
+			name:    "purged",
+			row:     pgxmock.NewRows(columns).AddRow("u1", true, true, &recent, false),
+			wantErr: constants.ErrRestoreWindowPassed,
+		},
+		{
+			name:    "expired",
+			row:     pgxmock.NewRows(columns).AddRow("u1", true, false, &recent, true),
+			wantErr: constants.ErrExpired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			require.NoError(t, err)
+			defer mock.Close()
+
+			repo := ShortenerRepository{db: mock}
+
+			mock.ExpectBegin()
+			if tt.row != nil {
+				mock.ExpectQuery(selectLink).WithArgs("abc").WillReturnRows(tt.row)
+			} else {
+				mock.ExpectQuery(selectLink).WithArgs("abc").WillReturnError(tt.rowErr)
+			}
+
+			if tt.restored {
+				mock.ExpectExec(`UPDATE shortener SET is_deleted = false, deleted_at = NULL WHERE id = \$1`).
+					WithArgs("abc").
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			err = repo.UndeleteURL(context.Background(), "abc", "u1", deletedAfter)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestShortenerRepository_GetDeletedURLs(t *testing.T) {
+	t.Parallel()
+
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := ShortenerRepository{db: mock}
+	deletedAfter := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	deletedAt := deletedAfter.Add(time.Hour)
+
+	mock.ExpectQuery(`SELECT id, url, deleted_at FROM shortener\s+WHERE user_id = \$1 AND is_deleted AND url IS NOT NULL AND deleted_at >= \$2`).
+		WithArgs("u1", deletedAfter).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "url", "deleted_at"}).AddRow("abc", "https://a.com", &deletedAt))
+
+	items, err := repo.GetDeletedURLs(context.Background(), "u1", deletedAfter)
+	require.NoError(t, err)
+	assert.Equal(t, []model.ShortenURL{{
+		ShortURL:    "abc",
+		OriginalURL: "https://a.com",
+		UserID:      "u1",
+		IsDeleted:   true,
+		DeletedAt:   &deletedAt,
+	}}, items)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestShortenerRepository_ExpireURLs(t *testing.T) {
+	t.Parallel()
+
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := ShortenerRepository{db: mock}
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectExec(`UPDATE shortener SET is_deleted = true, deleted_at = expires_at WHERE id IN \(\s*SELECT id FROM shortener WHERE NOT is_deleted AND expires_at <= \$1 LIMIT \$2`).
+		WithArgs(now, 100).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 4))
+
+	expired, err := repo.ExpireURLs(context.Background(), now, 100)
+	require.NoError(t, err)
+	assert.Equal(t, 4, expired)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestShortenerRepository_PurgeDeletedURLs(t *testing.T) {
+	t.Parallel()
+
+	before := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		reuseIDs bool
+		query    string
+		mockErr  error
+		want     int
+	}{
+		{
+			name:     "delete rows",
+			reuseIDs: true,
+			query:    `DELETE FROM shortener WHERE id IN \(\s*SELECT id FROM shortener WHERE is_deleted AND deleted_at < \$1 LIMIT \$2`,
+			want:     3,
+		},
+		{
+			name:     "keep ids",
+			reuseIDs: false,
+			query:    `UPDATE shortener SET url = NULL WHERE id IN \(\s*SELECT id FROM shortener WHERE is_deleted AND deleted_at < \$1 AND url IS NOT NULL LIMIT \$2`,
+			want:     2,
+		},
+		{
+			name:     "db error",
+			reuseIDs: true,
+			query:    `DELETE FROM shortener`,
+			mockErr:  errors.New("db error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			require.NoError(t, err)
+			defer mock.Close()
+
+			repo := ShortenerRepository{db: mock}
+
+			exp := mock.ExpectExec(tt.query).WithArgs(before, 100)
+			if tt.mockErr != nil {
+				exp.WillReturnError(tt.mockErr)
+			} else {
+				exp.WillReturnResult(pgxmock.NewResult("DELETE", int64(tt.want)))
+			}
+
+			purged, err := repo.PurgeDeletedURLs(context.Background(), before, 100, tt.reuseIDs)
+			if tt.mockErr != nil {
+				require.ErrorIs(t, err, tt.mockErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.want, purged)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+// newBenchRepository подключается к реальной базе из TEST_DATABASE_DSN.
+// Без неё бенчмарки пропускаются: на pgxmock сравнивать производительность бессмысленно.
+func newBenchRepository(b *testing.B) *ShortenerRepository {
+	b.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		b.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	repo, err := NewShortenerRepository(config.Config{DataBaseDSN: dsn})
+	require.NoError(b, err)
+	b.Cleanup(func() { repo.Close() })
+
+	return repo
+}
+
+func benchURLs(run, size int) []model.BatchURL {
+	urls := make([]model.BatchURL, size)
+	for i := range urls {
+		id := fmt.Sprintf("bench-%d-%d-%d", time.Now().UnixNano(), run, i)
+		urls[i] = model.BatchURL{ID: id, OriginalURL: "https://bench.local/" + id}
+	}
+
+	return urls
+}
+
+// insertRowByRow — прежняя реализация вставки: отдельный INSERT на каждую запись.
+func insertRowByRow(ctx context.Context, repo *ShortenerRepository, urls []model.BatchURL) error {
+	tx, err := repo.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, v := range urls {
+		_, err = tx.Exec(ctx,
+			"INSERT INTO shortener (id, url, user_id) VALUES($1, $2, $3) ON CONFLICT DO NOTHING",
+			v.ID, v.OriginalURL, "bench")
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func BenchmarkShortenerRepository_InsertURLs(b *testing.B) {
+	repo := newBenchRepository(b)
+	ctx := context.WithValue(context.Background(), crypto.KeyUserID, "bench")
+
+	for _, size := range []int{100, 1000} {
+		b.Run(fmt.Sprintf("row-by-row/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				urls := benchURLs(i, size)
+				if err := insertRowByRow(ctx, repo, urls); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("set-based/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				urls := benchURLs(i, size)
+				if _, err := repo.InsertURLs(ctx, urls); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkShortenerRepository_DeleteUserURLS(b *testing.B) {
+	repo := newBenchRepository(b)
+	ctx := context.WithValue(context.Background(), crypto.KeyUserID, "bench")
+
+	const size = 1000
+
+	b.StopTimer()
+	for i := 0; i < b.N; i++ {
+		urls := benchURLs(i, size)
+		if _, err := repo.InsertURLs(ctx, urls); err != nil {
+			b.Fatal(err)
+		}
+
+		items := make([]model.URLToDelete, len(urls))
+		for j, v := range urls {
+			items[j] = model.URLToDelete{ShortLink: v.ID, UserID: "bench"}
+		}
+
+		b.StartTimer()
+		if err := repo.DeleteUserURLS(context.Background(), items); err != nil {
+			b.Fatal(err)
+		}
+		b.StopTimer()
+	}
+}
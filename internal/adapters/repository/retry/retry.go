@@ -0,0 +1,172 @@
+// Package retry предоставляет декоратор репозитория сокращённых URL,
+// повторяющий вызовы хранилища при временных ошибках: обрывах соединения,
+// переключении PostgreSQL на реплику, конфликтах сериализации.
+//
+// Декоратор не зависит от конкретного хранилища и оборачивает
+// любую реализацию service.ShortenerRepository.
+package retry
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+
+	"github.com/bubaew95/yandex-go-learn/config"
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/constants"
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/logger"
+)
+
+// Policy определяет, сколько раз и с какими паузами повторять операцию.
+type Policy struct {
+	// MaxAttempts — число попыток, включая первую. Значение 1 отключает повторы.
+	MaxAttempts int
+
+	// InitialBackoff — пауза перед первым повтором; каждая следующая вдвое длиннее.
+	InitialBackoff time.Duration
+
+	// MaxBackoff — верхняя граница паузы между попытками.
+	MaxBackoff time.Duration
+}
+
+// policyFromConfig собирает политику для операции op: значения из
+// RetryOperations[op] имеют приоритет над общими настройками.
+func policyFromConfig(cfg config.Config, op string) Policy {
+	override := cfg.RetryOperations[op]
+
+	return Policy{
+		MaxAttempts:    max(cmp.Or(override.MaxAttempts, cfg.RetryMaxAttempts), 1),
+		InitialBackoff: cmp.Or(override.InitialBackoff.Duration, cfg.RetryInitialBackoff.Duration),
+		MaxBackoff:     cmp.Or(override.MaxBackoff.Duration, cfg.RetryMaxBackoff.Duration),
+	}
+}
+
+// backoff возвращает паузу перед попыткой attempt (начиная с 1) со случайным
+// разбросом в пределах [d/2, d], чтобы экземпляры сервиса не повторяли запросы синхронно.
+func (p Policy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
+
+// IsRetryable сообщает, имеет ли смысл повторить операцию, завершившуюся ошибкой err.
+//
+// Повторяются ошибки соединения (класс 08 и отключение сервера в PostgreSQL,
+// сетевые ошибки, разрыв соединения) и ошибки сериализации (класс 40).
+// Нарушения ограничений, «не найдено», удалённые ссылки и отмена контекста не повторяются.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if errors.Is(err, constants.ErrUniqueIndex) ||
+		errors.Is(err, constants.ErrIDConflict) ||
+		errors.Is(err, constants.ErrIsDeleted) ||
+		errors.Is(err, constants.ErrNotFound) ||
+		errors.Is(err, constants.ErrNotOwner) ||
+		errors.Is(err, constants.ErrRestoreWindowPassed) ||
+		errors.Is(err, constants.ErrExpired) ||
+		errors.Is(err, constants.ErrNoClicksLeft) ||
+		errors.Is(err, constants.ErrPasswordRequired) ||
+		errors.Is(err, constants.ErrWrongPassword) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgerrcode.IsIntegrityConstraintViolation(pgErr.Code):
+			return false
+		case pgerrcode.IsConnectionException(pgErr.Code),
+			pgerrcode.IsTransactionRollback(pgErr.Code):
+			return true
+		case pgErr.Code == pgerrcode.AdminShutdown,
+			pgErr.Code == pgerrcode.CrashShutdown,
+			pgErr.Code == pgerrcode.CannotConnectNow:
+			return true
+		default:
+			return false
+		}
+	}
+
+	if pgconn.SafeToRetry(err) {
+		return true
+	}
+
+	if errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	// syscall.Errno тоже реализует net.Error, поэтому проверяется именно
+	// *net.OpError: ошибки файловой системы повторять бессмысленно.
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+
+	var temporary interface{ Temporary() bool }
+	if errors.As(err, &temporary) {
+		return temporary.Temporary()
+	}
+
+	return false
+}
+
+// do выполняет fn согласно политике, повторяя её, пока ошибка классифицируется
+// как временная. Повтор не начинается, если пауза не укладывается в дедлайн ctx.
+func do(ctx context.Context, op string, policy Policy, classify func(error) bool, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= policy.MaxAttempts || !classify(err) {
+			return err
+		}
+
+		delay := policy.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+
+		logger.Log.Debug("Retrying storage operation",
+			zap.String("operation", op),
+			zap.Int("attempt", attempt),
+			zap.Duration("delay", delay),
+			zap.Error(err),
+		)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
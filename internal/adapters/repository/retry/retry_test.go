@@ -0,0 +1,253 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bubaew95/yandex-go-learn/config"
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/constants"
+	"github.com/bubaew95/yandex-go-learn/internal/core/model"
+	"github.com/bubaew95/yandex-go-learn/internal/core/service"
+)
+
+func TestIsRetryable(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "connection failure", err: &pgconn.PgError{Code: pgerrcode.ConnectionFailure}, want: true},
+		{name: "serialization failure", err: &pgconn.PgError{Code: pgerrcode.SerializationFailure}, want: true},
+		{name: "deadlock", err: &pgconn.PgError{Code: pgerrcode.DeadlockDetected}, want: true},
+		{name: "admin shutdown", err: &pgconn.PgError{Code: pgerrcode.AdminShutdown}, want: true},
+		{name: "unique violation", err: &pgconn.PgError{Code: pgerrcode.UniqueViolation}, want: false},
+		{name: "syntax error", err: &pgconn.PgError{Code: pgerrcode.SyntaxError}, want: false},
+		{name: "connection reset", err: fmt.Errorf("read: %w", syscall.ECONNRESET), want: true},
+		{name: "network error", err: &net.OpError{Op: "dial", Err: errors.New("refused")}, want: true},
+		{name: "disk full", err: &os.PathError{Op: "write", Path: "data.json", Err: syscall.ENOSPC}, want: false},
+		{name: "unique index", err: constants.ErrUniqueIndex, want: false},
+		{name: "id conflict", err: constants.ErrIDConflict, want: false},
+		{name: "deleted", err: constants.ErrIsDeleted, want: false},
+		{name: "no rows", err: pgx.ErrNoRows, want: false},
+		{name: "canceled", err: context.Canceled, want: false},
+		{name: "deadline", err: fmt.Errorf("query: %w", context.DeadlineExceeded), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsRetryable(tt.err))
+		})
+	}
+}
+
+func TestPolicy_Backoff(t *testing.T) {
+	t.Parallel()
+
+	p := Policy{MaxAttempts: 10, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{attempt: 1, max: 10 * time.Millisecond},
+		{attempt: 2, max: 20 * time.Millisecond},
+		{attempt: 3, max: 40 * time.Millisecond},
+		{attempt: 4, max: 50 * time.Millisecond},
+		{attempt: 50, max: 50 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			d := p.backoff(tt.attempt)
+			assert.GreaterOrEqual(t, d, tt.max/2)
+			assert.LessOrEqual(t, d, tt.max)
+		}
+	}
+}
+
+func TestPolicyFromConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Config{
+		RetryMaxAttempts:    3,
+		RetryInitialBackoff: config.Duration{Duration: time.Millisecond},
+		RetryMaxBackoff:     config.Duration{Duration: time.Second},
+		RetryOperations: map[string]config.RetryPolicy{
+			OpSetURL: {MaxAttempts: 1},
+		},
+	}
+
+	assert.Equal(t, Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Second}, policyFromConfig(cfg, OpGetURLSByUserID))
+	assert.Equal(t, Policy{MaxAttempts: 1, InitialBackoff: time.Millisecond, MaxBackoff: time.Second}, policyFromConfig(cfg, OpSetURL))
+	assert.Equal(t, 1, policyFromConfig(config.Config{}, OpGetURLSByUserID).MaxAttempts)
+}
+
+// flakyRepository возвращает заданные ошибки по очереди, затем успешный результат.
+type flakyRepository struct {
+	service.ShortenerRepository
+	errs  []error
+	calls int
+}
+
+func (f *flakyRepository) next() error {
+	f.calls++
+	if len(f.errs) == 0 {
+		return nil
+	}
+
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+func (f *flakyRepository) GetURLByID(ctx context.Context, id string, check func(url string) error) (string, error) {
+	if err := f.next(); err != nil {
+		return "", err
+	}
+
+	return "https://example.com", nil
+}
+
+func (f *flakyRepository) UnlockURL(ctx context.Context, id string, verify func(passwordHash string) error, check func(url string) error) (string, error) {
+	if err := f.next(); err != nil {
+		return "", err
+	}
+
+	return "https://example.com", nil
+}
+
+func (f *flakyRepository) GetURLSByUserID(ctx context.Context, userID string) ([]model.ShortenURL, error) {
+	if err := f.next(); err != nil {
+		return nil, err
+	}
+
+	return []model.ShortenURL{{ShortURL: "abc", OriginalURL: "https://example.com"}}, nil
+}
+
+func (f *flakyRepository) SetURL(ctx context.Context, link model.ShortenURL) error {
+	return f.next()
+}
+
+func (f *flakyRepository) InsertURLs(ctx context.Context, urls []model.BatchURL) ([]model.BatchURLResult, error) {
+	if err := f.next(); err != nil {
+		return nil, err
+	}
+
+	return []model.BatchURLResult{{ID: "abc"}}, nil
+}
+
+func newTestRepository(next service.ShortenerRepository, attempts int) *ShortenerRepository {
+	return NewShortenerRepository(next, config.Config{
+		RetryMaxAttempts:    attempts,
+		RetryInitialBackoff: config.Duration{Duration: time.Millisecond},
+		RetryMaxBackoff:     config.Duration{Duration: 2 * time.Millisecond},
+		RetryOperations: map[string]config.RetryPolicy{
+			OpSetURL: {MaxAttempts: 1},
+		},
+	})
+}
+
+func TestShortenerRepository_RetriesTransientErrors(t *testing.T) {
+	t.Parallel()
+
+	transient := &pgconn.PgError{Code: pgerrcode.ConnectionFailure}
+	next := &flakyRepository{errs: []error{transient, transient}}
+	repo := newTestRepository(next, 3)
+
+	urls, err := repo.GetURLSByUserID(context.Background(), "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, []model.ShortenURL{{ShortURL: "abc", OriginalURL: "https://example.com"}}, urls)
+	assert.Equal(t, 3, next.calls)
+
+	next.errs = []error{transient}
+	results, err := repo.InsertURLs(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []model.BatchURLResult{{ID: "abc"}}, results)
+}
+
+func TestShortenerRepository_GivesUp(t *testing.T) {
+	t.Parallel()
+
+	transient := &pgconn.PgError{Code: pgerrcode.SerializationFailure}
+	next := &flakyRepository{errs: []error{transient, transient, transient, transient}}
+	repo := newTestRepository(next, 3)
+
+	_, err := repo.GetURLSByUserID(context.Background(), "user-1")
+	require.ErrorIs(t, err, transient)
+	assert.Equal(t, 3, next.calls)
+}
+
+func TestShortenerRepository_DoesNotRetryPermanentErrors(t *testing.T) {
+	t.Parallel()
+
+	next := &flakyRepository{errs: []error{constants.ErrUniqueIndex}}
+	repo := newTestRepository(next, 5)
+
+	_, err := repo.GetURLSByUserID(context.Background(), "user-1")
+	require.ErrorIs(t, err, constants.ErrUniqueIndex)
+	assert.Equal(t, 1, next.calls)
+}
+
+func TestShortenerRepository_PerOperationPolicy(t *testing.T) {
+	t.Parallel()
+
+	next := &flakyRepository{errs: []error{syscall.ECONNRESET}}
+	repo := newTestRepository(next, 5)
+
+	// Для SetURL повторы отключены в RetryOperations
+	err := repo.SetURL(context.Background(), model.ShortenURL{ShortURL: "abc", OriginalURL: "https://example.com"})
+	require.ErrorIs(t, err, syscall.ECONNRESET)
+	assert.Equal(t, 1, next.calls)
+}
+
+func TestShortenerRepository_DoesNotRetryFollow(t *testing.T) {
+	t.Parallel()
+
+	transient := &pgconn.PgError{Code: pgerrcode.ConnectionFailure}
+	next := &flakyRepository{errs: []error{transient}}
+	repo := newTestRepository(next, 5)
+
+	// Запрос мог списать переход до обрыва соединения: повтор списал бы второй
+	_, err := repo.GetURLByID(context.Background(), "abc", nil)
+	require.ErrorIs(t, err, transient)
+	assert.Equal(t, 1, next.calls)
+
+	next.errs = []error{syscall.ECONNRESET}
+	_, err = repo.UnlockURL(context.Background(), "abc", func(string) error { return nil }, nil)
+	require.ErrorIs(t, err, syscall.ECONNRESET)
+	assert.Equal(t, 2, next.calls)
+}
+
+func TestShortenerRepository_RespectsDeadline(t *testing.T) {
+	t.Parallel()
+
+	next := &flakyRepository{errs: []error{syscall.ECONNRESET, syscall.ECONNRESET}}
+	repo := NewShortenerRepository(next, config.Config{
+		RetryMaxAttempts:    5,
+		RetryInitialBackoff: config.Duration{Duration: time.Minute},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := repo.GetURLSByUserID(ctx, "user-1")
+	require.ErrorIs(t, err, syscall.ECONNRESET)
+	assert.Equal(t, 1, next.calls)
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+}
@@ -0,0 +1,189 @@
+package retry
+
+import (
+	"context"
+	"time"
+
+	"github.com/bubaew95/yandex-go-learn/config"
+	"github.com/bubaew95/yandex-go-learn/internal/core/model"
+	"github.com/bubaew95/yandex-go-learn/internal/core/service"
+)
+
+// ShortenerRepository оборачивает репозиторий и повторяет его вызовы
+// при временных ошибках согласно политике каждой операции.
+//
+// Операции без ошибки в результате (GetURLByOriginalURL), Ping и Close
+// передаются напрямую: проверка доступности должна отражать реальное состояние хранилища.
+// Переходы по ссылке (GetURLByID, UnlockURL) тоже не повторяются: они списывают переход
+// у ссылки с лимитом, и повтор после оборванного, но зафиксированного запроса списал бы второй.
+type ShortenerRepository struct {
+	next     service.ShortenerRepository
+	policies map[string]Policy
+	classify func(error) bool
+}
+
+// Имена операций, для которых в конфигурации можно задать свою политику повторов.
+const (
+	OpSetURL           = "SetURL"
+	OpInsertURLs       = "InsertURLs"
+	OpGetURLSByUserID  = "GetURLSByUserID"
+	OpUpdateURL        = "UpdateURL"
+	OpGetURLHistory    = "GetURLHistory"
+	OpDeleteUserURLS   = "DeleteUserURLS"
+	OpGetDeletedURLs   = "GetDeletedURLs"
+	OpUndeleteURL      = "UndeleteURL"
+	OpPurgeDeletedURLs = "PurgeDeletedURLs"
+	OpExpireURLs       = "ExpireURLs"
+)
+
+// NewShortenerRepository создаёт декоратор над next с политиками повторов из конфигурации.
+func NewShortenerRepository(next service.ShortenerRepository, cfg config.Config) *ShortenerRepository {
+	policies := make(map[string]Policy)
+	for _, op := range []string{OpSetURL, OpInsertURLs, OpGetURLSByUserID, OpUpdateURL, OpGetURLHistory, OpDeleteUserURLS, OpGetDeletedURLs, OpUndeleteURL, OpPurgeDeletedURLs, OpExpireURLs} {
+		policies[op] = policyFromConfig(cfg, op)
+	}
+
+	return &ShortenerRepository{
+		next:     next,
+		policies: policies,
+		classify: IsRetryable,
+	}
+}
+
+func (r *ShortenerRepository) do(ctx context.Context, op string, fn func() error) error {
+	return do(ctx, op, r.policies[op], r.classify, fn)
+}
+
+// GetURLByID передаёт вызов без повторов: переход списывается у ссылки с лимитом.
+func (r *ShortenerRepository) GetURLByID(ctx context.Context, id string, check func(url string) error) (string, error) {
+	return r.next.GetURLByID(ctx, id, check)
+}
+
+// UnlockURL передаёт вызов без повторов, как и GetURLByID.
+func (r *ShortenerRepository) UnlockURL(ctx context.Context, id string, verify func(passwordHash string) error, check func(url string) error) (string, error) {
+	return r.next.UnlockURL(ctx, id, verify, check)
+}
+
+// GetURLByOriginalURL передаёт вызов без повторов: метод не сообщает об ошибках.
+func (r *ShortenerRepository) GetURLByOriginalURL(ctx context.Context, originalURL string) (string, bool) {
+	return r.next.GetURLByOriginalURL(ctx, originalURL)
+}
+
+// SetURL сохраняет ссылку, повторяя запрос при временных ошибках.
+//
+// Если соединение оборвалось после фиксации записи, повтор вернёт ErrUniqueIndex
+// или ErrIDConflict;
+// для строгой семантики повторы SetURL можно отключить в RetryOperations.
+func (r *ShortenerRepository) SetURL(ctx context.Context, link model.ShortenURL) error {
+	return r.do(ctx, OpSetURL, func() error {
+		return r.next.SetURL(ctx, link)
+	})
+}
+
+// InsertURLs сохраняет пакет ссылок, повторяя запрос при временных ошибках.
+func (r *ShortenerRepository) InsertURLs(ctx context.Context, urls []model.BatchURL) ([]model.BatchURLResult, error) {
+	var results []model.BatchURLResult
+	err := r.do(ctx, OpInsertURLs, func() error {
+		var err error
+		results, err = r.next.InsertURLs(ctx, urls)
+		return err
+	})
+
+	return results, err
+}
+
+// GetURLSByUserID возвращает ссылки пользователя, повторяя запрос при временных ошибках.
+func (r *ShortenerRepository) GetURLSByUserID(ctx context.Context, userID string) ([]model.ShortenURL, error) {
+	var items []model.ShortenURL
+	err := r.do(ctx, OpGetURLSByUserID, func() error {
+		var err error
+		items, err = r.next.GetURLSByUserID(ctx, userID)
+		return err
+	})
+
+	return items, err
+}
+
+// UpdateURL меняет оригинальный URL ссылки, повторяя запрос при временных ошибках.
+// Повтор безопасен: если изменение уже применено, замена на тот же URL ничего не меняет.
+func (r *ShortenerRepository) UpdateURL(ctx context.Context, id string, userID string, url string, submittedURL string) error {
+	return r.do(ctx, OpUpdateURL, func() error {
+		return r.next.UpdateURL(ctx, id, userID, url, submittedURL)
+	})
+}
+
+// GetURLHistory возвращает историю изменений ссылки, повторяя запрос при временных ошибках.
+func (r *ShortenerRepository) GetURLHistory(ctx context.Context, id string, userID string) ([]model.URLEdit, error) {
+	var history []model.URLEdit
+	err := r.do(ctx, OpGetURLHistory, func() error {
+		var err error
+		history, err = r.next.GetURLHistory(ctx, id, userID)
+		return err
+	})
+
+	return history, err
+}
+
+// DeleteUserURLS помечает ссылки удалёнными, повторяя запрос при временных ошибках.
+// Операция идемпотентна, поэтому повтор безопасен.
+func (r *ShortenerRepository) DeleteUserURLS(ctx context.Context, items []model.URLToDelete) error {
+	return r.do(ctx, OpDeleteUserURLS, func() error {
+		return r.next.DeleteUserURLS(ctx, items)
+	})
+}
+
+// GetDeletedURLs возвращает корзину пользователя, повторяя запрос при временных ошибках.
+func (r *ShortenerRepository) GetDeletedURLs(ctx context.Context, userID string, deletedAfter time.Time) ([]model.ShortenURL, error) {
+	var items []model.ShortenURL
+	err := r.do(ctx, OpGetDeletedURLs, func() error {
+		var err error
+		items, err = r.next.GetDeletedURLs(ctx, userID, deletedAfter)
+		return err
+	})
+
+	return items, err
+}
+
+// UndeleteURL восстанавливает удалённую ссылку, повторяя запрос при временных ошибках.
+// Операция идемпотентна, поэтому повтор безопасен.
+func (r *ShortenerRepository) UndeleteURL(ctx context.Context, id string, userID string, deletedAfter time.Time) error {
+	return r.do(ctx, OpUndeleteURL, func() error {
+		return r.next.UndeleteURL(ctx, id, userID, deletedAfter)
+	})
+}
+
+// PurgeDeletedURLs окончательно удаляет пакет ссылок, повторяя запрос при временных ошибках.
+// Повтор безопасен: уже удалённые ссылки повторно не учитываются.
+func (r *ShortenerRepository) PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time, limit int, reuseIDs bool) (int, error) {
+	var purged int
+	err := r.do(ctx, OpPurgeDeletedURLs, func() error {
+		var err error
+		purged, err = r.next.PurgeDeletedURLs(ctx, deletedBefore, limit, reuseIDs)
+		return err
+	})
+
+	return purged, err
+}
+
+// ExpireURLs помечает удалёнными истёкшие ссылки, повторяя запрос при временных ошибках.
+// Повтор безопасен: уже помеченные ссылки повторно не учитываются.
+func (r *ShortenerRepository) ExpireURLs(ctx context.Context, expiredBefore time.Time, limit int) (int, error) {
+	var expired int
+	err := r.do(ctx, OpExpireURLs, func() error {
+		var err error
+		expired, err = r.next.ExpireURLs(ctx, expiredBefore, limit)
+		return err
+	})
+
+	return expired, err
+}
+
+// Ping проверяет доступность хранилища без повторов.
+func (r *ShortenerRepository) Ping(ctx context.Context) error {
+	return r.next.Ping(ctx)
+}
+
+// Close закрывает обёрнутый репозиторий.
+func (r *ShortenerRepository) Close() error {
+	return r.next.Close()
+}
@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/logger"
+	"github.com/bubaew95/yandex-go-learn/internal/core/model"
+)
+
+// compactionMinRecords — минимальное число записей в хвостовом сегменте,
+// при котором имеет смысл проверять порог по соотношению записей.
+const compactionMinRecords = 100
+
+// compactionCheckInterval — период проверки порогов уплотнения.
+const compactionCheckInterval = time.Minute
+
+// Compact уплотняет журнал: записывает снимок актуального состояния во временный файл
+// и атомарно подменяет им прежний снимок.
+//
+// Хвостовой сегмент предварительно переименовывается в сегмент уплотнения, а запись
+// новых изменений продолжается в новый пустой хвост, поэтому SetURL не блокируется
+// на время построения снимка. Если процесс прервётся посреди уплотнения,
+// Load прочитает снимок, сегмент уплотнения и хвост в правильном порядке.
+func (s ShortenerDB) Compact() error {
+	s.state.mx.Lock()
+	defer s.state.mx.Unlock()
+
+	// Сегмент уплотнения мог остаться после аварийного завершения:
+	// в этом случае сначала доводим до конца прошлое уплотнение.
+	if _, err := os.Stat(s.compactingPath()); errors.Is(err, os.ErrNotExist) {
+		if err = s.producer.Rotate(s.compactingPath()); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	data := make(map[string]model.ShortenURL)
+	if _, err := readOptional(s.snapshotPath(), data, s.recoveryMode()); err != nil {
+		return err
+	}
+
+	if _, err := readOptional(s.compactingPath(), data, s.recoveryMode()); err != nil {
+		return err
+	}
+
+	if err := writeSnapshot(s.snapshotPath(), data); err != nil {
+		return err
+	}
+
+	if err := os.Remove(s.compactingPath()); err != nil {
+		return err
+	}
+
+	s.state.snapshotRecords = int64(len(data))
+
+	return nil
+}
+
+// NeedsCompaction сообщает, превысил ли хвостовой сегмент один из порогов уплотнения:
+// размер в байтах (FileCompactSize) или отношение числа записей в хвосте
+// к числу записей в снимке (FileCompactRatio). Нулевой порог отключает проверку.
+func (s ShortenerDB) NeedsCompaction() bool {
+	size, records := s.producer.Stats()
+
+	if s.config.FileCompactSize > 0 && size >= s.config.FileCompactSize {
+		return true
+	}
+
+	if s.config.FileCompactRatio <= 0 || records < compactionMinRecords {
+		return false
+	}
+
+	s.state.mx.Lock()
+	snapshotRecords := s.state.snapshotRecords
+	s.state.mx.Unlock()
+
+	return float64(records) >= s.config.FileCompactRatio*float64(max(snapshotRecords, 1))
+}
+
+func writeSnapshot(filename string, data map[string]model.ShortenURL) error {
+	items := make([]model.ShortenURL, 0, len(data))
+	for _, v := range data {
+		items = append(items, v)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].UUID != items[j].UUID {
+			return items[i].UUID < items[j].UUID
+		}
+
+		return items[i].ShortURL < items[j].ShortURL
+	})
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	encoder := json.NewEncoder(tmp)
+	for i := range items {
+		r, err := newRecord(&items[i])
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+
+		if err = encoder.Encode(r); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp.Name(), filename); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(filename))
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// Compactor запускает уплотнение хранилища в фоне: по превышению порогов
+// или по явному запросу администратора.
+type Compactor struct {
+	db      ShortenerDB
+	trigger chan struct{}
+}
+
+// NewCompactor создаёт фоновый уплотнитель для указанного хранилища.
+func NewCompactor(db ShortenerDB) *Compactor {
+	return &Compactor{
+		db:      db,
+		trigger: make(chan struct{}, 1),
+	}
+}
+
+// Trigger запрашивает внеочередное уплотнение. Не блокируется,
+// если предыдущий запрос ещё не обработан.
+func (c *Compactor) Trigger() {
+	select {
+	case c.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Run запускает фоновую проверку порогов уплотнения до отмены контекста.
+func (c *Compactor) Run(ctx context.Context, wg *sync.WaitGroup) {
+	ticker := time.NewTicker(compactionCheckInterval)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if c.db.NeedsCompaction() {
+					c.compact("threshold")
+				}
+			case <-c.trigger:
+				c.compact("admin")
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (c *Compactor) compact(reason string) {
+	start := time.Now()
+	if err := c.db.Compact(); err != nil {
+		logger.Log.Error("File storage compaction error", zap.String("reason", reason), zap.Error(err))
+		return
+	}
+
+	logger.Log.Info("File storage compacted",
+		zap.String("reason", reason),
+		zap.Duration("duration", time.Since(start)))
+}
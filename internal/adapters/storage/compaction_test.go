@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bubaew95/yandex-go-learn/config"
+	"github.com/bubaew95/yandex-go-learn/internal/core/model"
+)
+
+func newTestDB(t *testing.T, cfg config.Config) *ShortenerDB {
+	t.Helper()
+
+	if cfg.FilePath == "" {
+		cfg.FilePath = filepath.Join(t.TempDir(), "storage.json")
+	}
+
+	db, err := NewShortenerDB(cfg)
+	require.NoError(t, err)
+
+	_, err = db.Load()
+	require.NoError(t, err)
+
+	return db
+}
+
+func TestShortenerDB_CloseTwice(t *testing.T) {
+	db := newTestDB(t, config.Config{})
+
+	require.NoError(t, db.Close())
+	require.NotPanics(t, func() {
+		assert.NoError(t, db.Close())
+	})
+}
+
+func TestNewShortenerDB_DefaultSyncPolicy(t *testing.T) {
+	db := newTestDB(t, config.Config{})
+	defer db.Close()
+
+	assert.Equal(t, SyncPolicy(config.DefaultFileSyncPolicy), db.producer.syncPolicy)
+}
+
+func TestShortenerDB_Compact(t *testing.T) {
+	db := newTestDB(t, config.Config{})
+
+	require.NoError(t, db.Save(&model.ShortenURL{UUID: 1, ShortURL: "id1", OriginalURL: "https://a.com", UserID: "u1"}))
+	require.NoError(t, db.Save(&model.ShortenURL{UUID: 2, ShortURL: "id2", OriginalURL: "https://b.com", UserID: "u1"}))
+	require.NoError(t, db.Save(&model.ShortenURL{UUID: 2, ShortURL: "id2", UserID: "u1", IsDeleted: true}))
+	require.NoError(t, db.Save(&model.ShortenURL{UUID: 1, ShortURL: "id1", OriginalURL: "https://a2.com", UserID: "u1"}))
+
+	require.NoError(t, db.Compact())
+
+	// Запись после уплотнения попадает в новый хвостовой сегмент
+	require.NoError(t, db.Save(&model.ShortenURL{UUID: 3, ShortURL: "id3", OriginalURL: "https://c.com"}))
+
+	_, err := os.Stat(db.compactingPath())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	snapshot, err := ReadShorteners(db.snapshotPath())
+	require.NoError(t, err)
+	assert.Len(t, snapshot, 2)
+
+	_, records := db.producer.Stats()
+	assert.Equal(t, int64(1), records)
+
+	require.NoError(t, db.Close())
+
+	reopened := newTestDB(t, db.config)
+	defer reopened.Close()
+
+	data, err := reopened.Load()
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]model.ShortenURL{
+		"id1": {UUID: 1, ShortURL: "id1", OriginalURL: "https://a2.com", UserID: "u1"},
+		"id2": {UUID: 2, ShortURL: "id2", OriginalURL: "https://b.com", UserID: "u1", IsDeleted: true},
+		"id3": {UUID: 3, ShortURL: "id3", OriginalURL: "https://c.com"},
+	}, data)
+}
+
+func TestShortenerDB_PurgeRecords(t *testing.T) {
+	db := newTestDB(t, config.Config{})
+
+	deletedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	require.NoError(t, db.Save(&model.ShortenURL{UUID: 1, ShortURL: "id1", OriginalURL: "https://a.com", UserID: "u1"}))
+	require.NoError(t, db.Save(&model.ShortenURL{UUID: 2, ShortURL: "id2", OriginalURL: "https://b.com", UserID: "u1"}))
+	require.NoError(t, db.Save(&model.ShortenURL{UUID: 1, ShortURL: "id1", UserID: "u1", IsDeleted: true, DeletedAt: &deletedAt}))
+	require.NoError(t, db.Save(&model.ShortenURL{UUID: 2, ShortURL: "id2", UserID: "u1", IsDeleted: true, DeletedAt: &deletedAt}))
+
+	// id1 удалена окончательно с сохранением ID, id2 — полностью
+	require.NoError(t, db.Save(&model.ShortenURL{UUID: 1, ShortURL: "id1", UserID: "u1", IsDeleted: true, DeletedAt: &deletedAt, Purged: true}))
+	require.NoError(t, db.Save(&model.ShortenURL{UUID: 2, ShortURL: "id2", UserID: "u1", DeletedAt: &deletedAt, Purged: true}))
+
+	want := map[string]model.ShortenURL{
+		"id1": {UUID: 1, ShortURL: "id1", UserID: "u1", IsDeleted: true, DeletedAt: &deletedAt, Purged: true},
+	}
+
+	data, err := db.Load()
+	require.NoError(t, err)
+	assert.Equal(t, want, data)
+
+	// Занятый ID переживает уплотнение
+	require.NoError(t, db.Compact())
+
+	data, err = db.Load()
+	require.NoError(t, err)
+	assert.Equal(t, want, data)
+}
+
+func TestShortenerDB_LoadInterruptedCompaction(t *testing.T) {
+	db := newTestDB(t, config.Config{})
+
+	require.NoError(t, db.Save(&model.ShortenURL{UUID: 1, ShortURL: "id1", OriginalURL: "https://a.com"}))
+	require.NoError(t, db.Compact())
+
+	// Имитируем аварию после ротации хвоста: сегмент уплотнения остался на диске
+	require.NoError(t, db.Save(&model.ShortenURL{UUID: 2, ShortURL: "id2", OriginalURL: "https://b.com"}))
+	require.NoError(t, db.producer.Rotate(db.compactingPath()))
+	require.NoError(t, db.Save(&model.ShortenURL{UUID: 1, ShortURL: "id1", IsDeleted: true}))
+	require.NoError(t, db.Close())
+
+	reopened := newTestDB(t, db.config)
+	defer reopened.Close()
+
+	data, err := reopened.Load()
+	require.NoError(t, err)
+	require.Len(t, data, 2)
+	assert.True(t, data["id1"].IsDeleted)
+	assert.Equal(t, "https://b.com", data["id2"].OriginalURL)
+
+	// Следующее уплотнение завершает прерванное
+	require.NoError(t, reopened.Compact())
+
+	_, err = os.Stat(reopened.compactingPath())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	data, err = reopened.Load()
+	require.NoError(t, err)
+	assert.Len(t, data, 2)
+	assert.True(t, data["id1"].IsDeleted)
+}
+
+func TestShortenerDB_NeedsCompaction(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.Config
+		records int
+		want    bool
+	}{
+		{
+			name:    "thresholds disabled",
+			records: compactionMinRecords * 2,
+			want:    false,
+		},
+		{
+			name:    "size exceeded",
+			cfg:     config.Config{FileCompactSize: 10},
+			records: 1,
+			want:    true,
+		},
+		{
+			name:    "ratio exceeded",
+			cfg:     config.Config{FileCompactRatio: 2},
+			records: compactionMinRecords,
+			want:    true,
+		},
+		{
+			name:    "too few records for ratio",
+			cfg:     config.Config{FileCompactRatio: 2},
+			records: compactionMinRecords - 1,
+			want:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t, tt.cfg)
+			defer db.Close()
+
+			for i := 0; i < tt.records; i++ {
+				require.NoError(t, db.Save(&model.ShortenURL{UUID: 1, ShortURL: "id1", OriginalURL: "https://a.com"}))
+			}
+
+			assert.Equal(t, tt.want, db.NeedsCompaction())
+		})
+	}
+}
@@ -2,50 +2,62 @@
 package storage
 
 import (
-	"bufio"
-	"encoding/json"
-	"io"
-	"os"
-
 	"github.com/bubaew95/yandex-go-learn/internal/core/model"
 )
 
 // ReadShorteners читает файл с сериализованными записями сокращённых ссылок.
 //
-// Файл должен содержать строки в формате JSON, каждая строка — это структура model.ShortenURL.
-// Каждая строка разбирается, и на её основе формируется карта соответствий: ключ — ShortURL, значение — OriginalURL.
+// Файл должен содержать строки в формате JSON, каждая строка — это структура model.ShortenURL
+// с контрольной суммой. Оборванная последняя строка отрезается, а повреждённые строки
+// переносятся в файл карантина (режим RecoveryRepair).
+// Строки воспроизводятся по порядку: более поздняя запись с тем же ShortURL замещает предыдущую,
+// запись-«надгробие» (IsDeleted = true) помечает ранее сохранённую ссылку как удалённую,
+// а запись об окончательном удалении (Purged = true) освобождает её URL.
 //
 // Если файл не существует, он будет создан с пустым содержимым.
 //
-// Возвращает карту сокращённых ссылок и ошибку, если операция чтения или десериализации завершилась неудачно.
-func ReadShorteners(filename string) (map[string]string, error) {
-	file, err := os.OpenFile(filename, os.O_RDONLY|os.O_CREATE, 0666)
-	if err != nil {
+// Возвращает карту сокращённых ссылок (ключ — ShortURL) и ошибку,
+// если операция чтения или десериализации завершилась неудачно.
+func ReadShorteners(filename string) (map[string]model.ShortenURL, error) {
+	data := make(map[string]model.ShortenURL)
+	if _, err := readInto(filename, data, RecoveryRepair); err != nil {
 		return nil, err
 	}
 
-	defer file.Close()
-
-	bufio := bufio.NewReader(file)
-	data := make(map[string]string)
-	for {
-		line, err := bufio.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
+	return data, nil
+}
 
-			return nil, err
+// applyRecord применяет одну запись журнала к текущему состоянию.
+func applyRecord(data map[string]model.ShortenURL, s model.ShortenURL) {
+	if s.Purged {
+		if s.IsDeleted {
+			// Короткий ID остаётся занятым, но URL уже не хранится.
+			data[s.ShortURL] = s
+		} else {
+			delete(data, s.ShortURL)
 		}
 
-		var s model.ShortenURL
-		err = json.Unmarshal([]byte(line), &s)
-		if err != nil {
-			return nil, err
+		return
+	}
+
+	if !s.IsDeleted {
+		data[s.ShortURL] = s
+		return
+	}
+
+	current, ok := data[s.ShortURL]
+	if !ok {
+		// Полная запись об удалённой ссылке (например, из снимка).
+		if s.OriginalURL != "" {
+			data[s.ShortURL] = s
 		}
 
-		data[s.ShortURL] = s.OriginalURL
+		return
 	}
 
-	return data, nil
+	current.IsDeleted = true
+	if current.DeletedAt == nil {
+		current.DeletedAt = s.DeletedAt
+	}
+	data[s.ShortURL] = current
 }
@@ -3,50 +3,258 @@ package storage
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"os"
+	"sync"
+	"time"
 
+	"go.uber.org/zap"
+
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/logger"
 	"github.com/bubaew95/yandex-go-learn/internal/core/model"
 )
 
+// SyncPolicy определяет, когда записанные данные сбрасываются на диск (fsync).
+type SyncPolicy string
+
+const (
+	// SyncAlways — сброс после каждой записи.
+	SyncAlways SyncPolicy = "always"
+
+	// SyncInterval — сброс в фоне с заданным периодом, если были новые записи.
+	SyncInterval SyncPolicy = "interval"
+
+	// SyncNever — сброс только при закрытии и ротации файла.
+	SyncNever SyncPolicy = "never"
+)
+
 // Producer реализует механизм последовательной записи JSON-записей в файл.
 // Используется для сохранения сокращённых ссылок в формате model.ShortenURL.
+//
+// Запись и ротация файла защищены мьютексом, поэтому Producer
+// можно безопасно использовать из нескольких горутин.
 type Producer struct {
-	file    *os.File
-	encoder *json.Encoder
+	mx         sync.Mutex
+	filename   string
+	file       *os.File
+	encoder    *json.Encoder
+	size       int64
+	records    int64
+	syncPolicy SyncPolicy
+	dirty      bool
+	done       chan struct{}
+	closeOnce  sync.Once
+	closeErr   error
 }
 
 // NewProducer открывает (или создаёт) файл по указанному пути и возвращает новый экземпляр Producer.
 //
 // Файл открывается в режиме дозаписи (append), таким образом новые записи не затирают старые.
 // Права доступа к файлу устанавливаются как 0777.
+// Политика policy определяет, когда записи сбрасываются на диск; для SyncInterval
+// запускается фоновый сброс с периодом interval.
 //
-// Возвращает ошибку при неудачном открытии файла.
-func NewProducer(filename string) (*Producer, error) {
-	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0777)
-	if err != nil {
+// Возвращает ошибку при неудачном открытии файла или неизвестной политике.
+func NewProducer(filename string, policy SyncPolicy, interval time.Duration) (*Producer, error) {
+	switch policy {
+	case SyncAlways, SyncNever:
+	case SyncInterval:
+		if interval <= 0 {
+			return nil, fmt.Errorf("invalid sync interval %s", interval)
+		}
+	default:
+		return nil, fmt.Errorf("unknown sync policy %q", policy)
+	}
+
+	p := &Producer{
+		filename:   filename,
+		syncPolicy: policy,
+		done:       make(chan struct{}),
+	}
+
+	if err := p.open(); err != nil {
 		return nil, err
 	}
 
-	return &Producer{
-		file:    file,
-		encoder: json.NewEncoder(file),
-	}, nil
+	if policy == SyncInterval {
+		go p.syncLoop(interval)
+	}
+
+	return p, nil
+}
+
+func (p *Producer) syncLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := p.Sync(); err != nil {
+				logger.Log.Error("File storage sync error", zap.Error(err))
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// Sync сбрасывает на диск записи, сделанные после предыдущего сброса.
+func (p *Producer) Sync() error {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if !p.dirty {
+		return nil
+	}
+
+	if err := p.file.Sync(); err != nil {
+		return err
+	}
+
+	p.dirty = false
+	return nil
+}
+
+func (p *Producer) open() error {
+	file, err := os.OpenFile(p.filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0777)
+	if err != nil {
+		return err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	p.file = file
+	p.encoder = json.NewEncoder(&countingWriter{w: file, n: &p.size})
+	p.size = stat.Size()
+
+	return nil
 }
 
 // WriteShortener сериализует структуру model.ShortenURL и записывает её в файл в формате JSON.
 //
-// Каждая запись пишется как отдельная строка.
+// Каждая запись пишется как отдельная строка вместе с контрольной суммой.
 func (p *Producer) WriteShortener(s *model.ShortenURL) error {
-	return p.encoder.Encode(s)
+	r, err := newRecord(s)
+	if err != nil {
+		return err
+	}
+
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if err = p.encoder.Encode(r); err != nil {
+		return err
+	}
+
+	p.records++
+	p.dirty = true
+
+	if p.syncPolicy == SyncAlways {
+		if err = p.file.Sync(); err != nil {
+			return err
+		}
+
+		p.dirty = false
+	}
+
+	return nil
 }
 
-// Close завершает работу с файлом: вызывает синхронизацию буфера и закрывает файл.
+// Rotate закрывает текущий файл, переименовывает его в target и открывает
+// по прежнему пути новый пустой файл для последующих записей.
 //
-// Возвращает ошибку, если одна из операций завершилась неудачно.
-func (p *Producer) Close() error {
+// На время ротации запись блокируется, после неё продолжается уже в новый файл.
+func (p *Producer) Rotate(target string) error {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
 	if err := p.file.Sync(); err != nil {
 		return err
 	}
 
-	return p.file.Close()
+	if err := p.file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(p.filename, target); err != nil {
+		// Пытаемся продолжить запись в прежний файл.
+		if openErr := p.open(); openErr != nil {
+			return openErr
+		}
+
+		return err
+	}
+
+	p.records = 0
+	p.dirty = false
+	return p.open()
+}
+
+// reopen заново открывает файл по прежнему пути, например после того,
+// как он был переписан при восстановлении.
+func (p *Producer) reopen() error {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if err := p.file.Close(); err != nil {
+		return err
+	}
+
+	return p.open()
+}
+
+// Stats возвращает размер текущего файла в байтах и количество записей в нём.
+func (p *Producer) Stats() (size int64, records int64) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	return p.size, p.records
+}
+
+func (p *Producer) setRecords(n int64) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	p.records = n
+}
+
+// Close завершает работу с файлом: вызывает синхронизацию буфера и закрывает файл.
+//
+// Повторный вызов ничего не делает и возвращает результат первого.
+//
+// Возвращает ошибку, если одна из операций завершилась неудачно.
+func (p *Producer) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.done)
+
+		p.mx.Lock()
+		defer p.mx.Unlock()
+
+		if err := p.file.Sync(); err != nil {
+			p.closeErr = err
+			return
+		}
+
+		p.closeErr = p.file.Close()
+	})
+
+	return p.closeErr
+}
+
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	*c.n += int64(n)
+
+	return n, err
 }
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/bubaew95/yandex-go-learn/internal/core/idgen"
+)
+
+// rangesSuffix — суффикс файла со счётчиком коротких ID рядом с файлом хранилища.
+const rangesSuffix = ".ids"
+
+// RangeStore хранит счётчик блоков номеров для генератора коротких ID в отдельном файле.
+// Каждое изменение выполняется под эксклюзивной блокировкой файла (flock, в Windows —
+// LockFileEx), поэтому несколько процессов на одном хосте получают непересекающиеся блоки.
+//
+// Аренды в файле не истекают: номера блока процесса, завершившегося аварийно, пропускаются.
+type RangeStore struct {
+	filename string
+}
+
+// rangesState — содержимое файла счётчика.
+type rangesState struct {
+	Next uint64        `json:"next"`
+	Free []idgen.Range `json:"free,omitempty"`
+}
+
+// NewRangeStore создаёт хранилище блоков номеров рядом с файлом хранилища ссылок.
+func (s ShortenerDB) NewRangeStore() *RangeStore {
+	return &RangeStore{filename: s.config.FilePath + rangesSuffix}
+}
+
+// Lease выдаёт освобождённый остаток или новый блок из size номеров.
+func (s *RangeStore) Lease(ctx context.Context, size uint64) (idgen.Range, error) {
+	var r idgen.Range
+	err := s.update(func(state *rangesState) {
+		if len(state.Free) > 0 {
+			r = state.Free[0]
+			state.Free = state.Free[1:]
+			return
+		}
+
+		r = idgen.Range{Start: state.Next, End: state.Next + size}
+		state.Next = r.End
+	})
+
+	return r, err
+}
+
+// Renew ничего не делает: аренды в файле не истекают.
+func (s *RangeStore) Renew(ctx context.Context, leases []idgen.Range) error {
+	return nil
+}
+
+// Release возвращает неиспользованные номера [next, End) для повторной выдачи.
+func (s *RangeStore) Release(ctx context.Context, lease idgen.Range, next uint64) error {
+	if next >= lease.End {
+		return nil
+	}
+
+	return s.update(func(state *rangesState) {
+		state.Free = append(state.Free, idgen.Range{Start: next, End: lease.End})
+	})
+}
+
+// update читает состояние, применяет fn и записывает результат под блокировкой файла.
+func (s *RangeStore) update(fn func(state *rangesState)) error {
+	file, err := os.OpenFile(s.filename, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err = lockFile(file); err != nil {
+		return err
+	}
+	defer unlockFile(file)
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	var state rangesState
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, &state); err != nil {
+			return err
+		}
+	}
+
+	fn(&state)
+
+	if data, err = json.Marshal(state); err != nil {
+		return err
+	}
+
+	if err = file.Truncate(0); err != nil {
+		return err
+	}
+
+	if _, err = file.WriteAt(data, 0); err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
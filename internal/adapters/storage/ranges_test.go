@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bubaew95/yandex-go-learn/config"
+	"github.com/bubaew95/yandex-go-learn/internal/core/idgen"
+)
+
+func TestRangeStore(t *testing.T) {
+	db := newTestDB(t, config.Config{FilePath: filepath.Join(t.TempDir(), "storage.json")})
+	defer db.Close()
+
+	ctx := context.Background()
+	first := db.NewRangeStore()
+	second := db.NewRangeStore()
+
+	r1, err := first.Lease(ctx, 100)
+	require.NoError(t, err)
+	assert.Equal(t, idgen.Range{Start: 0, End: 100}, r1)
+
+	r2, err := second.Lease(ctx, 100)
+	require.NoError(t, err)
+	assert.Equal(t, idgen.Range{Start: 100, End: 200}, r2)
+
+	// Остаток блока выдаётся следующему арендатору, израсходованный блок не возвращается
+	require.NoError(t, first.Release(ctx, r1, 40))
+	require.NoError(t, second.Release(ctx, r2, 200))
+
+	r3, err := second.Lease(ctx, 100)
+	require.NoError(t, err)
+	assert.Equal(t, idgen.Range{Start: 40, End: 100}, r3)
+
+	r4, err := first.Lease(ctx, 100)
+	require.NoError(t, err)
+	assert.Equal(t, idgen.Range{Start: 200, End: 300}, r4)
+}
+
+func TestRangeStore_Concurrent(t *testing.T) {
+	db := newTestDB(t, config.Config{FilePath: filepath.Join(t.TempDir(), "storage.json")})
+	defer db.Close()
+
+	const workers = 8
+
+	var (
+		wg     sync.WaitGroup
+		mx     sync.Mutex
+		starts = make(map[uint64]struct{})
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Каждый арендатор открывает файл сам, как отдельный процесс
+			r, err := db.NewRangeStore().Lease(context.Background(), 10)
+			assert.NoError(t, err)
+
+			mx.Lock()
+			starts[r.Start] = struct{}{}
+			mx.Unlock()
+		}()
+	}
+
+	wg.Wait()
+	assert.Len(t, starts, workers)
+}
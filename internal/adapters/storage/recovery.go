@@ -0,0 +1,265 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/bubaew95/yandex-go-learn/internal/core/model"
+)
+
+// RecoveryMode определяет поведение при чтении повреждённого файла хранилища.
+type RecoveryMode string
+
+const (
+	// RecoveryRepair — оборванная последняя запись отрезается, повреждённые записи
+	// переносятся в файл карантина (FilePath + ".corrupt"), загрузка продолжается.
+	RecoveryRepair RecoveryMode = "repair"
+
+	// RecoveryStrict — любая повреждённая запись прерывает загрузку с ошибкой.
+	RecoveryStrict RecoveryMode = "strict"
+)
+
+const quarantineSuffix = ".corrupt"
+
+// Ошибки чтения файла хранилища.
+var (
+	ErrCorruptRecord = errors.New("corrupt storage record") // Запись не разбирается или не совпадает контрольная сумма
+	ErrTornRecord    = errors.New("torn storage record")    // Последняя запись файла оборвана
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// record — представление записи в файле: model.ShortenURL с контрольной суммой.
+//
+// Контрольная сумма считается по JSON-представлению model.ShortenURL.
+// Записи без поля crc (созданные до его появления) принимаются без проверки.
+type record struct {
+	model.ShortenURL
+	CRC *uint32 `json:"crc,omitempty"`
+}
+
+func newRecord(s *model.ShortenURL) (*record, error) {
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	crc := crc32.Checksum(payload, crcTable)
+
+	return &record{ShortenURL: *s, CRC: &crc}, nil
+}
+
+func decodeRecord(line []byte) (model.ShortenURL, error) {
+	var r record
+	if err := json.Unmarshal(line, &r); err != nil {
+		return model.ShortenURL{}, fmt.Errorf("%w: %v", ErrCorruptRecord, err)
+	}
+
+	if r.CRC == nil {
+		return r.ShortenURL, nil
+	}
+
+	payload, err := json.Marshal(r.ShortenURL)
+	if err != nil {
+		return model.ShortenURL{}, fmt.Errorf("%w: %v", ErrCorruptRecord, err)
+	}
+
+	if crc32.Checksum(payload, crcTable) != *r.CRC {
+		return model.ShortenURL{}, fmt.Errorf("%w: checksum mismatch", ErrCorruptRecord)
+	}
+
+	return r.ShortenURL, nil
+}
+
+// readStats — итог чтения одного или нескольких файлов хранилища.
+type readStats struct {
+	records        int64
+	quarantined    int64
+	truncatedBytes int64
+}
+
+func (r readStats) repaired() bool {
+	return r.quarantined > 0 || r.truncatedBytes > 0
+}
+
+func (r *readStats) add(other readStats) {
+	r.records += other.records
+	r.quarantined += other.quarantined
+	r.truncatedBytes += other.truncatedBytes
+}
+
+type corruptLine struct {
+	offset int64
+	data   []byte
+}
+
+// readInto воспроизводит записи файла поверх уже накопленного состояния data.
+//
+// В режиме RecoveryRepair оборванная последняя запись отрезается, а повреждённые
+// записи переносятся в файл карантина и удаляются из исходного файла.
+func readInto(filename string, data map[string]model.ShortenURL, mode RecoveryMode) (readStats, error) {
+	var stats readStats
+
+	if mode != RecoveryRepair && mode != RecoveryStrict {
+		return stats, fmt.Errorf("unknown recovery mode %q", mode)
+	}
+
+	file, err := os.OpenFile(filename, os.O_RDONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return stats, err
+	}
+
+	defer file.Close()
+
+	var (
+		reader  = bufio.NewReader(file)
+		offset  int64
+		tornAt  int64 = -1
+		corrupt []corruptLine
+	)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			if err != io.EOF {
+				return stats, err
+			}
+
+			if len(line) > 0 {
+				if mode == RecoveryStrict {
+					return stats, fmt.Errorf("%s: offset %d: %w", filename, offset, ErrTornRecord)
+				}
+
+				tornAt = offset
+				stats.truncatedBytes = int64(len(line))
+			}
+
+			break
+		}
+
+		s, err := decodeRecord(line)
+		if err != nil {
+			if mode == RecoveryStrict {
+				return stats, fmt.Errorf("%s: offset %d: %w", filename, offset, err)
+			}
+
+			corrupt = append(corrupt, corruptLine{offset: offset, data: line})
+			stats.quarantined++
+		} else {
+			applyRecord(data, s)
+			stats.records++
+		}
+
+		offset += int64(len(line))
+	}
+
+	file.Close()
+
+	if len(corrupt) > 0 {
+		if err = quarantine(filename+quarantineSuffix, corrupt); err != nil {
+			return stats, err
+		}
+
+		return stats, rewriteWithout(filename, corrupt, tornAt)
+	}
+
+	if tornAt >= 0 {
+		return stats, os.Truncate(filename, tornAt)
+	}
+
+	return stats, nil
+}
+
+func quarantine(filename string, lines []corruptLine) error {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range lines {
+		if _, err = file.Write(l.data); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// rewriteWithout атомарно переписывает файл без повреждённых строк.
+// Если limit >= 0, всё начиная с этого смещения отбрасывается.
+func rewriteWithout(filename string, skip []corruptLine, limit int64) error {
+	src, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	var (
+		reader = bufio.NewReader(src)
+		writer = bufio.NewWriter(tmp)
+		offset int64
+		next   int
+	)
+
+	for limit < 0 || offset < limit {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if next < len(skip) && skip[next].offset == offset && bytes.Equal(skip[next].data, line) {
+				next++
+			} else if _, writeErr := writer.Write(line); writeErr != nil {
+				tmp.Close()
+				return writeErr
+			}
+
+			offset += int64(len(line))
+		}
+
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			tmp.Close()
+			return err
+		}
+	}
+
+	if err = writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp.Name(), filename); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(filename))
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bubaew95/yandex-go-learn/config"
+	"github.com/bubaew95/yandex-go-learn/internal/core/model"
+)
+
+func encodeLine(t *testing.T, s model.ShortenURL) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "line.json")
+	p, err := NewProducer(file, SyncNever, 0)
+	require.NoError(t, err)
+	require.NoError(t, p.WriteShortener(&s))
+	require.NoError(t, p.Close())
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+
+	return string(data)
+}
+
+func TestShortenerDB_LoadRecovery(t *testing.T) {
+	good1 := encodeLine(t, model.ShortenURL{UUID: 1, ShortURL: "id1", OriginalURL: "https://a.com"})
+	good2 := encodeLine(t, model.ShortenURL{UUID: 2, ShortURL: "id2", OriginalURL: "https://b.com"})
+	tampered := strings.Replace(encodeLine(t, model.ShortenURL{UUID: 3, ShortURL: "id3", OriginalURL: "https://c.com"}), "c.com", "evil.com", 1)
+	legacy := `{"uuid":4,"short_url":"id4","original_url":"https://d.com"}` + "\n"
+	garbage := "{not json\n"
+	torn := `{"uuid":5,"short_url":"id5","orig`
+
+	tests := []struct {
+		name            string
+		content         string
+		wantIDs         []string
+		wantContent     string
+		wantQuarantined string
+	}{
+		{
+			name:        "clean file",
+			content:     good1 + good2,
+			wantIDs:     []string{"id1", "id2"},
+			wantContent: good1 + good2,
+		},
+		{
+			name:        "legacy records without checksum",
+			content:     good1 + legacy,
+			wantIDs:     []string{"id1", "id4"},
+			wantContent: good1 + legacy,
+		},
+		{
+			name:        "torn tail is truncated",
+			content:     good1 + good2 + torn,
+			wantIDs:     []string{"id1", "id2"},
+			wantContent: good1 + good2,
+		},
+		{
+			name:            "corrupt records are quarantined",
+			content:         good1 + garbage + tampered + good2 + torn,
+			wantIDs:         []string{"id1", "id2"},
+			wantContent:     good1 + good2,
+			wantQuarantined: garbage + tampered,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "storage.json")
+			require.NoError(t, os.WriteFile(file, []byte(tt.content), 0666))
+
+			db, err := NewShortenerDB(config.Config{FilePath: file, FileRecoveryMode: string(RecoveryRepair)})
+			require.NoError(t, err)
+			defer db.Close()
+
+			data, err := db.Load()
+			require.NoError(t, err)
+
+			var ids []string
+			for id := range data {
+				ids = append(ids, id)
+			}
+			assert.ElementsMatch(t, tt.wantIDs, ids)
+
+			content, err := os.ReadFile(file)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantContent, string(content))
+
+			quarantined, err := os.ReadFile(file + quarantineSuffix)
+			if tt.wantQuarantined == "" {
+				assert.ErrorIs(t, err, os.ErrNotExist)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.wantQuarantined, string(quarantined))
+			}
+
+			// После восстановления запись продолжается в исправленный файл
+			require.NoError(t, db.Save(&model.ShortenURL{UUID: 6, ShortURL: "id6", OriginalURL: "https://f.com"}))
+
+			data, err = db.Load()
+			require.NoError(t, err)
+			assert.Len(t, data, len(tt.wantIDs)+1)
+		})
+	}
+}
+
+func TestShortenerDB_LoadStrict(t *testing.T) {
+	good := encodeLine(t, model.ShortenURL{UUID: 1, ShortURL: "id1", OriginalURL: "https://a.com"})
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr error
+	}{
+		{
+			name:    "torn tail",
+			content: good + `{"uuid":2`,
+			wantErr: ErrTornRecord,
+		},
+		{
+			name:    "corrupt record",
+			content: "garbage\n" + good,
+			wantErr: ErrCorruptRecord,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "storage.json")
+			require.NoError(t, os.WriteFile(file, []byte(tt.content), 0666))
+
+			db, err := NewShortenerDB(config.Config{FilePath: file, FileRecoveryMode: string(RecoveryStrict)})
+			require.NoError(t, err)
+			defer db.Close()
+
+			_, err = db.Load()
+			require.ErrorIs(t, err, tt.wantErr)
+
+			content, err := os.ReadFile(file)
+			require.NoError(t, err)
+			assert.Equal(t, tt.content, string(content))
+		})
+	}
+}
+
+func TestNewProducer_SyncPolicy(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "storage.json")
+
+	_, err := NewProducer(file, "sometimes", 0)
+	require.Error(t, err)
+
+	_, err = NewProducer(file, SyncInterval, 0)
+	require.Error(t, err)
+
+	for _, policy := range []SyncPolicy{SyncAlways, SyncNever, SyncInterval} {
+		p, err := NewProducer(file, policy, 10*time.Millisecond)
+		require.NoError(t, err)
+
+		require.NoError(t, p.WriteShortener(&model.ShortenURL{UUID: 1, ShortURL: "id1", OriginalURL: "https://a.com"}))
+		require.NoError(t, p.Sync())
+		require.NoError(t, p.Close())
+	}
+}
@@ -3,28 +3,52 @@
 package storage
 
 import (
-	"bufio"
-	"encoding/json"
-	"io"
+	"cmp"
+	"errors"
 	"os"
+	"sync"
+
+	"go.uber.org/zap"
 
 	"github.com/bubaew95/yandex-go-learn/config"
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/logger"
 	"github.com/bubaew95/yandex-go-learn/internal/core/model"
 )
 
+const (
+	snapshotSuffix   = ".snapshot"
+	compactingSuffix = ".compacting"
+)
+
 // ShortenerDB реализует файловое хранилище сокращённых ссылок.
 // Хранение данных осуществляется в виде последовательных JSON-записей.
+//
+// На диске хранилище состоит из снимка (FilePath + ".snapshot") с актуальным
+// состоянием на момент последнего уплотнения и хвостового сегмента (FilePath),
+// в который дописываются все последующие изменения.
 type ShortenerDB struct {
 	config   config.Config
 	producer *Producer
+	state    *compactionState
+}
+
+// compactionState хранит общее для всех копий ShortenerDB состояние уплотнения.
+type compactionState struct {
+	mx              sync.Mutex
+	snapshotRecords int64
 }
 
 // NewShortenerDB инициализирует файловое хранилище и готовит его к записи новых записей.
 //
 // Открывает файл, указанный в конфигурации, для последующей записи.
+// Если политика сброса на диск или её период не заданы, используются те же значения
+// по умолчанию, что и в конфигурации: config.DefaultFileSyncPolicy и config.DefaultFileSyncInterval.
 // Возвращает ошибку, если файл не удалось открыть.
 func NewShortenerDB(c config.Config) (*ShortenerDB, error) {
-	producer, err := NewProducer(c.FilePath)
+	policy := SyncPolicy(cmp.Or(c.FileSyncPolicy, config.DefaultFileSyncPolicy))
+	interval := cmp.Or(c.FileSyncInterval.Duration, config.DefaultFileSyncInterval)
+
+	producer, err := NewProducer(c.FilePath, policy, interval)
 	if err != nil {
 		return nil, err
 	}
@@ -32,11 +56,14 @@ func NewShortenerDB(c config.Config) (*ShortenerDB, error) {
 	return &ShortenerDB{
 		config:   c,
 		producer: producer,
+		state:    &compactionState{},
 	}, nil
 }
 
 // Save сериализует объект model.ShortenURL и добавляет его в файл хранилища.
 //
+// Длина URL здесь не проверяется: ограничение config.MaxURLLength применяется
+// сервисом к новым URL, а Save перезаписывает и уже существующие ссылки.
 // Возвращает ошибку, если не удалось записать данные.
 func (s ShortenerDB) Save(data *model.ShortenURL) error {
 	err := s.producer.WriteShortener(data)
@@ -47,42 +74,91 @@ func (s ShortenerDB) Save(data *model.ShortenURL) error {
 	return nil
 }
 
-// Load загружает все записи из файла и возвращает отображение ID -> оригинальный URL.
+// Load загружает все записи хранилища и возвращает отображение ID -> запись о ссылке.
 //
-// Каждая строка файла должна быть JSON-представлением структуры model.ShortenURL.
-// Возвращает ошибку при невозможности прочитать или десериализовать строку.
-func (s ShortenerDB) Load() (map[string]string, error) {
-	file, err := os.OpenFile(s.config.FilePath, os.O_RDONLY|os.O_CREATE, 0666)
+// Сначала читается снимок, затем сегмент незавершённого уплотнения (если процесс
+// был прерван во время уплотнения) и, наконец, хвостовой сегмент.
+// Каждая строка файлов должна быть JSON-представлением структуры model.ShortenURL
+// с контрольной суммой. Записи-«надгробия» воспроизводятся поверх ранее сохранённых ссылок.
+//
+// Поведение при повреждённых записях определяется FileRecoveryMode: в режиме repair
+// оборванная последняя запись отрезается, а повреждённые записи переносятся в карантин;
+// в режиме strict возвращается ошибка.
+func (s ShortenerDB) Load() (map[string]model.ShortenURL, error) {
+	data := make(map[string]model.ShortenURL)
+
+	var total readStats
+
+	snapshot, err := readOptional(s.snapshotPath(), data, s.recoveryMode())
 	if err != nil {
 		return nil, err
 	}
+	total.add(snapshot)
 
-	defer file.Close()
+	compacting, err := readOptional(s.compactingPath(), data, s.recoveryMode())
+	if err != nil {
+		return nil, err
+	}
+	total.add(compacting)
 
-	bufio := bufio.NewReader(file)
-	data := make(map[string]string)
-	for {
-		line, err := bufio.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
+	tail, err := readInto(s.config.FilePath, data, s.recoveryMode())
+	if err != nil {
+		return nil, err
+	}
+	total.add(tail)
 
+	if tail.repaired() {
+		if err = s.producer.reopen(); err != nil {
 			return nil, err
 		}
+	}
 
-		var s model.ShortenURL
-		err = json.Unmarshal([]byte(line), &s)
-		if err != nil {
-			return nil, err
-		}
+	s.state.mx.Lock()
+	s.state.snapshotRecords = snapshot.records
+	s.state.mx.Unlock()
+
+	s.producer.setRecords(tail.records)
+
+	fields := []zap.Field{
+		zap.Int64("recovered", total.records),
+		zap.Int64("quarantined", total.quarantined),
+		zap.Int64("truncated_bytes", total.truncatedBytes),
+	}
 
-		data[s.ShortURL] = s.OriginalURL
+	if total.repaired() {
+		logger.Log.Warn("File storage loaded with repairs", fields...)
+	} else {
+		logger.Log.Info("File storage loaded", fields...)
 	}
 
 	return data, nil
 }
 
+// readOptional работает как readInto, но не создаёт файл, если его нет.
+func readOptional(filename string, data map[string]model.ShortenURL, mode RecoveryMode) (readStats, error) {
+	if _, err := os.Stat(filename); errors.Is(err, os.ErrNotExist) {
+		return readStats{}, nil
+	}
+
+	return readInto(filename, data, mode)
+}
+
+func (s ShortenerDB) recoveryMode() RecoveryMode {
+	if s.config.FileRecoveryMode == "" {
+		return RecoveryRepair
+	}
+
+	return RecoveryMode(s.config.FileRecoveryMode)
+}
+
+func (s ShortenerDB) snapshotPath() string {
+	return s.config.FilePath + snapshotSuffix
+}
+
+func (s ShortenerDB) compactingPath() string {
+	return s.config.FilePath + compactingSuffix
+}
+
 // Close завершает работу с хранилищем, закрывая файловый поток записи.
 //
 // Возвращает ошибку, если операция завершения не удалась.
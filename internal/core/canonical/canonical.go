@@ -0,0 +1,249 @@
+// Package canonical приводит оригинальные URL к каноническому виду, чтобы
+// записи, которые отличаются только написанием, считались одной ссылкой.
+//
+// Базовое приведение переводит схему и хост в нижний регистр, убирает порт
+// по умолчанию, нормализует процентное кодирование, точечные сегменты и
+// завершающий слеш пути. Сортировка параметров запроса и удаление рекламных
+// параметров включаются в конфигурации отдельно.
+//
+// Канонический вид служит только ключом поиска повторов: переход по ссылке
+// выполняется на URL в том виде, в каком его передал пользователь.
+package canonical
+
+import (
+	"net"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/bubaew95/yandex-go-learn/config"
+)
+
+// DefaultTrackingParams — рекламные параметры, удаляемые, если в конфигурации
+// не задан свой список. Имя с "*" на конце задаёт префикс.
+var DefaultTrackingParams = []string{
+	"utm_*",
+	"fbclid",
+	"gclid",
+	"dclid",
+	"msclkid",
+	"yclid",
+	"ysclid",
+	"mc_cid",
+	"mc_eid",
+	"_openstat",
+}
+
+// defaultPorts — порты, которые не указываются в каноническом URL.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ftp":   "21",
+	"ws":    "80",
+	"wss":   "443",
+}
+
+// Canonicalizer приводит URL к каноническому виду по настройкам развёртывания.
+// Нулевое значение ничего не меняет.
+type Canonicalizer struct {
+	enabled       bool
+	sortQuery     bool
+	stripTracking bool
+	tracking      []string
+}
+
+// New создаёт Canonicalizer по настройкам URL* из конфигурации.
+// Приведение выполняется только в режиме config.URLCanonicalizationBasic.
+func New(cfg config.Config) Canonicalizer {
+	tracking := cfg.URLTrackingParams
+	if len(tracking) == 0 {
+		tracking = DefaultTrackingParams
+	}
+
+	return Canonicalizer{
+		enabled:       cfg.URLCanonicalization == config.URLCanonicalizationBasic,
+		sortQuery:     cfg.URLSortQuery,
+		stripTracking: cfg.URLStripTracking,
+		tracking:      tracking,
+	}
+}
+
+// URL возвращает канонический вид raw.
+//
+// Относительные и неразбираемые URL возвращаются без изменений: их проверка —
+// задача вызывающего кода.
+func (c Canonicalizer) URL(raw string) string {
+	if !c.enabled {
+		return raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Host == "" || u.Opaque != "" {
+		return raw
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+
+	var b strings.Builder
+	b.WriteString(scheme)
+	b.WriteString("://")
+	if u.User != nil {
+		b.WriteString(u.User.String())
+		b.WriteByte('@')
+	}
+	b.WriteString(canonicalHost(scheme, u))
+	b.WriteString(canonicalPath(u.EscapedPath()))
+
+	if query := c.canonicalQuery(u.RawQuery); query != "" {
+		b.WriteByte('?')
+		b.WriteString(query)
+	}
+
+	if u.Fragment != "" {
+		b.WriteByte('#')
+		b.WriteString(normalizeEscapes(u.EscapedFragment()))
+	}
+
+	return b.String()
+}
+
+// canonicalHost переводит хост в нижний регистр и убирает порт по умолчанию для схемы.
+func canonicalHost(scheme string, u *url.URL) string {
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+
+	if port != "" && port != defaultPorts[scheme] {
+		return net.JoinHostPort(host, port)
+	}
+
+	if strings.Contains(host, ":") {
+		return "[" + host + "]"
+	}
+
+	return host
+}
+
+// canonicalPath нормализует экранирование, убирает точечные сегменты, повторные
+// и завершающий слеши. Пустой путь заменяется на "/".
+func canonicalPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+
+	p = path.Clean("/" + normalizeEscapes(p))
+	if p == "." {
+		return "/"
+	}
+
+	return p
+}
+
+// canonicalQuery нормализует экранирование параметров, убирает пустые и, если
+// это включено, рекламные параметры и сортирует оставшиеся по имени. Порядок
+// значений одного параметра сохраняется.
+func (c Canonicalizer) canonicalQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	params := strings.Split(rawQuery, "&")
+	kept := params[:0]
+	for _, param := range params {
+		if param == "" {
+			continue
+		}
+
+		param = normalizeEscapes(param)
+		if c.stripTracking && c.isTracking(paramName(param)) {
+			continue
+		}
+
+		kept = append(kept, param)
+	}
+
+	if c.sortQuery {
+		slices.SortStableFunc(kept, func(a, b string) int {
+			return strings.Compare(paramName(a), paramName(b))
+		})
+	}
+
+	return strings.Join(kept, "&")
+}
+
+// isTracking сообщает, входит ли параметр name в список рекламных.
+func (c Canonicalizer) isTracking(name string) bool {
+	name = strings.ToLower(name)
+	for _, t := range c.tracking {
+		if prefix, ok := strings.CutSuffix(t, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+			continue
+		}
+
+		if name == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// paramName возвращает декодированное имя параметра запроса.
+func paramName(param string) string {
+	name, _, _ := strings.Cut(param, "=")
+	if unescaped, err := url.QueryUnescape(name); err == nil {
+		return unescaped
+	}
+
+	return name
+}
+
+// normalizeEscapes декодирует экранированные незарезервированные символы
+// (RFC 3986, раздел 6.2.2.2) и переводит остальные последовательности в верхний регистр.
+func normalizeEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		c := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteString(strings.ToUpper(s[i+1 : i+3]))
+		}
+		i += 2
+	}
+
+	return b.String()
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
@@ -0,0 +1,72 @@
+package canonical
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bubaew95/yandex-go-learn/config"
+)
+
+func TestCanonicalizer_URL(t *testing.T) {
+	t.Parallel()
+
+	basic := config.Config{URLCanonicalization: config.URLCanonicalizationBasic}
+	sorted := config.Config{URLCanonicalization: config.URLCanonicalizationBasic, URLSortQuery: true}
+	stripped := config.Config{URLCanonicalization: config.URLCanonicalizationBasic, URLStripTracking: true}
+	custom := config.Config{
+		URLCanonicalization: config.URLCanonicalizationBasic,
+		URLStripTracking:    true,
+		URLTrackingParams:   []string{"ref", "src_*"},
+	}
+
+	tests := []struct {
+		name string
+		cfg  config.Config
+		url  string
+		want string
+	}{
+		{name: "scheme, host and default port", cfg: basic, url: "HTTP://Example.COM:80/a/", want: "http://example.com/a"},
+		{name: "https default port", cfg: basic, url: "https://example.com:443", want: "https://example.com/"},
+		{name: "other port kept", cfg: basic, url: "http://example.com:8080/a", want: "http://example.com:8080/a"},
+		{name: "path case kept", cfg: basic, url: "http://example.com/A/b", want: "http://example.com/A/b"},
+		{name: "dot segments", cfg: basic, url: "http://example.com/a/./b/../c//d", want: "http://example.com/a/c/d"},
+		{name: "unreserved unescaped", cfg: basic, url: "http://example.com/%7Euser/%61", want: "http://example.com/~user/a"},
+		{name: "escapes upper case", cfg: basic, url: "http://example.com/a%2fb?q=%c3%a9", want: "http://example.com/a%2Fb?q=%C3%A9"},
+		{name: "empty params dropped", cfg: basic, url: "http://example.com/?&b=2&&a=1&", want: "http://example.com/?b=2&a=1"},
+		{name: "query order kept", cfg: basic, url: "http://example.com/?b=2&a=1", want: "http://example.com/?b=2&a=1"},
+		{name: "fragment kept", cfg: basic, url: "http://example.com/a#Top", want: "http://example.com/a#Top"},
+		{name: "ipv6", cfg: basic, url: "http://[::1]:80/", want: "http://[::1]/"},
+		{name: "user info", cfg: basic, url: "ftp://user@FTP.example.com:21/f", want: "ftp://user@ftp.example.com/f"},
+		{name: "relative unchanged", cfg: basic, url: "/a/../b", want: "/a/../b"},
+		{name: "invalid unchanged", cfg: basic, url: "http://[::1", want: "http://[::1"},
+		{name: "sorted query", cfg: sorted, url: "http://example.com/?b=2&a=1&b=1", want: "http://example.com/?a=1&b=2&b=1"},
+		{name: "tracking stripped", cfg: stripped, url: "http://example.com/?utm_source=x&id=1&fbclid=y&UTM_Medium=z", want: "http://example.com/?id=1"},
+		{name: "only tracking", cfg: stripped, url: "http://example.com/a?gclid=1", want: "http://example.com/a"},
+		{name: "tracking kept without option", cfg: basic, url: "http://example.com/?utm_source=x", want: "http://example.com/?utm_source=x"},
+		{name: "custom tracking list", cfg: custom, url: "http://example.com/?ref=a&src_id=b&utm_source=c", want: "http://example.com/?utm_source=c"},
+		{name: "disabled", cfg: config.Config{URLCanonicalization: config.URLCanonicalizationOff}, url: "HTTP://Example.com:80/a/", want: "HTTP://Example.com:80/a/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.want, New(tt.cfg).URL(tt.url))
+		})
+	}
+}
+
+func TestCanonicalizer_Idempotent(t *testing.T) {
+	t.Parallel()
+
+	c := New(config.Config{URLCanonicalization: config.URLCanonicalizationBasic, URLSortQuery: true, URLStripTracking: true})
+	for _, url := range []string{
+		"HTTP://Example.com:80/a/./b/?z=1&utm_source=x&a=%7e",
+		"https://example.com/%2e%2E/a%2F",
+		"http://example.com",
+	} {
+		once := c.URL(url)
+		assert.Equal(t, once, c.URL(once), url)
+	}
+}
@@ -0,0 +1,332 @@
+package idgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/bubaew95/yandex-go-learn/config"
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/logger"
+)
+
+// leaseTimeout ограничивает обращение к хранилищу диапазонов.
+const leaseTimeout = 5 * time.Second
+
+// Range — арендованный блок порядковых номеров [Start, End).
+type Range struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+}
+
+// RangeStore — общее для всех экземпляров сервиса хранилище диапазонов номеров.
+// Реализации: таблица PostgreSQL, файл со счётчиком под блокировкой и счётчик в памяти процесса.
+type RangeStore interface {
+	// Lease арендует блок номеров: ранее освобождённый или просроченный остаток,
+	// если он есть, иначе новый блок из size номеров.
+	Lease(ctx context.Context, size uint64) (Range, error)
+
+	// Renew продлевает аренду блоков, которыми пользуется экземпляр.
+	// Если аренда хотя бы одного блока уже утрачена, возвращает ErrLeaseLost.
+	Renew(ctx context.Context, leases []Range) error
+
+	// Release завершает аренду блока. Номера [next, End) возвращаются в хранилище
+	// и могут быть выданы другому экземпляру; при next >= End блок удаляется.
+	Release(ctx context.Context, lease Range, next uint64) error
+}
+
+// Block выдаёт ID по номерам из арендованных блоков (схема hi/lo): хранилище
+// обеспечивает, что блоки разных экземпляров не пересекаются, поэтому ID
+// не конфликтуют, а обращение к хранилищу нужно один раз на блок.
+//
+// Следующий блок арендуется заранее в фоне, аренды продлеваются с периодом IDLeaseTTL/3,
+// а при остановке неиспользованные номера возвращаются в хранилище (см. Run).
+type Block struct {
+	alphabet Alphabet
+	length   int
+	prefix   string
+	store    RangeStore
+	size     uint64
+	ttl      time.Duration
+
+	mx      sync.Mutex
+	current Range
+	next    uint64
+	spare   *Range
+	used    []Range
+	refill  chan struct{}
+}
+
+// NewBlock создаёт генератор с алфавитом, длиной, префиксом и размером блока из конфигурации
+// и арендует первый блок номеров.
+func NewBlock(ctx context.Context, cfg config.Config, store RangeStore) (*Block, error) {
+	a, err := alphabetFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.IDBlockSize < 1 {
+		return nil, fmt.Errorf("%w: block size %d", ErrInvalidLength, cfg.IDBlockSize)
+	}
+
+	first, err := store.Lease(ctx, uint64(cfg.IDBlockSize))
+	if err != nil {
+		return nil, fmt.Errorf("lease id block: %w", err)
+	}
+
+	g := &Block{
+		alphabet: a,
+		length:   cfg.IDLength,
+		prefix:   cfg.IDPrefix,
+		store:    store,
+		size:     uint64(cfg.IDBlockSize),
+		ttl:      cfg.IDLeaseTTL.Duration,
+		current:  first,
+		next:     first.Start,
+		refill:   make(chan struct{}, 1),
+	}
+	g.requestRefill()
+
+	return g, nil
+}
+
+// Generate возвращает ID для следующего номера текущего блока; url и attempt не используются.
+//
+// Если блок исчерпан, а следующий ещё не арендован, аренда выполняется синхронно.
+func (g *Block) Generate(url string, attempt int) (string, error) {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	if g.next >= g.current.End {
+		if err := g.advance(); err != nil {
+			return "", err
+		}
+	}
+
+	n := g.next
+	g.next++
+
+	return g.prefix + g.alphabet.encode(n, g.length), nil
+}
+
+// advance переключается на следующий блок. Вызывается под блокировкой.
+func (g *Block) advance() error {
+	next := g.spare
+	if next == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), leaseTimeout)
+		defer cancel()
+
+		r, err := g.store.Lease(ctx, g.size)
+		if err != nil {
+			return fmt.Errorf("lease id block: %w", err)
+		}
+		next = &r
+	}
+
+	// Отброшенный после потери аренды блок пуст и в хранилище не возвращается
+	if g.current.End > g.current.Start {
+		g.used = append(g.used, g.current)
+	}
+	g.current = *next
+	g.next = next.Start
+	g.spare = nil
+	g.requestRefill()
+
+	return nil
+}
+
+func (g *Block) requestRefill() {
+	select {
+	case g.refill <- struct{}{}:
+	default:
+	}
+}
+
+// Run запускает фоновую аренду следующего блока и продление аренд до отмены контекста.
+// После отмены неиспользованные номера возвращаются в хранилище, поэтому контекст
+// следует отменять после остановки сервиса, но до закрытия хранилища.
+func (g *Block) Run(ctx context.Context, wg *sync.WaitGroup) {
+	ticker := time.NewTicker(max(g.ttl/3, time.Second))
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-g.refill:
+				g.prefetch()
+			case <-ticker.C:
+				g.renew()
+				g.releaseUsed()
+			case <-ctx.Done():
+				g.shutdown()
+				return
+			}
+		}
+	}()
+}
+
+// prefetch заранее арендует следующий блок.
+func (g *Block) prefetch() {
+	g.mx.Lock()
+	ready := g.spare != nil
+	g.mx.Unlock()
+
+	if ready {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), leaseTimeout)
+	defer cancel()
+
+	r, err := g.store.Lease(ctx, g.size)
+	if err != nil {
+		logger.Log.Warn("Failed to lease id block", zap.Error(err))
+		return
+	}
+
+	// Запасной блок заполняется только здесь, в горутине Run, поэтому он всё ещё пуст
+	g.mx.Lock()
+	g.spare = &r
+	g.mx.Unlock()
+}
+
+func (g *Block) renew() {
+	g.mx.Lock()
+	leases := []Range{g.current}
+	if g.spare != nil {
+		leases = append(leases, *g.spare)
+	}
+	g.mx.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), leaseTimeout)
+	defer cancel()
+
+	err := g.store.Renew(ctx, leases)
+	if errors.Is(err, ErrLeaseLost) {
+		logger.Log.Warn("Id block lease lost, leasing new blocks", zap.Error(err))
+		g.drop(leases)
+		return
+	}
+
+	if err != nil {
+		logger.Log.Warn("Failed to renew id block leases", zap.Error(err))
+	}
+}
+
+// drop отбрасывает блоки, аренда которых утрачена: номера из них могли достаться
+// другому экземпляру. Блок, на который генератор уже успел переключиться, не трогается.
+// Следующий Generate арендует новый блок, а запасной арендуется заново в фоне.
+func (g *Block) drop(leases []Range) {
+	g.mx.Lock()
+	if g.current == leases[0] {
+		g.current = Range{}
+		g.next = 0
+	}
+
+	if g.spare != nil && slices.Contains(leases, *g.spare) {
+		g.spare = nil
+	}
+	g.mx.Unlock()
+
+	g.requestRefill()
+}
+
+// releaseUsed удаляет из хранилища полностью израсходованные блоки.
+func (g *Block) releaseUsed() {
+	g.mx.Lock()
+	used := g.used
+	g.used = nil
+	g.mx.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), leaseTimeout)
+	defer cancel()
+
+	for _, r := range used {
+		g.release(ctx, r, r.End)
+	}
+}
+
+// shutdown возвращает в хранилище остаток текущего блока и запасной блок.
+func (g *Block) shutdown() {
+	g.releaseUsed()
+
+	g.mx.Lock()
+	current, next, spare := g.current, g.next, g.spare
+	g.next = g.current.End
+	g.spare = nil
+	g.mx.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), leaseTimeout)
+	defer cancel()
+
+	if current.End > current.Start {
+		g.release(ctx, current, next)
+	}
+	if spare != nil {
+		g.release(ctx, *spare, spare.Start)
+	}
+}
+
+func (g *Block) release(ctx context.Context, r Range, next uint64) {
+	if err := g.store.Release(ctx, r, next); err != nil {
+		logger.Log.Warn("Failed to release id block",
+			zap.Uint64("start", r.Start),
+			zap.Uint64("end", r.End),
+			zap.Error(err))
+	}
+}
+
+// MemoryRangeStore выдаёт блоки из счётчика в памяти процесса.
+// Подходит для хранилища в памяти, где нет других экземпляров, с которыми нужно делить номера.
+type MemoryRangeStore struct {
+	mx   sync.Mutex
+	next uint64
+	free []Range
+}
+
+// NewMemoryRangeStore создаёт хранилище диапазонов, начинающее нумерацию с нуля.
+func NewMemoryRangeStore() *MemoryRangeStore {
+	return &MemoryRangeStore{}
+}
+
+// Lease выдаёт освобождённый остаток или новый блок из size номеров.
+func (s *MemoryRangeStore) Lease(ctx context.Context, size uint64) (Range, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if len(s.free) > 0 {
+		r := s.free[0]
+		s.free = s.free[1:]
+		return r, nil
+	}
+
+	r := Range{Start: s.next, End: s.next + size}
+	s.next = r.End
+
+	return r, nil
+}
+
+// Renew ничего не делает: аренды в памяти не истекают.
+func (s *MemoryRangeStore) Renew(ctx context.Context, leases []Range) error {
+	return nil
+}
+
+// Release возвращает неиспользованные номера [next, End) для повторной выдачи.
+func (s *MemoryRangeStore) Release(ctx context.Context, lease Range, next uint64) error {
+	if next >= lease.End {
+		return nil
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.free = append(s.free, Range{Start: next, End: lease.End})
+	return nil
+}
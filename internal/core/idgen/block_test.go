@@ -0,0 +1,187 @@
+package idgen
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bubaew95/yandex-go-learn/config"
+)
+
+func blockConfig(size int) config.Config {
+	return config.Config{
+		IDAlphabet:  "0123456789",
+		IDLength:    4,
+		IDPrefix:    "b",
+		IDBlockSize: size,
+		IDLeaseTTL:  config.Duration{Duration: time.Minute},
+	}
+}
+
+func TestBlock_Generate(t *testing.T) {
+	t.Parallel()
+
+	store := NewMemoryRangeStore()
+
+	first, err := NewBlock(context.Background(), blockConfig(3), store)
+	require.NoError(t, err)
+	second, err := NewBlock(context.Background(), blockConfig(3), store)
+	require.NoError(t, err)
+
+	// Экземпляры получают непересекающиеся блоки и переходят к следующему без фоновой аренды
+	var ids []string
+	for i := 0; i < 4; i++ {
+		id, err := first.Generate("", 0)
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	id, err := second.Generate("", 0)
+	require.NoError(t, err)
+	ids = append(ids, id)
+
+	assert.Equal(t, []string{"b0000", "b0001", "b0002", "b0006", "b0003"}, ids)
+}
+
+func TestBlock_RunReleasesOnShutdown(t *testing.T) {
+	t.Parallel()
+
+	store := NewMemoryRangeStore()
+
+	g, err := NewBlock(context.Background(), blockConfig(10), store)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+	g.Run(ctx, &wg)
+
+	// Дожидаемся фоновой аренды запасного блока
+	require.Eventually(t, func() bool {
+		g.mx.Lock()
+		defer g.mx.Unlock()
+		return g.spare != nil
+	}, time.Second, time.Millisecond)
+
+	for i := 0; i < 4; i++ {
+		_, err = g.Generate("", 0)
+		require.NoError(t, err)
+	}
+
+	cancel()
+	wg.Wait()
+
+	// Остаток текущего блока и весь запасной возвращены в хранилище
+	assert.ElementsMatch(t, []Range{{Start: 4, End: 10}, {Start: 10, End: 20}}, store.free)
+
+	next, err := NewBlock(context.Background(), blockConfig(10), store)
+	require.NoError(t, err)
+
+	id, err := next.Generate("", 0)
+	require.NoError(t, err)
+	assert.Contains(t, []string{"b0004", "b0010"}, id)
+}
+
+// sharedRanges — хранилище диапазонов с арендами, которые можно объявить истёкшими,
+// общее для нескольких экземпляров.
+type sharedRanges struct {
+	mx      sync.Mutex
+	next    uint64
+	owners  map[uint64]string
+	expired map[uint64]Range
+}
+
+func newSharedRanges() *sharedRanges {
+	return &sharedRanges{owners: map[uint64]string{}, expired: map[uint64]Range{}}
+}
+
+// expire объявляет аренду блока r истёкшей: его может арендовать другой экземпляр.
+func (s *sharedRanges) expire(r Range) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.expired[r.Start] = r
+}
+
+// instance возвращает хранилище с точки зрения экземпляра owner.
+func (s *sharedRanges) instance(owner string) RangeStore {
+	return instanceRanges{shared: s, owner: owner}
+}
+
+type instanceRanges struct {
+	shared *sharedRanges
+	owner  string
+}
+
+func (s instanceRanges) Lease(ctx context.Context, size uint64) (Range, error) {
+	s.shared.mx.Lock()
+	defer s.shared.mx.Unlock()
+
+	for start, r := range s.shared.expired {
+		delete(s.shared.expired, start)
+		s.shared.owners[start] = s.owner
+		return r, nil
+	}
+
+	r := Range{Start: s.shared.next, End: s.shared.next + size}
+	s.shared.next = r.End
+	s.shared.owners[r.Start] = s.owner
+
+	return r, nil
+}
+
+func (s instanceRanges) Renew(ctx context.Context, leases []Range) error {
+	s.shared.mx.Lock()
+	defer s.shared.mx.Unlock()
+
+	for _, r := range leases {
+		if s.shared.owners[r.Start] != s.owner {
+			return ErrLeaseLost
+		}
+	}
+
+	return nil
+}
+
+func (s instanceRanges) Release(ctx context.Context, lease Range, next uint64) error {
+	return nil
+}
+
+func TestBlock_LeaseLost(t *testing.T) {
+	t.Parallel()
+
+	shared := newSharedRanges()
+
+	first, err := NewBlock(context.Background(), blockConfig(3), shared.instance("first"))
+	require.NoError(t, err)
+
+	id, err := first.Generate("", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "b0000", id)
+
+	// Аренда первого экземпляра истекла, и блок достался второму
+	shared.expire(Range{Start: 0, End: 3})
+	second, err := NewBlock(context.Background(), blockConfig(3), shared.instance("second"))
+	require.NoError(t, err)
+
+	first.renew()
+
+	// Первый экземпляр больше не выдаёт номера из чужого блока
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id, err = first.Generate("", 0)
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	assert.Equal(t, []string{"b0003", "b0004", "b0005"}, ids)
+
+	id, err = second.Generate("", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "b0000", id)
+
+	// Утраченный блок не возвращается в хранилище как израсходованный
+	assert.Empty(t, first.used)
+}
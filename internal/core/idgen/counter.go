@@ -0,0 +1,33 @@
+package idgen
+
+import "sync/atomic"
+
+// Counter выдаёт ID по возрастающему счётчику, записанному в системе счисления алфавита.
+// ID короче length дополняются первым символом алфавита, длиннее — не обрезаются.
+//
+// Счётчик хранится в памяти процесса и начинается со start, поэтому New выбирает
+// эту стратегию только для хранилища в памяти (см. ErrVolatileStrategy).
+type Counter struct {
+	alphabet Alphabet
+	length   int
+	prefix   string
+	next     atomic.Uint64
+}
+
+// NewCounter создаёт генератор, первым выдающий значение start.
+func NewCounter(alphabet Alphabet, length int, prefix string, start uint64) *Counter {
+	g := &Counter{
+		alphabet: alphabet,
+		length:   length,
+		prefix:   prefix,
+	}
+	g.next.Store(start)
+
+	return g
+}
+
+// Generate возвращает следующее значение счётчика; url и attempt не используются.
+func (g *Counter) Generate(url string, attempt int) (string, error) {
+	n := g.next.Add(1) - 1
+	return g.prefix + g.alphabet.encode(n, g.length), nil
+}
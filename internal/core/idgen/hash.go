@@ -0,0 +1,39 @@
+package idgen
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"math/big"
+	"strconv"
+)
+
+// Hash строит ID из HMAC-SHA256 оригинального URL: один и тот же URL
+// всегда получает один и тот же ID. При коллизии к URL добавляется номер попытки.
+type Hash struct {
+	alphabet Alphabet
+	length   int
+	prefix   string
+	secret   []byte
+}
+
+// NewHash создаёт генератор ID по хешу URL с ключом secret.
+func NewHash(alphabet Alphabet, length int, prefix string, secret string) *Hash {
+	return &Hash{
+		alphabet: alphabet,
+		length:   length,
+		prefix:   prefix,
+		secret:   []byte(secret),
+	}
+}
+
+// Generate возвращает ID для url; для attempt > 0 — другой, но тоже детерминированный.
+func (g *Hash) Generate(url string, attempt int) (string, error) {
+	mac := hmac.New(sha256.New, g.secret)
+	mac.Write([]byte(url))
+	if attempt > 0 {
+		mac.Write([]byte("#" + strconv.Itoa(attempt)))
+	}
+
+	n := new(big.Int).SetBytes(mac.Sum(nil))
+	return g.prefix + g.alphabet.encodeBig(n, g.length), nil
+}
@@ -0,0 +1,181 @@
+// Package idgen предоставляет стратегии генерации коротких ID ссылок:
+// криптографически случайный ID, счётчик в системе счисления алфавита,
+// хеш оригинального URL, перемешанный счётчик и счётчик с арендой блоков номеров.
+//
+// Алфавит, длина и префикс ID задаются в конфигурации и общие для всех стратегий.
+package idgen
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/bubaew95/yandex-go-learn/config"
+)
+
+var (
+	// ErrInvalidAlphabet возвращается, если алфавит короче двух символов, содержит
+	// повторы или символы, которые нельзя использовать в пути URL без экранирования.
+	ErrInvalidAlphabet = errors.New("invalid id alphabet")
+
+	// ErrInvalidLength возвращается, если длина ID не поддерживается стратегией.
+	ErrInvalidLength = errors.New("invalid id length")
+
+	// ErrUnknownStrategy возвращается для неизвестного имени стратегии.
+	ErrUnknownStrategy = errors.New("unknown id strategy")
+
+	// ErrExhausted возвращается, когда перемешанный счётчик исчерпал все ID заданной длины.
+	ErrExhausted = errors.New("id space exhausted")
+
+	// ErrVolatileStrategy возвращается для стратегий со счётчиком в памяти процесса
+	// при постоянном хранилище: после перезапуска счётчик начинался бы заново.
+	ErrVolatileStrategy = errors.New("id strategy does not survive restarts")
+
+	// ErrLeaseLost возвращается хранилищем диапазонов, если аренда блока истекла
+	// и блок мог быть выдан другому экземпляру.
+	ErrLeaseLost = errors.New("id block lease lost")
+)
+
+// maxLength — верхняя граница длины ID: хеш SHA-256 даёт не больше 256 бит.
+const maxLength = 32
+
+// Generator генерирует короткий ID для оригинального URL.
+//
+// attempt — номер попытки, начиная с 0. Если ID уже занят, сервис запрашивает
+// новый с увеличенным номером: детерминированные стратегии должны вернуть другое значение.
+type Generator interface {
+	Generate(url string, attempt int) (string, error)
+}
+
+// New создаёт генератор стратегии cfg.IDStrategy с алфавитом, длиной и префиксом из конфигурации.
+//
+// Возвращает ErrUnknownStrategy, ErrInvalidAlphabet или ErrInvalidLength
+// при неверных параметрах и ErrVolatileStrategy для counter и sequential с файловым
+// хранилищем или PostgreSQL: для них подходит стратегия block.
+func New(cfg config.Config) (Generator, error) {
+	a, err := alphabetFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if isVolatile(cfg.IDStrategy) && cfg.StorageType != "" && cfg.StorageType != config.StorageTypeMemory {
+		return nil, fmt.Errorf("%w: %s with %s storage, use %s", ErrVolatileStrategy, cfg.IDStrategy, cfg.StorageType, config.IDStrategyBlock)
+	}
+
+	switch cfg.IDStrategy {
+	case config.IDStrategyRandom:
+		return NewRandom(a, cfg.IDLength, cfg.IDPrefix), nil
+	case config.IDStrategyCounter:
+		return NewCounter(a, cfg.IDLength, cfg.IDPrefix, 0), nil
+	case config.IDStrategyHash:
+		return NewHash(a, cfg.IDLength, cfg.IDPrefix, cfg.IDSecret), nil
+	case config.IDStrategySequential:
+		return NewSequential(a, cfg.IDLength, cfg.IDPrefix, cfg.IDSecret)
+	case config.IDStrategyBlock:
+		return nil, fmt.Errorf("%w: block strategy needs a range store, use NewBlock", ErrUnknownStrategy)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownStrategy, cfg.IDStrategy)
+	}
+}
+
+// isVolatile сообщает, хранит ли стратегия счётчик только в памяти процесса.
+func isVolatile(strategy string) bool {
+	return strategy == config.IDStrategyCounter || strategy == config.IDStrategySequential
+}
+
+// alphabetFromConfig проверяет общие для всех стратегий параметры: алфавит и длину ID.
+func alphabetFromConfig(cfg config.Config) (Alphabet, error) {
+	a, err := NewAlphabet(cfg.IDAlphabet)
+	if err != nil {
+		return Alphabet{}, err
+	}
+
+	if cfg.IDLength < 1 || cfg.IDLength > maxLength {
+		return Alphabet{}, fmt.Errorf("%w: %d", ErrInvalidLength, cfg.IDLength)
+	}
+
+	return a, nil
+}
+
+// Alphabet — упорядоченный набор символов ID.
+type Alphabet struct {
+	chars string
+}
+
+// Base62 — алфавит из цифр и латинских букв обоих регистров.
+var Base62 = Alphabet{chars: "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"}
+
+// NewAlphabet проверяет набор символов и возвращает алфавит.
+//
+// Допускаются только незарезервированные символы URL (латинские буквы, цифры, "-", ".", "_", "~")
+// без повторов; символов должно быть не меньше двух.
+func NewAlphabet(chars string) (Alphabet, error) {
+	if len(chars) < 2 {
+		return Alphabet{}, fmt.Errorf("%w: need at least 2 characters", ErrInvalidAlphabet)
+	}
+
+	var seen [256]bool
+	for i := 0; i < len(chars); i++ {
+		c := chars[i]
+		if !isUnreserved(c) {
+			return Alphabet{}, fmt.Errorf("%w: character %q is not allowed", ErrInvalidAlphabet, c)
+		}
+
+		if seen[c] {
+			return Alphabet{}, fmt.Errorf("%w: duplicate character %q", ErrInvalidAlphabet, c)
+		}
+		seen[c] = true
+	}
+
+	return Alphabet{chars: chars}, nil
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' ||
+		'A' <= c && c <= 'Z' ||
+		'0' <= c && c <= '9' ||
+		strings.IndexByte("-._~", c) >= 0
+}
+
+func (a Alphabet) base() uint64 {
+	return uint64(len(a.chars))
+}
+
+// encode записывает n в системе счисления алфавита, дополняя результат
+// до width символов первым символом алфавита.
+func (a Alphabet) encode(n uint64, width int) string {
+	buf := make([]byte, 0, width)
+	for n > 0 {
+		buf = append(buf, a.chars[n%a.base()])
+		n /= a.base()
+	}
+
+	for len(buf) < width {
+		buf = append(buf, a.chars[0])
+	}
+
+	reverse(buf)
+	return string(buf)
+}
+
+// encodeBig записывает младшие width разрядов n в системе счисления алфавита.
+func (a Alphabet) encodeBig(n *big.Int, width int) string {
+	base := new(big.Int).SetUint64(a.base())
+	digit := new(big.Int)
+	n = new(big.Int).Set(n)
+
+	buf := make([]byte, width)
+	for i := width - 1; i >= 0; i-- {
+		n.DivMod(n, base, digit)
+		buf[i] = a.chars[digit.Uint64()]
+	}
+
+	return string(buf)
+}
+
+func reverse(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
@@ -0,0 +1,160 @@
+package idgen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bubaew95/yandex-go-learn/config"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	base := config.Config{
+		IDAlphabet: "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ",
+		IDLength:   8,
+		IDPrefix:   "x-",
+	}
+
+	tests := []struct {
+		name     string
+		strategy string
+		alphabet string
+		length   int
+		storage  string
+		wantErr  error
+	}{
+		{name: "random", strategy: config.IDStrategyRandom},
+		{name: "counter", strategy: config.IDStrategyCounter},
+		{name: "hash", strategy: config.IDStrategyHash},
+		{name: "sequential", strategy: config.IDStrategySequential},
+		{name: "counter in memory", strategy: config.IDStrategyCounter, storage: config.StorageTypeMemory},
+		{name: "counter with file", strategy: config.IDStrategyCounter, storage: config.StorageTypeFile, wantErr: ErrVolatileStrategy},
+		{name: "sequential with postgres", strategy: config.IDStrategySequential, storage: config.StorageTypePostgres, wantErr: ErrVolatileStrategy},
+		{name: "random with postgres", strategy: config.IDStrategyRandom, storage: config.StorageTypePostgres},
+		{name: "block without store", strategy: config.IDStrategyBlock, wantErr: ErrUnknownStrategy},
+		{name: "unknown", strategy: "uuid", wantErr: ErrUnknownStrategy},
+		{name: "short alphabet", strategy: config.IDStrategyRandom, alphabet: "a", wantErr: ErrInvalidAlphabet},
+		{name: "duplicate", strategy: config.IDStrategyRandom, alphabet: "abca", wantErr: ErrInvalidAlphabet},
+		{name: "reserved char", strategy: config.IDStrategyRandom, alphabet: "ab/", wantErr: ErrInvalidAlphabet},
+		{name: "zero length", strategy: config.IDStrategyRandom, length: -1, wantErr: ErrInvalidLength},
+		{name: "sequential too long", strategy: config.IDStrategySequential, length: 20, wantErr: ErrInvalidLength},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := base
+			cfg.IDStrategy = tt.strategy
+			cfg.StorageType = tt.storage
+			if tt.alphabet != "" {
+				cfg.IDAlphabet = tt.alphabet
+			}
+			if tt.length != 0 {
+				cfg.IDLength = tt.length
+			}
+
+			g, err := New(cfg)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			id, err := g.Generate("https://example.com", 0)
+			require.NoError(t, err)
+			assert.Len(t, id, len(cfg.IDPrefix)+cfg.IDLength)
+			assert.True(t, strings.HasPrefix(id, cfg.IDPrefix))
+
+			for _, c := range strings.TrimPrefix(id, cfg.IDPrefix) {
+				assert.Contains(t, cfg.IDAlphabet, string(c))
+			}
+		})
+	}
+}
+
+func TestRandom_Generate(t *testing.T) {
+	t.Parallel()
+
+	g := NewRandom(Base62, 8, "")
+
+	seen := make(map[string]struct{})
+	for i := 0; i < 1000; i++ {
+		id, err := g.Generate("https://example.com", 0)
+		require.NoError(t, err)
+
+		_, dup := seen[id]
+		require.False(t, dup, "duplicate id %s", id)
+		seen[id] = struct{}{}
+	}
+}
+
+func TestCounter_Generate(t *testing.T) {
+	t.Parallel()
+
+	a, err := NewAlphabet("01")
+	require.NoError(t, err)
+
+	g := NewCounter(a, 3, "c", 2)
+
+	for _, want := range []string{"c010", "c011", "c100", "c101", "c110", "c111", "c1000"} {
+		id, err := g.Generate("", 0)
+		require.NoError(t, err)
+		assert.Equal(t, want, id)
+	}
+}
+
+func TestHash_Generate(t *testing.T) {
+	t.Parallel()
+
+	g := NewHash(Base62, 10, "", "secret")
+
+	first, err := g.Generate("https://example.com", 0)
+	require.NoError(t, err)
+	again, err := g.Generate("https://example.com", 0)
+	require.NoError(t, err)
+	assert.Equal(t, first, again)
+
+	retry, err := g.Generate("https://example.com", 1)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, retry)
+
+	other, err := g.Generate("https://example.org", 0)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, other)
+
+	salted, err := NewHash(Base62, 10, "", "other").Generate("https://example.com", 0)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, salted)
+}
+
+func TestSequential_Generate(t *testing.T) {
+	t.Parallel()
+
+	a, err := NewAlphabet("abcdef")
+	require.NoError(t, err)
+
+	// 6^3 = 216 ID: все они должны быть выданы ровно по одному разу
+	g, err := NewSequential(a, 3, "", "secret")
+	require.NoError(t, err)
+
+	seen := make(map[string]struct{})
+	var ids []string
+	for i := 0; i < 216; i++ {
+		id, err := g.Generate("", 0)
+		require.NoError(t, err)
+		require.Len(t, id, 3)
+
+		_, dup := seen[id]
+		require.False(t, dup, "duplicate id %s", id)
+		seen[id] = struct{}{}
+		ids = append(ids, id)
+	}
+
+	assert.NotEqual(t, []string{"aaa", "aab", "aac"}, ids[:3])
+
+	_, err = g.Generate("", 0)
+	require.ErrorIs(t, err, ErrExhausted)
+}
@@ -0,0 +1,51 @@
+package idgen
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// Random генерирует криптографически случайные ID.
+// Вероятность коллизии определяется только алфавитом и длиной.
+type Random struct {
+	alphabet Alphabet
+	length   int
+	prefix   string
+}
+
+// NewRandom создаёт генератор случайных ID длины length.
+func NewRandom(alphabet Alphabet, length int, prefix string) *Random {
+	return &Random{
+		alphabet: alphabet,
+		length:   length,
+		prefix:   prefix,
+	}
+}
+
+// Generate возвращает новый случайный ID; url и attempt не используются.
+func (g *Random) Generate(url string, attempt int) (string, error) {
+	// Байты, не меньшие limit, отбрасываются, чтобы все символы алфавита были равновероятны.
+	base := len(g.alphabet.chars)
+	limit := 256 - 256%base
+
+	id := make([]byte, 0, g.length)
+	buf := make([]byte, g.length+g.length/2)
+	for len(id) < g.length {
+		if _, err := rand.Read(buf); err != nil {
+			return "", fmt.Errorf("random id: %w", err)
+		}
+
+		for _, b := range buf {
+			if int(b) >= limit {
+				continue
+			}
+
+			id = append(id, g.alphabet.chars[int(b)%base])
+			if len(id) == g.length {
+				break
+			}
+		}
+	}
+
+	return g.prefix + string(id), nil
+}
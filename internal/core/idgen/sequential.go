@@ -0,0 +1,84 @@
+package idgen
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"sync/atomic"
+)
+
+// Sequential выдаёт ID по счётчику, перемешанному взаимно однозначным отображением
+// n -> (n*mult + offset) mod base^length. Соседние значения счётчика дают
+// непохожие ID фиксированной длины без коллизий, пока пространство не исчерпано.
+//
+// Счётчик, как и у Counter, хранится только в памяти процесса.
+//
+// Множитель и сдвиг выводятся из секрета. Это защита от перебора соседних ID,
+// а не шифрование: при известном секрете порядок выдачи восстанавливается.
+type Sequential struct {
+	alphabet Alphabet
+	length   int
+	prefix   string
+	space    uint64
+	mult     uint64
+	offset   uint64
+	next     atomic.Uint64
+}
+
+// NewSequential создаёт генератор перемешанного счётчика.
+//
+// Возвращает ErrInvalidLength, если base^length не помещается в 63 бита.
+func NewSequential(alphabet Alphabet, length int, prefix string, secret string) (*Sequential, error) {
+	space := uint64(1)
+	for i := 0; i < length; i++ {
+		hi, lo := bits.Mul64(space, alphabet.base())
+		if hi != 0 || lo > 1<<63 {
+			return nil, fmt.Errorf("%w: %d is too long for sequential ids", ErrInvalidLength, length)
+		}
+		space = lo
+	}
+
+	sum := sha256.Sum256([]byte("idgen:" + secret))
+	mult := binary.BigEndian.Uint64(sum[0:8])%space | 1
+	for gcd(mult, space) != 1 {
+		mult = (mult + 2) % space
+	}
+
+	return &Sequential{
+		alphabet: alphabet,
+		length:   length,
+		prefix:   prefix,
+		space:    space,
+		mult:     mult,
+		offset:   binary.BigEndian.Uint64(sum[8:16]) % space,
+	}, nil
+}
+
+// Generate возвращает ID для следующего значения счётчика; url и attempt не используются.
+//
+// Возвращает ErrExhausted, когда выданы все ID заданной длины.
+func (g *Sequential) Generate(url string, attempt int) (string, error) {
+	n := g.next.Add(1) - 1
+	if n >= g.space {
+		return "", ErrExhausted
+	}
+
+	return g.prefix + g.alphabet.encode(g.permute(n), g.length), nil
+}
+
+// permute вычисляет (n*mult + offset) mod space без переполнения.
+func (g *Sequential) permute(n uint64) uint64 {
+	hi, lo := bits.Mul64(n, g.mult)
+	_, rem := bits.Div64(hi, lo, g.space)
+
+	return (rem + g.offset) % g.space
+}
+
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+
+	return a
+}
@@ -2,12 +2,40 @@
 // для обработки запросов и ответов, связанных с сокращением URL.
 package model
 
+import (
+	"cmp"
+	"time"
+)
+
 // ShortenerRequest представляет собой входной запрос на сокращение URL.
 //
 // Используется в теле HTTP-запроса.
 type ShortenerRequest struct {
 	// URL — оригинальный URL, который необходимо сократить.
 	URL string `json:"url"`
+
+	// Alias — желаемый короткий ID. Если не задан, ID генерируется сервисом.
+	Alias string `json:"alias,omitempty"`
+
+	LinkOptions
+}
+
+// LinkOptions — необязательные параметры создаваемой ссылки.
+type LinkOptions struct {
+	// ExpiresIn — срок жизни ссылки в секундах.
+	ExpiresIn int64 `json:"expires_in,omitempty"`
+
+	// ExpiresAt — момент, после которого ссылка перестаёт работать.
+	// Задаётся вместо ExpiresIn; если не задано ни то ни другое, действует срок по умолчанию.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// MaxClicks — число переходов, после которого ссылка перестаёт работать;
+	// 1 — одноразовая ссылка, 0 — без ограничения.
+	MaxClicks int `json:"max_clicks,omitempty"`
+
+	// Password — пароль, без которого переход по ссылке невозможен.
+	// Хранится только его хеш.
+	Password string `json:"password,omitempty"`
 }
 
 // ShortenerResponse представляет ответ на успешное сокращение URL.
@@ -19,9 +47,11 @@ type ShortenerResponse struct {
 }
 
 // ShortenURL представляет полную запись о сокращённой ссылке,
-// включая уникальный ID, короткий URL и оригинальный URL.
+// включая уникальный ID, короткий URL, оригинальный URL и владельца.
 //
 // Используется как основная структура при сериализации/десериализации.
+// Запись с IsDeleted = true является «надгробием»: при воспроизведении файла
+// она помечает ранее сохранённую ссылку как удалённую.
 type ShortenURL struct {
 	// UUID — уникальный числовой идентификатор записи.
 	UUID int `json:"uuid"`
@@ -29,28 +59,132 @@ type ShortenURL struct {
 	// ShortURL — сгенерированная короткая ссылка.
 	ShortURL string `json:"short_url"`
 
-	// OriginalURL — исходный URL, который был сокращён.
+	// OriginalURL — исходный URL, который был сокращён, в каноническом виде.
 	OriginalURL string `json:"original_url"`
+
+	// SubmittedURL — URL в том виде, в каком его передал пользователь;
+	// пусто, если он совпадает с OriginalURL. По ссылке выполняется переход на него,
+	// а OriginalURL используется только для поиска дубликатов.
+	SubmittedURL string `json:"submitted_url,omitempty"`
+
+	// UserID — идентификатор пользователя, создавшего ссылку.
+	UserID string `json:"user_id,omitempty"`
+
+	// IsDeleted — признак того, что ссылка удалена пользователем.
+	IsDeleted bool `json:"is_deleted,omitempty"`
+
+	// DeletedAt — время удаления ссылки пользователем.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+
+	// ExpiresAt — момент, после которого ссылка перестаёт работать; nil — бессрочная ссылка.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// ClicksLeft — сколько переходов по ссылке ещё осталось; nil — без ограничения.
+	ClicksLeft *int `json:"clicks_left,omitempty"`
+
+	// PasswordHash — bcrypt-хеш пароля ссылки; пусто — ссылка без пароля.
+	PasswordHash string `json:"password_hash,omitempty"`
+
+	// History — прежние оригинальные URL, заменённые владельцем, от первого изменения к последнему.
+	History []URLEdit `json:"history,omitempty"`
+
+	// Purged — признак окончательного удаления: оригинальный URL освобождён.
+	// Вместе с IsDeleted означает, что короткий ID остаётся занятым;
+	// без IsDeleted — ссылка удаляется полностью и ID может быть выдан повторно.
+	Purged bool `json:"purged,omitempty"`
+}
+
+// Expired сообщает, истёк ли к моменту now срок жизни ссылки.
+func (u ShortenURL) Expired(now time.Time) bool {
+	return u.ExpiresAt != nil && !u.ExpiresAt.After(now)
+}
+
+// RedirectURL возвращает URL, на который выполняется переход по ссылке:
+// SubmittedURL, если он задан, иначе OriginalURL.
+func (u ShortenURL) RedirectURL() string {
+	return cmp.Or(u.SubmittedURL, u.OriginalURL)
 }
 
 // ShortenerURLMapping используется для массовой обработки сокращений.
 // Содержит информацию о корреляции (например, ID клиента) и оригинальный URL.
 type ShortenerURLMapping struct {
-	// CorrelationID — произвольный ID, привязанный к запросу клиента.
+	// CorrelationID — произвольный ID клиента. Возвращается в ответе без изменений
+	// и не используется как короткий ID.
 	CorrelationID string `json:"correlation_id"`
 
 	// OriginalURL — оригинальный URL, подлежащий сокращению.
 	OriginalURL string `json:"original_url"`
+
+	LinkOptions
 }
 
+// BatchStatus — результат обработки одного элемента пакета.
+type BatchStatus string
+
+// Результаты обработки элемента пакета.
+const (
+	// BatchStatusCreated — создана новая короткая ссылка.
+	BatchStatusCreated BatchStatus = "created"
+
+	// BatchStatusExists — URL уже был сокращён, возвращается существующая ссылка.
+	BatchStatusExists BatchStatus = "exists"
+
+	// BatchStatusInvalid — URL или параметры ссылки не прошли проверку, ссылка не сохранена.
+	BatchStatusInvalid BatchStatus = "invalid"
+
+	// BatchStatusForbidden — домен URL запрещён политикой, ссылка не сохранена.
+	BatchStatusForbidden BatchStatus = "forbidden"
+)
+
 // ShortenerURLResponse представляет результат сокращения,
 // возвращаемый для каждого элемента при массовой обработке.
 type ShortenerURLResponse struct {
 	// CorrelationID — ID, соответствующий исходному запросу.
 	CorrelationID string `json:"correlation_id"`
 
-	// ShortURL — сгенерированная короткая ссылка.
-	ShortURL string `json:"short_url"`
+	// ShortURL — созданная или уже существующая короткая ссылка; пусто для невалидного URL.
+	ShortURL string `json:"short_url,omitempty"`
+
+	// Status — результат обработки элемента.
+	Status BatchStatus `json:"status"`
+
+	// Error — причина, по которой URL признан невалидным.
+	Error string `json:"error,omitempty"`
+
+	// Reason — машиночитаемая причина, если не прошёл проверку сам URL или его домен запрещён.
+	Reason string `json:"reason,omitempty"`
+}
+
+// BatchURL — запись пакета для сохранения в хранилище.
+type BatchURL struct {
+	// ID — сгенерированный короткий ID.
+	ID string
+
+	// OriginalURL — оригинальный URL в каноническом виде.
+	OriginalURL string
+
+	// SubmittedURL — URL в том виде, в каком его передал пользователь; пусто, если совпадает с OriginalURL.
+	SubmittedURL string
+
+	// ExpiresAt — момент истечения ссылки; nil — бессрочная ссылка.
+	ExpiresAt *time.Time
+
+	// ClicksLeft — лимит переходов по ссылке; nil — без ограничения.
+	ClicksLeft *int
+
+	// PasswordHash — bcrypt-хеш пароля ссылки; пусто — ссылка без пароля.
+	PasswordHash string
+}
+
+// BatchURLResult — результат сохранения записи пакета в хранилище.
+type BatchURLResult struct {
+	// ID — короткий ID новой записи, а для уже сокращённого URL — ID существующей записи.
+	// Для занятого ID — сам запрошенный ID.
+	ID string
+
+	// Err — nil для новой записи, ErrUniqueIndex, если URL уже сокращён,
+	// и ErrIDConflict, если короткий ID занят другой ссылкой.
+	Err error
 }
 
 // ShortenerURLSForUserResponse описывает одну запись для выдачи пользователю,
@@ -61,4 +195,61 @@ type ShortenerURLSForUserResponse struct {
 
 	// OriginalURL — исходный URL, связанный с пользователем.
 	OriginalURL string `json:"original_url"`
+
+	// SubmittedURL — URL в том виде, в каком его передал пользователь, если он отличается от OriginalURL.
+	SubmittedURL string `json:"submitted_url,omitempty"`
+
+	// ClicksLeft — оставшееся число переходов для ссылки с лимитом.
+	ClicksLeft *int `json:"clicks_left,omitempty"`
+}
+
+// DeletedURLResponse описывает удалённую ссылку в корзине пользователя.
+type DeletedURLResponse struct {
+	// ShortURL — короткий URL удалённой ссылки.
+	ShortURL string `json:"short_url"`
+
+	// OriginalURL — оригинальный URL удалённой ссылки.
+	OriginalURL string `json:"original_url"`
+
+	// DeletedAt — время удаления.
+	DeletedAt time.Time `json:"deleted_at"`
+
+	// RestoreUntil — время, до которого ссылку можно восстановить.
+	RestoreUntil time.Time `json:"restore_until"`
+}
+
+// URLEdit — прежний оригинальный URL ссылки, заменённый её владельцем.
+type URLEdit struct {
+	// Version — номер изменения ссылки начиная с 1.
+	Version int `json:"version"`
+
+	// OriginalURL — оригинальный URL, действовавший до изменения.
+	OriginalURL string `json:"original_url"`
+
+	// ChangedAt — время изменения.
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// UpdateURLRequest — запрос владельца на замену оригинального URL ссылки.
+type UpdateURLRequest struct {
+	// URL — новый оригинальный URL.
+	URL string `json:"url"`
+}
+
+// AliasConflictResponse описывает ответ на попытку занять уже существующий короткий ID.
+type AliasConflictResponse struct {
+	// Error — текст ошибки.
+	Error string `json:"error"`
+
+	// Alias — занятый короткий ID.
+	Alias string `json:"alias"`
+}
+
+// ErrorResponse описывает тело ответа API с описанием ошибки.
+type ErrorResponse struct {
+	// Error — текст ошибки.
+	Error string `json:"error"`
+
+	// Reason — машиночитаемая причина ошибки, например причина отказа в проверке URL.
+	Reason string `json:"reason,omitempty"`
 }
@@ -0,0 +1,332 @@
+// Package policy проверяет домены сокращаемых ссылок по спискам запрещённых
+// и разрешённых доменов из локальных файлов.
+//
+// Каждая строка файла — одно правило, пустые строки и текст после "#" пропускаются:
+//
+//	example.com       — сам домен и все его поддомены
+//	*.example.com     — только поддомены
+//	login-*.example.* — шаблон в синтаксисе path.Match для всего хоста
+//
+// Хост из списка запрещённых отклоняется всегда. Если список разрешённых не пуст,
+// принимаются только хосты из него. Файлы перечитываются при изменении
+// (см. Run) или по запросу (Trigger), например по сигналу SIGHUP.
+package policy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/idna"
+
+	"github.com/bubaew95/yandex-go-learn/config"
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/constants"
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/logger"
+)
+
+// Policy — списки доменов с перечитыванием файлов без перезапуска.
+// Проверки не блокируют друг друга и перечитывание: правила заменяются атомарно.
+type Policy struct {
+	blocklistPath string
+	allowlistPath string
+	interval      time.Duration
+
+	rules   atomic.Pointer[rules]
+	trigger chan struct{}
+
+	// mx защищает versions и упорядочивает перечитывание файлов
+	mx       sync.Mutex
+	versions map[string]fileVersion
+}
+
+// rules — загруженные списки доменов.
+type rules struct {
+	block matcher
+	allow matcher
+}
+
+// fileVersion — время изменения и размер файла на момент загрузки.
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// New загружает списки из файлов config.PolicyBlocklistFile и config.PolicyAllowlistFile.
+// Незаданный файл означает пустой список. Возвращает ошибку, если файл нельзя
+// прочитать или в нём есть неверное правило.
+func New(cfg config.Config) (*Policy, error) {
+	p := &Policy{
+		blocklistPath: cfg.PolicyBlocklistFile,
+		allowlistPath: cfg.PolicyAllowlistFile,
+		interval:      cfg.PolicyReloadInterval.Duration,
+		trigger:       make(chan struct{}, 1),
+		versions:      make(map[string]fileVersion),
+	}
+
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Check проверяет хост ссылки. Возвращает *constants.PolicyError (ErrForbiddenURL),
+// если хост в списке запрещённых или список разрешённых не пуст и хоста в нём нет.
+func (p *Policy) Check(host string) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	r := p.rules.Load()
+
+	if rule, ok := r.block.match(host); ok {
+		return &constants.PolicyError{Reason: constants.URLReasonBlockedDomain, Host: host, Rule: rule}
+	}
+
+	if !r.allow.empty() {
+		if _, ok := r.allow.match(host); !ok {
+			return &constants.PolicyError{Reason: constants.URLReasonDomainNotAllowed, Host: host}
+		}
+	}
+
+	return nil
+}
+
+// Reload перечитывает оба файла. При ошибке продолжают действовать прежние правила.
+func (p *Policy) Reload() error {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	return p.reload()
+}
+
+// reload вызывается под блокировкой mx.
+func (p *Policy) reload() error {
+	versions := make(map[string]fileVersion, 2)
+
+	block, err := loadFile(p.blocklistPath, versions)
+	if err != nil {
+		return err
+	}
+
+	allow, err := loadFile(p.allowlistPath, versions)
+	if err != nil {
+		return err
+	}
+
+	p.rules.Store(&rules{block: block, allow: allow})
+	p.versions = versions
+
+	logger.Log.Info("Domain policy loaded",
+		zap.Int("blocked", block.size()),
+		zap.Int("allowed", allow.size()))
+
+	return nil
+}
+
+// Trigger запрашивает перечитывание файлов. Повторные запросы, пока
+// предыдущий не обработан, объединяются.
+func (p *Policy) Trigger() {
+	select {
+	case p.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Run запускает фоновое перечитывание: файлы проверяются раз в config.PolicyReloadInterval
+// и перечитываются, если изменились их время изменения или размер, а также по Trigger.
+func (p *Policy) Run(ctx context.Context, wg *sync.WaitGroup) {
+	// Без периода файлы перечитываются только по Trigger
+	var tick <-chan time.Time
+	var ticker *time.Ticker
+	if p.interval > 0 {
+		ticker = time.NewTicker(p.interval)
+		tick = ticker.C
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if ticker != nil {
+			defer ticker.Stop()
+		}
+
+		for {
+			select {
+			case <-tick:
+				p.reloadChanged()
+			case <-p.trigger:
+				if err := p.Reload(); err != nil {
+					logger.Log.Error("Domain policy reload error", zap.String("reason", "signal"), zap.Error(err))
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// reloadChanged перечитывает файлы, если хотя бы один из них изменился с последней загрузки.
+func (p *Policy) reloadChanged() {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	changed := false
+	for _, filePath := range []string{p.blocklistPath, p.allowlistPath} {
+		if filePath == "" {
+			continue
+		}
+
+		info, err := os.Stat(filePath)
+		if err != nil {
+			logger.Log.Debug("Cannot stat domain policy file", zap.String("path", filePath), zap.Error(err))
+			continue
+		}
+
+		if p.versions[filePath] != (fileVersion{modTime: info.ModTime(), size: info.Size()}) {
+			changed = true
+		}
+	}
+
+	if !changed {
+		return
+	}
+
+	if err := p.reload(); err != nil {
+		logger.Log.Error("Domain policy reload error", zap.String("reason", "changed"), zap.Error(err))
+	}
+}
+
+// loadFile читает правила из файла filePath и запоминает его версию в versions.
+// Пустой путь означает пустой список.
+func loadFile(filePath string, versions map[string]fileVersion) (matcher, error) {
+	m := newMatcher()
+	if filePath == "" {
+		return m, nil
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return matcher{}, fmt.Errorf("domain policy: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return matcher{}, fmt.Errorf("domain policy: %w", err)
+	}
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		rule, _, _ := strings.Cut(scanner.Text(), "#")
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+
+		if err := m.add(rule); err != nil {
+			return matcher{}, fmt.Errorf("domain policy %s:%d: %w", filePath, line, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return matcher{}, fmt.Errorf("domain policy %s: %w", filePath, err)
+	}
+
+	versions[filePath] = fileVersion{modTime: info.ModTime(), size: info.Size()}
+
+	return m, nil
+}
+
+// matcher — набор правил одного списка.
+type matcher struct {
+	// domains — правила "example.com": домен и его поддомены
+	domains map[string]struct{}
+
+	// subdomains — правила "*.example.com", ключ без "*."
+	subdomains map[string]struct{}
+
+	// patterns — остальные правила со "*" для path.Match
+	patterns []string
+}
+
+func newMatcher() matcher {
+	return matcher{
+		domains:    make(map[string]struct{}),
+		subdomains: make(map[string]struct{}),
+	}
+}
+
+// add разбирает правило. Интернационализированные домены переводятся в punycode,
+// как и хосты проверяемых ссылок.
+func (m *matcher) add(rule string) error {
+	rule = strings.ToLower(strings.TrimSuffix(rule, "."))
+
+	if suffix, ok := strings.CutPrefix(rule, "*."); ok && !strings.Contains(suffix, "*") {
+		ascii, err := idna.Lookup.ToASCII(suffix)
+		if err != nil {
+			return fmt.Errorf("invalid rule %q: %w", rule, err)
+		}
+		m.subdomains[ascii] = struct{}{}
+		return nil
+	}
+
+	if strings.Contains(rule, "*") {
+		if _, err := path.Match(rule, ""); err != nil {
+			return fmt.Errorf("invalid rule %q: %w", rule, err)
+		}
+		m.patterns = append(m.patterns, rule)
+		return nil
+	}
+
+	ascii, err := idna.Lookup.ToASCII(rule)
+	if err != nil {
+		return fmt.Errorf("invalid rule %q: %w", rule, err)
+	}
+	m.domains[ascii] = struct{}{}
+
+	return nil
+}
+
+// match возвращает правило, под которое попадает host.
+func (m matcher) match(host string) (string, bool) {
+	if _, ok := m.domains[host]; ok {
+		return host, true
+	}
+
+	for suffix := host; ; {
+		i := strings.IndexByte(suffix, '.')
+		if i < 0 {
+			break
+		}
+		suffix = suffix[i+1:]
+
+		if _, ok := m.domains[suffix]; ok {
+			return suffix, true
+		}
+
+		if _, ok := m.subdomains[suffix]; ok {
+			return "*." + suffix, true
+		}
+	}
+
+	for _, pattern := range m.patterns {
+		if ok, _ := path.Match(pattern, host); ok {
+			return pattern, true
+		}
+	}
+
+	return "", false
+}
+
+func (m matcher) size() int {
+	return len(m.domains) + len(m.subdomains) + len(m.patterns)
+}
+
+func (m matcher) empty() bool {
+	return m.size() == 0
+}
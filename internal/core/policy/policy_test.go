@@ -0,0 +1,164 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bubaew95/yandex-go-learn/config"
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/constants"
+)
+
+func writeList(t *testing.T, name, content string) string {
+	t.Helper()
+
+	filePath := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0o644))
+
+	return filePath
+}
+
+func TestPolicy_Check(t *testing.T) {
+	t.Parallel()
+
+	blocklist := writeList(t, "blocklist.txt", `
+# фишинг
+evil.com
+*.tracker.net   # только поддомены
+login-*.example.*
+пример.рф
+`)
+	allowlist := writeList(t, "allowlist.txt", "example.com\nexample.org\n*.tracker.net\n")
+
+	blockOnly, err := New(config.Config{PolicyBlocklistFile: blocklist})
+	require.NoError(t, err)
+
+	both, err := New(config.Config{PolicyBlocklistFile: blocklist, PolicyAllowlistFile: allowlist})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		policy *Policy
+		host   string
+		reason string
+		rule   string
+	}{
+		{name: "blocked domain", policy: blockOnly, host: "evil.com", reason: constants.URLReasonBlockedDomain, rule: "evil.com"},
+		{name: "blocked subdomain", policy: blockOnly, host: "www.Evil.com.", reason: constants.URLReasonBlockedDomain, rule: "evil.com"},
+		{name: "suffix is not a subdomain", policy: blockOnly, host: "notevil.com"},
+		{name: "wildcard subdomain", policy: blockOnly, host: "a.b.tracker.net", reason: constants.URLReasonBlockedDomain, rule: "*.tracker.net"},
+		{name: "wildcard skips apex", policy: blockOnly, host: "tracker.net"},
+		{name: "pattern", policy: blockOnly, host: "login-bank.example.org", reason: constants.URLReasonBlockedDomain, rule: "login-*.example.*"},
+		{name: "idn rule", policy: blockOnly, host: "xn--e1afmkfd.xn--p1ai", reason: constants.URLReasonBlockedDomain, rule: "xn--e1afmkfd.xn--p1ai"},
+		{name: "not listed", policy: blockOnly, host: "example.com"},
+		{name: "allowed", policy: both, host: "sub.example.com"},
+		{name: "not allowed", policy: both, host: "example.net", reason: constants.URLReasonDomainNotAllowed},
+		{name: "blocklist wins", policy: both, host: "x.tracker.net", reason: constants.URLReasonBlockedDomain, rule: "*.tracker.net"},
+		{name: "blocked pattern inside allowlist", policy: both, host: "login-x.example.com", reason: constants.URLReasonBlockedDomain, rule: "login-*.example.*"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.policy.Check(tt.host)
+			if tt.reason == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorIs(t, err, constants.ErrForbiddenURL)
+
+			var policyErr *constants.PolicyError
+			require.True(t, errors.As(err, &policyErr))
+			assert.Equal(t, tt.reason, policyErr.Reason)
+			assert.Equal(t, tt.rule, policyErr.Rule)
+		})
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	t.Parallel()
+
+	_, err := New(config.Config{PolicyBlocklistFile: filepath.Join(t.TempDir(), "missing.txt")})
+	require.Error(t, err)
+
+	_, err = New(config.Config{PolicyBlocklistFile: writeList(t, "bad.txt", "ok.com\nbad[.com\n")})
+	require.ErrorContains(t, err, "bad.txt:2")
+
+	p, err := New(config.Config{})
+	require.NoError(t, err)
+	require.NoError(t, p.Check("example.com"))
+}
+
+func TestPolicy_Reload(t *testing.T) {
+	t.Parallel()
+
+	blocklist := writeList(t, "blocklist.txt", "evil.com\n")
+	p, err := New(config.Config{PolicyBlocklistFile: blocklist})
+	require.NoError(t, err)
+
+	// Ошибка в файле не сбрасывает действующие правила
+	require.NoError(t, os.WriteFile(blocklist, []byte("[\n"), 0o644))
+	require.Error(t, p.Reload())
+	require.ErrorIs(t, p.Check("evil.com"), constants.ErrForbiddenURL)
+
+	require.NoError(t, os.WriteFile(blocklist, []byte("bad.com\n"), 0o644))
+	require.NoError(t, p.Reload())
+	require.NoError(t, p.Check("evil.com"))
+	require.ErrorIs(t, p.Check("bad.com"), constants.ErrForbiddenURL)
+}
+
+func TestPolicy_Run(t *testing.T) {
+	t.Parallel()
+
+	blocklist := writeList(t, "blocklist.txt", "evil.com\n")
+
+	t.Run("file changed", func(t *testing.T) {
+		p, err := New(config.Config{
+			PolicyBlocklistFile:  blocklist,
+			PolicyReloadInterval: config.Duration{Duration: 10 * time.Millisecond},
+		})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		p.Run(ctx, &wg)
+		defer func() {
+			cancel()
+			wg.Wait()
+		}()
+
+		require.NoError(t, os.WriteFile(blocklist, []byte("evil.com\nbad.com\n"), 0o644))
+		assert.Eventually(t, func() bool {
+			return p.Check("bad.com") != nil
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("trigger", func(t *testing.T) {
+		other := writeList(t, "other.txt", "evil.com\n")
+		p, err := New(config.Config{PolicyBlocklistFile: other})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		p.Run(ctx, &wg)
+		defer func() {
+			cancel()
+			wg.Wait()
+		}()
+
+		require.NoError(t, os.WriteFile(other, []byte("bad.com\n"), 0o644))
+		p.Trigger()
+		assert.Eventually(t, func() bool {
+			return p.Check("bad.com") != nil && p.Check("evil.com") == nil
+		}, time.Second, 10*time.Millisecond)
+	})
+}
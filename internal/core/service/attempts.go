@@ -0,0 +1,80 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// attemptLimiter ограничивает число неудачных попыток ввода пароля для каждой ссылки.
+//
+// Неудачи считаются в окне, которое начинается с первой из них. Когда их число
+// достигает max, попытки для ссылки блокируются до конца окна; успешный ввод
+// сбрасывает счётчик. Состояние хранится в памяти экземпляра сервиса.
+type attemptLimiter struct {
+	mx       sync.Mutex
+	max      int
+	window   time.Duration
+	failures map[string]attempts
+}
+
+// attempts — неудачные попытки для одной ссылки.
+type attempts struct {
+	count int
+	since time.Time
+}
+
+func newAttemptLimiter(max int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		max:      max,
+		window:   window,
+		failures: make(map[string]attempts),
+	}
+}
+
+// allow сообщает, можно ли сейчас проверять пароль ссылки id.
+func (l *attemptLimiter) allow(id string, now time.Time) bool {
+	if l.max <= 0 {
+		return true
+	}
+
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	a, ok := l.failures[id]
+	if !ok {
+		return true
+	}
+
+	if now.Sub(a.since) >= l.window {
+		delete(l.failures, id)
+		return true
+	}
+
+	return a.count < l.max
+}
+
+// fail учитывает неудачную попытку для ссылки id.
+func (l *attemptLimiter) fail(id string, now time.Time) {
+	if l.max <= 0 {
+		return
+	}
+
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	a, ok := l.failures[id]
+	if !ok || now.Sub(a.since) >= l.window {
+		a = attempts{since: now}
+	}
+
+	a.count++
+	l.failures[id] = a
+}
+
+// reset сбрасывает счётчик после успешного ввода пароля.
+func (l *attemptLimiter) reset(id string) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	delete(l.failures, id)
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttemptLimiter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newAttemptLimiter(2, time.Minute)
+
+	assert.True(t, l.allow("a", now))
+	l.fail("a", now)
+	assert.True(t, l.allow("a", now))
+	l.fail("a", now.Add(10*time.Second))
+
+	// Лимит считается отдельно для каждой ссылки
+	assert.False(t, l.allow("a", now.Add(30*time.Second)))
+	assert.True(t, l.allow("b", now.Add(30*time.Second)))
+
+	// Окно отсчитывается от первой неудачи
+	assert.True(t, l.allow("a", now.Add(time.Minute)))
+
+	l.fail("a", now.Add(time.Minute))
+	l.fail("a", now.Add(time.Minute))
+	assert.False(t, l.allow("a", now.Add(time.Minute)))
+
+	l.reset("a")
+	assert.True(t, l.allow("a", now.Add(time.Minute)))
+}
+
+func TestAttemptLimiter_Disabled(t *testing.T) {
+	now := time.Now()
+	l := newAttemptLimiter(0, time.Minute)
+
+	for i := 0; i < 10; i++ {
+		l.fail("a", now)
+	}
+	assert.True(t, l.allow("a", now))
+}
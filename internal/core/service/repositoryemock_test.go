@@ -7,6 +7,8 @@ import (
 
 	model "github.com/bubaew95/yandex-go-learn/internal/core/model"
 	mock "github.com/stretchr/testify/mock"
+
+	time "time"
 )
 
 // MockShortenerRepository is an autogenerated mock type for the ShortenerRepository type
@@ -50,9 +52,67 @@ func (_m *MockShortenerRepository) DeleteUserURLS(ctx context.Context, items []m
 	return r0
 }
 
-// GetURLByID provides a mock function with given fields: ctx, id
-func (_m *MockShortenerRepository) GetURLByID(ctx context.Context, id string) (string, error) {
-	ret := _m.Called(ctx, id)
+// ExpireURLs provides a mock function with given fields: ctx, expiredBefore, limit
+func (_m *MockShortenerRepository) ExpireURLs(ctx context.Context, expiredBefore time.Time, limit int) (int, error) {
+	ret := _m.Called(ctx, expiredBefore, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ExpireURLs")
+	}
+
+	var r0 int
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time, int) (int, error)); ok {
+		return rf(ctx, expiredBefore, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time, int) int); ok {
+		r0 = rf(ctx, expiredBefore, limit)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time, int) error); ok {
+		r1 = rf(ctx, expiredBefore, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDeletedURLs provides a mock function with given fields: ctx, userID, deletedAfter
+func (_m *MockShortenerRepository) GetDeletedURLs(ctx context.Context, userID string, deletedAfter time.Time) ([]model.ShortenURL, error) {
+	ret := _m.Called(ctx, userID, deletedAfter)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetDeletedURLs")
+	}
+
+	var r0 []model.ShortenURL
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) ([]model.ShortenURL, error)); ok {
+		return rf(ctx, userID, deletedAfter)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) []model.ShortenURL); ok {
+		r0 = rf(ctx, userID, deletedAfter)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.ShortenURL)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Time) error); ok {
+		r1 = rf(ctx, userID, deletedAfter)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetURLByID provides a mock function with given fields: ctx, id, check
+func (_m *MockShortenerRepository) GetURLByID(ctx context.Context, id string, check func(string) error) (string, error) {
+	ret := _m.Called(ctx, id, check)
 
 	if len(ret) == 0 {
 		panic("no return value specified for GetURLByID")
@@ -60,17 +120,17 @@ func (_m *MockShortenerRepository) GetURLByID(ctx context.Context, id string) (s
 
 	var r0 string
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) (string, error)); ok {
-		return rf(ctx, id)
+	if rf, ok := ret.Get(0).(func(context.Context, string, func(string) error) (string, error)); ok {
+		return rf(ctx, id, check)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string) string); ok {
-		r0 = rf(ctx, id)
+	if rf, ok := ret.Get(0).(func(context.Context, string, func(string) error) string); ok {
+		r0 = rf(ctx, id, check)
 	} else {
 		r0 = ret.Get(0).(string)
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, id)
+	if rf, ok := ret.Get(1).(func(context.Context, string, func(string) error) error); ok {
+		r1 = rf(ctx, id, check)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -106,24 +166,54 @@ func (_m *MockShortenerRepository) GetURLByOriginalURL(ctx context.Context, orig
 	return r0, r1
 }
 
+// GetURLHistory provides a mock function with given fields: ctx, id, userID
+func (_m *MockShortenerRepository) GetURLHistory(ctx context.Context, id string, userID string) ([]model.URLEdit, error) {
+	ret := _m.Called(ctx, id, userID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetURLHistory")
+	}
+
+	var r0 []model.URLEdit
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) ([]model.URLEdit, error)); ok {
+		return rf(ctx, id, userID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) []model.URLEdit); ok {
+		r0 = rf(ctx, id, userID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.URLEdit)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, id, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetURLSByUserID provides a mock function with given fields: ctx, userID
-func (_m *MockShortenerRepository) GetURLSByUserID(ctx context.Context, userID string) (map[string]string, error) {
+func (_m *MockShortenerRepository) GetURLSByUserID(ctx context.Context, userID string) ([]model.ShortenURL, error) {
 	ret := _m.Called(ctx, userID)
 
 	if len(ret) == 0 {
 		panic("no return value specified for GetURLSByUserID")
 	}
 
-	var r0 map[string]string
+	var r0 []model.ShortenURL
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) (map[string]string, error)); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]model.ShortenURL, error)); ok {
 		return rf(ctx, userID)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string) map[string]string); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, string) []model.ShortenURL); ok {
 		r0 = rf(ctx, userID)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(map[string]string)
+			r0 = ret.Get(0).([]model.ShortenURL)
 		}
 	}
 
@@ -137,21 +227,33 @@ func (_m *MockShortenerRepository) GetURLSByUserID(ctx context.Context, userID s
 }
 
 // InsertURLs provides a mock function with given fields: ctx, urls
-func (_m *MockShortenerRepository) InsertURLs(ctx context.Context, urls []model.ShortenerURLMapping) error {
+func (_m *MockShortenerRepository) InsertURLs(ctx context.Context, urls []model.BatchURL) ([]model.BatchURLResult, error) {
 	ret := _m.Called(ctx, urls)
 
 	if len(ret) == 0 {
 		panic("no return value specified for InsertURLs")
 	}
 
-	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, []model.ShortenerURLMapping) error); ok {
+	var r0 []model.BatchURLResult
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []model.BatchURL) ([]model.BatchURLResult, error)); ok {
+		return rf(ctx, urls)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []model.BatchURL) []model.BatchURLResult); ok {
 		r0 = rf(ctx, urls)
 	} else {
-		r0 = ret.Error(0)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.BatchURLResult)
+		}
 	}
 
-	return r0
+	if rf, ok := ret.Get(1).(func(context.Context, []model.BatchURL) error); ok {
+		r1 = rf(ctx, urls)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
 
 // Ping provides a mock function with given fields: ctx
@@ -172,17 +274,109 @@ func (_m *MockShortenerRepository) Ping(ctx context.Context) error {
 	return r0
 }
 
-// SetURL provides a mock function with given fields: ctx, id, url
-func (_m *MockShortenerRepository) SetURL(ctx context.Context, id string, url string) error {
-	ret := _m.Called(ctx, id, url)
+// PurgeDeletedURLs provides a mock function with given fields: ctx, deletedBefore, limit, reuseIDs
+func (_m *MockShortenerRepository) PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time, limit int, reuseIDs bool) (int, error) {
+	ret := _m.Called(ctx, deletedBefore, limit, reuseIDs)
+
+	if len(ret) == 0 {
+		panic("no return value specified for PurgeDeletedURLs")
+	}
+
+	var r0 int
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time, int, bool) (int, error)); ok {
+		return rf(ctx, deletedBefore, limit, reuseIDs)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time, int, bool) int); ok {
+		r0 = rf(ctx, deletedBefore, limit, reuseIDs)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time, int, bool) error); ok {
+		r1 = rf(ctx, deletedBefore, limit, reuseIDs)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetURL provides a mock function with given fields: ctx, link
+func (_m *MockShortenerRepository) SetURL(ctx context.Context, link model.ShortenURL) error {
+	ret := _m.Called(ctx, link)
 
 	if len(ret) == 0 {
 		panic("no return value specified for SetURL")
 	}
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
-		r0 = rf(ctx, id, url)
+	if rf, ok := ret.Get(0).(func(context.Context, model.ShortenURL) error); ok {
+		r0 = rf(ctx, link)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UndeleteURL provides a mock function with given fields: ctx, id, userID, deletedAfter
+func (_m *MockShortenerRepository) UndeleteURL(ctx context.Context, id string, userID string, deletedAfter time.Time) error {
+	ret := _m.Called(ctx, id, userID, deletedAfter)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UndeleteURL")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, time.Time) error); ok {
+		r0 = rf(ctx, id, userID, deletedAfter)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UnlockURL provides a mock function with given fields: ctx, id, verify, check
+func (_m *MockShortenerRepository) UnlockURL(ctx context.Context, id string, verify func(string) error, check func(string) error) (string, error) {
+	ret := _m.Called(ctx, id, verify, check)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UnlockURL")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, func(string) error, func(string) error) (string, error)); ok {
+		return rf(ctx, id, verify, check)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, func(string) error, func(string) error) string); ok {
+		r0 = rf(ctx, id, verify, check)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, func(string) error, func(string) error) error); ok {
+		r1 = rf(ctx, id, verify, check)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateURL provides a mock function with given fields: ctx, id, userID, url, submittedURL
+func (_m *MockShortenerRepository) UpdateURL(ctx context.Context, id string, userID string, url string, submittedURL string) error {
+	ret := _m.Called(ctx, id, userID, url, submittedURL)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpdateURL")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, string) error); ok {
+		r0 = rf(ctx, id, userID, url, submittedURL)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -3,40 +3,123 @@
 package service
 
 import (
+	"cmp"
 	"context"
+	"errors"
+	"expvar"
 	"fmt"
-	"math/rand"
+	neturl "net/url"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
 	"github.com/bubaew95/yandex-go-learn/config"
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/constants"
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/logger"
+	"github.com/bubaew95/yandex-go-learn/internal/core/canonical"
 	"github.com/bubaew95/yandex-go-learn/internal/core/model"
 )
 
+// purgeMetrics — счётчики окончательного удаления ссылок, доступные по /debug/vars:
+// purged — всего удалено ссылок, runs — число запусков, errors — число неудачных запусков,
+// last_purged и last_run — результат и время последнего запуска.
+var purgeMetrics = expvar.NewMap("shortener_purge")
+
+// expiryMetrics — счётчики пометки истёкших ссылок удалёнными, доступные по /debug/vars:
+// expired — всего помечено ссылок, runs — число запусков, errors — число неудачных запусков.
+var expiryMetrics = expvar.NewMap("shortener_expiry")
+
+// Ограничения длины пользовательского ID. Верхняя граница с запасом
+// меньше размера колонки id в PostgreSQL (100 символов).
+const (
+	aliasMinLength = 3
+	aliasMaxLength = 64
+)
+
+// maxIDAttempts — предел попыток подобрать свободный короткий ID для ссылки или пакета.
+// Случайные и хеш-ID сталкиваются редко, поэтому исчерпание предела говорит о
+// заполненном пространстве ID или неподходящей стратегии, а не о случайности.
+const maxIDAttempts = 32
+
+// reservedAliases — первые сегменты путей роутера, которые нельзя занять пользовательским ID.
+var reservedAliases = []string{"ping", "api", "debug"}
+
 // ShortenerRepository определяет контракт для репозитория сокращённых URL.
 // Этот интерфейс реализуется различными адаптерами хранилищ (например, файловая система, PostgreSQL).
 //
 //go:generate go run github.com/vektra/mockery/v2@v2.52.2 --name=ShortenerRepository --filename=repositoryemock_test.go --inpackage
 type ShortenerRepository interface {
-	// GetURLByID возвращает оригинальный URL по его сокращённому идентификатору.
-	GetURLByID(ctx context.Context, id string) (string, error)
+	// GetURLByID возвращает URL для перехода (см. model.ShortenURL.RedirectURL) по сокращённому идентификатору.
+	// Для удалённой ссылки возвращает ErrIsDeleted, для истёкшей — ErrExpired.
+	// У ссылки с лимитом переходов атомарно списывает один переход,
+	// а если лимит уже исчерпан, возвращает ErrNoClicksLeft.
+	// Для ссылки с паролем возвращает ErrPasswordRequired, переход не выполняется.
+	// Если задана check, URL ссылки проверяется ею до списания перехода, и ошибка check
+	// возвращается без перехода.
+	GetURLByID(ctx context.Context, id string, check func(url string) error) (string, error)
+
+	// UnlockURL выполняет переход по ссылке, защищённой паролем: проверяет те же условия,
+	// что и GetURLByID, затем передаёт хеш пароля в verify и только при успешной проверке
+	// возвращает URL для перехода (и списывает переход у ссылки с лимитом).
+	// Для ссылки без пароля verify не вызывается. Функция check — как у GetURLByID.
+	UnlockURL(ctx context.Context, id string, verify func(passwordHash string) error, check func(url string) error) (string, error)
 
 	// GetURLByOriginalURL ищет короткий ID по оригинальному URL.
 	GetURLByOriginalURL(ctx context.Context, originalURL string) (string, bool)
 
-	// SetURL сохраняет соответствие между коротким ID и оригинальным URL.
-	SetURL(ctx context.Context, id string, url string) error
+	// SetURL сохраняет новую ссылку: короткий ID (ShortURL), оригинальный URL в каноническом
+	// и переданном пользователем виде, срок жизни, лимит переходов и хеш пароля.
+	// Уникальность проверяется по каноническому виду.
+	// Владельцем становится пользователь из контекста.
+	// Если ID уже занят, возвращает ErrIDConflict, если URL уже сокращён — ErrUniqueIndex.
+	SetURL(ctx context.Context, link model.ShortenURL) error
+
+	// InsertURLs сохраняет пакет ссылок за одно обращение к хранилищу и возвращает
+	// результат для каждой записи в порядке входного списка. Записи с уже сокращённым
+	// URL или занятым ID не сохраняются, ошибка сообщается в результате записи.
+	InsertURLs(ctx context.Context, urls []model.BatchURL) ([]model.BatchURLResult, error)
+
+	// GetURLSByUserID возвращает все сокращённые ссылки, привязанные к пользователю.
+	GetURLSByUserID(ctx context.Context, userID string) ([]model.ShortenURL, error)
 
-	// InsertURLs добавляет список сокращённых URL (например, при массовом импорте).
-	InsertURLs(ctx context.Context, urls []model.ShortenerURLMapping) error
+	// UpdateURL заменяет оригинальный URL ссылки id, принадлежащей userID, на url в каноническом виде
+	// и submittedURL в переданном пользователем виде (пусто, если совпадает с url), а прежний URL
+	// для перехода сохраняет в истории изменений ссылки. Замена на текущие URL ничего не меняет.
+	// Если ссылки нет, возвращает ErrNotFound, если она принадлежит другому пользователю — ErrNotOwner,
+	// если удалена — ErrIsDeleted, если url уже сокращён другой ссылкой — ErrUniqueIndex.
+	UpdateURL(ctx context.Context, id string, userID string, url string, submittedURL string) error
 
-	// GetURLSByUserID возвращает карту всех сокращённых ссылок, привязанных к пользователю.
-	GetURLSByUserID(ctx context.Context, userID string) (map[string]string, error)
+	// GetURLHistory возвращает историю изменений ссылки id, принадлежащей userID,
+	// от первого изменения к последнему. Ошибки — как у UpdateURL.
+	GetURLHistory(ctx context.Context, id string, userID string) ([]model.URLEdit, error)
 
 	// DeleteUserURLS помечает ссылки как удалённые по запросу пользователя.
 	DeleteUserURLS(ctx context.Context, items []model.URLToDelete) error
 
+	// GetDeletedURLs возвращает ссылки пользователя, удалённые не раньше deletedAfter
+	// и ещё не очищенные окончательно. Ссылки с истёкшим сроком жизни не возвращаются.
+	GetDeletedURLs(ctx context.Context, userID string, deletedAfter time.Time) ([]model.ShortenURL, error)
+
+	// UndeleteURL снимает пометку удаления со ссылки id, принадлежащей userID, если она
+	// удалена не раньше deletedAfter. Для неудалённой ссылки ничего не делает.
+	// Если ссылки нет, возвращает ErrNotFound, если она принадлежит другому пользователю — ErrNotOwner,
+	// если удалена раньше deletedAfter или уже очищена — ErrRestoreWindowPassed,
+	// если истёк срок её жизни — ErrExpired.
+	UndeleteURL(ctx context.Context, id string, userID string, deletedAfter time.Time) error
+
+	// ExpireURLs помечает удалёнными не более limit ссылок, срок жизни которых истёк к expiredBefore,
+	// и возвращает их число. Временем удаления считается время истечения.
+	ExpireURLs(ctx context.Context, expiredBefore time.Time, limit int) (int, error)
+
+	// PurgeDeletedURLs окончательно удаляет не более limit ссылок, удалённых раньше deletedBefore,
+	// и возвращает их число. При reuseIDs короткие ID освобождаются для повторной выдачи,
+	// иначе остаются занятыми, а освобождается только оригинальный URL.
+	PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time, limit int, reuseIDs bool) (int, error)
+
 	// Ping проверяет доступность репозитория.
 	Ping(ctx context.Context) error
 
@@ -44,71 +127,304 @@ type ShortenerRepository interface {
 	Close() error
 }
 
+// IDGenerator генерирует короткие ID ссылок. Реализации находятся в пакете idgen.
+type IDGenerator interface {
+	// Generate возвращает ID для оригинального URL. attempt — номер попытки начиная с 0:
+	// если ID уже занят, запрашивается новый с увеличенным номером.
+	Generate(url string, attempt int) (string, error)
+}
+
+// URLPolicy решает, можно ли сокращать ссылки на хост. Реализация находится в пакете policy.
+type URLPolicy interface {
+	// Check возвращает ErrForbiddenURL (*constants.PolicyError с причиной), если хост запрещён.
+	Check(host string) error
+}
+
 // ShortenerService реализует бизнес-логику для сокращения URL.
 // Поддерживает генерацию уникальных ссылок, сохранение, извлечение и отложенное удаление.
 type ShortenerService struct {
 	repository ShortenerRepository
+	generator  IDGenerator
 	config     config.Config
-	mx         *sync.Mutex
 	deleteChan chan model.URLToDelete
+	attempts   *attemptLimiter
+	validator  urlValidator
+	canonical  canonical.Canonicalizer
+	policy     URLPolicy
 }
 
 // NewShortenerService создаёт и инициализирует новый экземпляр ShortenerService.
-// Принимает хранилище и конфигурацию приложения.
-func NewShortenerService(r ShortenerRepository, cfg config.Config) *ShortenerService {
+// Принимает хранилище, генератор коротких ID и конфигурацию приложения.
+func NewShortenerService(r ShortenerRepository, g IDGenerator, cfg config.Config) *ShortenerService {
 	return &ShortenerService{
 		repository: r,
+		generator:  g,
 		config:     cfg,
-		mx:         &sync.Mutex{},
 		deleteChan: make(chan model.URLToDelete),
+		attempts:   newAttemptLimiter(cfg.PasswordMaxAttempts, cfg.PasswordLockout.Duration),
+		validator:  newURLValidator(cfg.MaxURLLength, cfg.URLAllowedSchemes),
+		canonical:  canonical.New(cfg),
 	}
 }
 
+// SetPolicy задаёт политику доменов, по которой проверяются новые ссылки и,
+// при config.PolicyDisableExisting, переходы по существующим. Без политики домены не проверяются.
+func (s *ShortenerService) SetPolicy(p URLPolicy) {
+	s.policy = p
+}
+
 // GenerateURL генерирует уникальный идентификатор для заданного URL и сохраняет его.
-// Повторяет генерацию, пока не будет найден уникальный ID.
-func (s ShortenerService) GenerateURL(ctx context.Context, url string, randomStringLength int) (string, error) {
-	s.mx.Lock()
-	defer s.mx.Unlock()
+// URL сохраняется в каноническом виде (см. пакет canonical) вместе с переданным,
+// переход по ссылке выполняется на переданный.
+//
+// Свободный ID не проверяется заранее: ссылка сразу записывается в хранилище,
+// а при ErrIDConflict генерируется следующий ID. Уникальность обеспечивает само
+// хранилище, поэтому создание ссылок не блокирует друг друга и безопасно
+// при нескольких экземплярах сервиса.
+//
+// Возвращает ErrInvalidURL (*constants.URLError с причиной), если URL пустой, длиннее
+// config.MaxURLLength (тогда и ErrURLTooLong), содержит управляющие символы, не разбирается,
+// не имеет хоста или его схемы нет в config.URLAllowedSchemes; ErrForbiddenURL, если домен
+// запрещён политикой (см. SetPolicy); ErrInvalidExpiry,
+// если срок жизни задан неверно, ErrInvalidClicks, если лимит переходов отрицательный,
+// ErrUniqueIndex, если URL уже сокращён, ErrIDAttemptsExhausted, если за maxIDAttempts
+// попыток свободный ID не найден, и ошибку генератора, если новый ID получить не удалось.
+func (s ShortenerService) GenerateURL(ctx context.Context, url string, opts model.LinkOptions) (string, error) {
+	link, err := s.newLink(url, opts, time.Now())
+	if err != nil {
+		return "", err
+	}
 
-	var genID string
-	for {
-		genID = s.RandStringBytes(randomStringLength)
-		_, err := s.repository.GetURLByID(ctx, genID)
+	for attempt := 0; attempt < maxIDAttempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
 
+		genID, err := s.generator.Generate(link.OriginalURL, attempt)
 		if err != nil {
-			err := s.repository.SetURL(ctx, genID, url)
-			if err != nil {
-				return "", err
-			}
+			return "", err
+		}
+
+		link.ShortURL = genID
+		err = s.repository.SetURL(ctx, link)
+		if errors.Is(err, constants.ErrIDConflict) {
+			logger.Log.Debug("Short id collision", zap.String("id", genID), zap.Int("attempt", attempt))
+			continue
+		}
 
-			break
+		if err != nil {
+			return "", err
 		}
+
+		return s.generateResponseURL(genID), nil
 	}
 
-	return s.generateResponseURL(genID), nil
+	return "", fmt.Errorf("%w: %d attempts", constants.ErrIDAttemptsExhausted, maxIDAttempts)
 }
 
-// RandStringBytes генерирует случайную строку заданной длины из латинских букв.
-func (s ShortenerService) RandStringBytes(n int) string {
+// SetAlias сохраняет ссылку под выбранным пользователем коротким ID.
+//
+// Ссылка записывается через тот же SetURL, что и сгенерированные, поэтому
+// переход по ней не отличается от обычного. Возвращает ErrInvalidAlias, если ID
+// не подходит по длине или содержит символы кроме латинских букв, цифр, "-" и "_",
+// ErrReservedAlias, если ID совпадает с путём роутера, ErrIDConflict, если ID занят,
+// ErrUniqueIndex, если URL уже сокращён, ErrInvalidURL, ErrForbiddenURL, ErrInvalidExpiry и ErrInvalidClicks.
+func (s ShortenerService) SetAlias(ctx context.Context, url string, alias string, opts model.LinkOptions) (string, error) {
+	if err := validateAlias(alias); err != nil {
+		return "", err
+	}
+
+	link, err := s.newLink(url, opts, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	link.ShortURL = alias
+	if err = s.repository.SetURL(ctx, link); err != nil {
+		return "", err
+	}
+
+	return s.generateResponseURL(alias), nil
+}
+
+// validateAlias проверяет длину, набор символов и зарезервированные имена пользовательского ID.
+func validateAlias(alias string) error {
+	if len(alias) < aliasMinLength || len(alias) > aliasMaxLength {
+		return fmt.Errorf("%w: length must be between %d and %d", constants.ErrInvalidAlias, aliasMinLength, aliasMaxLength)
+	}
 
-	const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	for i := 0; i < len(alias); i++ {
+		c := alias[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_') {
+			return fmt.Errorf("%w: character %q is not allowed", constants.ErrInvalidAlias, c)
+		}
+	}
 
-	b := make([]byte, n)
-	for i := range b {
-		b[i] = letterBytes[rand.Intn(len(letterBytes))]
+	for _, reserved := range reservedAliases {
+		if strings.EqualFold(alias, reserved) {
+			return fmt.Errorf("%w: %q", constants.ErrReservedAlias, alias)
+		}
 	}
 
-	return string(b)
+	return nil
+}
+
+// newLink проверяет URL и параметры новой ссылки и возвращает запись без короткого ID
+// с URL в каноническом виде.
+func (s ShortenerService) newLink(url string, opts model.LinkOptions, now time.Time) (model.ShortenURL, error) {
+	valid, err := s.validator.validate(url)
+	if err != nil {
+		return model.ShortenURL{}, err
+	}
+
+	if err = s.checkPolicy(valid); err != nil {
+		return model.ShortenURL{}, err
+	}
+
+	expiresAt, err := s.expiresAt(opts, now)
+	if err != nil {
+		return model.ShortenURL{}, err
+	}
+
+	if opts.MaxClicks < 0 {
+		return model.ShortenURL{}, fmt.Errorf("%w: max_clicks must not be negative", constants.ErrInvalidClicks)
+	}
+
+	link := model.ShortenURL{
+		OriginalURL: s.canonical.URL(valid),
+		ExpiresAt:   expiresAt,
+	}
+
+	if link.OriginalURL != valid {
+		link.SubmittedURL = valid
+	}
+
+	if opts.MaxClicks > 0 {
+		clicks := opts.MaxClicks
+		link.ClicksLeft = &clicks
+	}
+
+	if opts.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(opts.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return model.ShortenURL{}, fmt.Errorf("%w: %w", constants.ErrInvalidPassword, err)
+		}
+		link.PasswordHash = string(hash)
+	}
+
+	return link, nil
+}
+
+// expiresAt вычисляет момент истечения ссылки по параметрам запроса.
+//
+// Если срок не задан, действует config.DefaultLinkTTL, а при его отсутствии — config.MaxLinkTTL.
+// Возвращает nil для бессрочной ссылки и ErrInvalidExpiry, если заданы оба параметра,
+// срок не положительный, момент истечения уже прошёл или срок больше config.MaxLinkTTL.
+func (s ShortenerService) expiresAt(opts model.LinkOptions, now time.Time) (*time.Time, error) {
+	var ttl time.Duration
+	switch {
+	case opts.ExpiresIn != 0 && opts.ExpiresAt != nil:
+		return nil, fmt.Errorf("%w: expires_in and expires_at are mutually exclusive", constants.ErrInvalidExpiry)
+	case opts.ExpiresIn < 0:
+		return nil, fmt.Errorf("%w: expires_in must be positive", constants.ErrInvalidExpiry)
+	case opts.ExpiresIn > 0:
+		ttl = time.Duration(opts.ExpiresIn) * time.Second
+	case opts.ExpiresAt != nil:
+		ttl = opts.ExpiresAt.Sub(now)
+		if ttl <= 0 {
+			return nil, fmt.Errorf("%w: expires_at is in the past", constants.ErrInvalidExpiry)
+		}
+	default:
+		ttl = cmp.Or(s.config.DefaultLinkTTL.Duration, s.config.MaxLinkTTL.Duration)
+		if ttl <= 0 {
+			return nil, nil
+		}
+	}
+
+	if maxTTL := s.config.MaxLinkTTL.Duration; maxTTL > 0 && ttl > maxTTL {
+		return nil, fmt.Errorf("%w: exceeds maximum of %s", constants.ErrInvalidExpiry, maxTTL)
+	}
+
+	if opts.ExpiresAt != nil {
+		expiresAt := opts.ExpiresAt.UTC()
+		return &expiresAt, nil
+	}
+
+	expiresAt := now.Add(ttl).UTC()
+	return &expiresAt, nil
 }
 
 // GetURLByID возвращает оригинальный URL по короткому ID.
-func (s ShortenerService) GetURLByID(ctx context.Context, id string) (string, error) {
-	return s.repository.GetURLByID(ctx, id)
+//
+// Для ссылки с паролем без password возвращает ErrPasswordRequired, с неверным
+// паролем — ErrWrongPassword. После config.PasswordMaxAttempts неудачных попыток
+// пароль ссылки не проверяется в течение config.PasswordLockout, а возвращается
+// ErrTooManyAttempts.
+//
+// При config.PolicyDisableExisting для ссылки на домен, запрещённый политикой после её создания,
+// возвращает ErrForbiddenURL. Политика проверяется до списания перехода у ссылки с лимитом.
+func (s ShortenerService) GetURLByID(ctx context.Context, id string, password string) (string, error) {
+	var check func(url string) error
+	if s.config.PolicyDisableExisting {
+		check = s.checkPolicy
+	}
+
+	return s.followURL(ctx, id, password, check)
+}
+
+// checkPolicy проверяет хост URL по политике доменов, если она задана.
+// URL должен быть уже проверен: неразбираемый URL политикой не проверяется.
+func (s ShortenerService) checkPolicy(rawURL string) error {
+	if s.policy == nil {
+		return nil
+	}
+
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+
+	return s.policy.Check(u.Hostname())
+}
+
+// followURL выполняет переход по ссылке id с проверкой пароля и URL ссылки функцией check.
+func (s ShortenerService) followURL(ctx context.Context, id string, password string, check func(url string) error) (string, error) {
+	if password == "" {
+		return s.repository.GetURLByID(ctx, id, check)
+	}
+
+	if !s.attempts.allow(id, time.Now()) {
+		return "", constants.ErrTooManyAttempts
+	}
+
+	url, err := s.repository.UnlockURL(ctx, id, func(passwordHash string) error {
+		if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)) != nil {
+			return constants.ErrWrongPassword
+		}
+
+		return nil
+	}, check)
+	if errors.Is(err, constants.ErrWrongPassword) {
+		s.attempts.fail(id, time.Now())
+		return "", err
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	s.attempts.reset(id)
+	return url, nil
 }
 
 // GetURLByOriginalURL возвращает короткий URL по оригинальному, если он уже существует.
+// URL сравнивается в каноническом виде.
 func (s ShortenerService) GetURLByOriginalURL(ctx context.Context, originalURL string) (string, bool) {
-	id, ok := s.repository.GetURLByOriginalURL(ctx, originalURL)
+	if valid, err := s.validator.validate(originalURL); err == nil {
+		originalURL = valid
+	}
+
+	id, ok := s.repository.GetURLByOriginalURL(ctx, s.canonical.URL(originalURL))
 
 	if ok {
 		return s.generateResponseURL(id), ok
@@ -126,38 +442,122 @@ func (s ShortenerService) generateResponseURL(id string) string {
 	return fmt.Sprintf("%s/%s", s.config.BaseURL, id)
 }
 
-// InsertURLs сохраняет пакет сокращённых ссылок и возвращает сгенерированные короткие ссылки.
+// InsertURLs сокращает пакет ссылок и возвращает результат для каждого элемента
+// в порядке входного списка.
+//
+// Короткие ID генерируются так же, как в GenerateURL; CorrelationID только
+// возвращается клиенту. URL, не прошедший проверку (с машиночитаемой причиной
+// в Reason), а также неверно заданные срок жизни или лимит переходов отмечаются как невалидные,
+// URL на запрещённый политикой домен — как запрещённый с причиной в Reason,
+// уже сокращённый (в том числе повтор внутри пакета с тем же каноническим видом URL) —
+// как существующий со ссылкой
+// на сохранённую запись. Записи с занятым ID сохраняются повторно со следующей
+// попыткой генератора; каждая попытка — одно обращение к хранилищу. Если за
+// maxIDAttempts попыток сохранить пакет не удалось, возвращает ErrIDAttemptsExhausted.
 func (s ShortenerService) InsertURLs(ctx context.Context, urls []model.ShortenerURLMapping) ([]model.ShortenerURLResponse, error) {
-	var items []model.ShortenerURLMapping
-	for _, v := range urls {
-		if isEmpty(v.CorrelationID) || isEmpty(v.OriginalURL) {
+	responses := make([]model.ShortenerURLResponse, len(urls))
+	links := make([]model.ShortenURL, len(urls))
+	now := time.Now()
+
+	// Индексы элементов, которые нужно сохранить, и повторы URL внутри пакета
+	var pending []int
+	first := make(map[string]int, len(urls))
+	duplicates := make(map[int]int)
+
+	for i, v := range urls {
+		responses[i].CorrelationID = v.CorrelationID
+
+		link, err := s.newLink(v.OriginalURL, v.LinkOptions, now)
+		if err != nil {
+			responses[i].Status = model.BatchStatusInvalid
+			responses[i].Error = err.Error()
+
+			var urlErr *constants.URLError
+			var policyErr *constants.PolicyError
+			switch {
+			case errors.As(err, &urlErr):
+				responses[i].Reason = urlErr.Reason
+			case errors.As(err, &policyErr):
+				responses[i].Status = model.BatchStatusForbidden
+				responses[i].Reason = policyErr.Reason
+			}
 			continue
 		}
+		links[i] = link
 
-		items = append(items, v)
-	}
+		if j, ok := first[link.OriginalURL]; ok {
+			duplicates[i] = j
+			continue
+		}
 
-	err := s.repository.InsertURLs(ctx, items)
-	if err != nil {
-		return nil, err
+		first[link.OriginalURL] = i
+		pending = append(pending, i)
 	}
 
-	var responseURLs []model.ShortenerURLResponse
-	for _, v := range items {
-		responseURLs = append(responseURLs, model.ShortenerURLResponse{
-			CorrelationID: v.CorrelationID,
-			ShortURL:      s.generateResponseURL(v.CorrelationID),
-		})
+	for attempt := 0; len(pending) > 0; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if attempt == maxIDAttempts {
+			return nil, fmt.Errorf("%w: %d attempts", constants.ErrIDAttemptsExhausted, maxIDAttempts)
+		}
+
+		batch := make([]model.BatchURL, len(pending))
+		for k, i := range pending {
+			id, err := s.generator.Generate(links[i].OriginalURL, attempt)
+			if err != nil {
+				return nil, err
+			}
+
+			batch[k] = model.BatchURL{
+				ID:           id,
+				OriginalURL:  links[i].OriginalURL,
+				SubmittedURL: links[i].SubmittedURL,
+				ExpiresAt:    links[i].ExpiresAt,
+				ClicksLeft:   links[i].ClicksLeft,
+				PasswordHash: links[i].PasswordHash,
+			}
+		}
+
+		results, err := s.repository.InsertURLs(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+
+		var retry []int
+		for k, i := range pending {
+			result := results[k]
+
+			switch {
+			case result.Err == nil:
+				responses[i].Status = model.BatchStatusCreated
+			case errors.Is(result.Err, constants.ErrUniqueIndex):
+				responses[i].Status = model.BatchStatusExists
+			case errors.Is(result.Err, constants.ErrIDConflict):
+				logger.Log.Debug("Short id collision in batch", zap.String("id", result.ID), zap.Int("attempt", attempt))
+				retry = append(retry, i)
+				continue
+			default:
+				return nil, result.Err
+			}
+
+			responses[i].ShortURL = s.generateResponseURL(result.ID)
+		}
+
+		pending = retry
 	}
 
-	return responseURLs, nil
-}
+	for i, j := range duplicates {
+		responses[i].Status = model.BatchStatusExists
+		responses[i].ShortURL = responses[j].ShortURL
+	}
 
-func isEmpty(t string) bool {
-	return strings.TrimSpace(t) == ""
+	return responses, nil
 }
 
 // GetURLSByUserID возвращает список сокращённых ссылок, созданных конкретным пользователем.
+// Для ссылок с лимитом переходов возвращается оставшееся число переходов.
 func (s ShortenerService) GetURLSByUserID(ctx context.Context, userID string) ([]model.ShortenerURLSForUserResponse, error) {
 	items, err := s.repository.GetURLSByUserID(ctx, userID)
 	if err != nil {
@@ -165,16 +565,82 @@ func (s ShortenerService) GetURLSByUserID(ctx context.Context, userID string) ([
 	}
 
 	var responseURLs []model.ShortenerURLSForUserResponse
-	for k, v := range items {
+	for _, v := range items {
 		responseURLs = append(responseURLs, model.ShortenerURLSForUserResponse{
-			OriginalURL: v,
-			ShortURL:    s.generateResponseURL(k),
+			OriginalURL:  v.OriginalURL,
+			SubmittedURL: v.SubmittedURL,
+			ShortURL:     s.generateResponseURL(v.ShortURL),
+			ClicksLeft:   v.ClicksLeft,
 		})
 	}
 
 	return responseURLs, err
 }
 
+// UpdateURL меняет оригинальный URL ссылки id по запросу её владельца userID
+// и возвращает ссылку с новым URL в каноническом виде. Как и при создании ссылки, переданный URL
+// сохраняется вместе с каноническим, если отличается от него. Прежний URL сохраняется в истории ссылки.
+//
+// Неверный URL проверяется как при создании ссылки (см. GenerateURL), остальные ошибки —
+// как у ShortenerRepository.UpdateURL.
+func (s ShortenerService) UpdateURL(ctx context.Context, id string, userID string, url string) (model.ShortenerURLSForUserResponse, error) {
+	url, err := s.validator.validate(url)
+	if err != nil {
+		return model.ShortenerURLSForUserResponse{}, err
+	}
+
+	if err = s.checkPolicy(url); err != nil {
+		return model.ShortenerURLSForUserResponse{}, err
+	}
+
+	canonicalURL, submittedURL := s.canonical.URL(url), ""
+	if canonicalURL != url {
+		submittedURL = url
+	}
+
+	if err := s.repository.UpdateURL(ctx, id, userID, canonicalURL, submittedURL); err != nil {
+		return model.ShortenerURLSForUserResponse{}, err
+	}
+
+	return model.ShortenerURLSForUserResponse{
+		ShortURL:     s.generateResponseURL(id),
+		OriginalURL:  canonicalURL,
+		SubmittedURL: submittedURL,
+	}, nil
+}
+
+// GetURLHistory возвращает прежние оригинальные URL ссылки id её владельцу userID,
+// от последнего изменения к первому.
+func (s ShortenerService) GetURLHistory(ctx context.Context, id string, userID string) ([]model.URLEdit, error) {
+	history, err := s.repository.GetURLHistory(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Reverse(history)
+	return history, nil
+}
+
+// RestoreURL возвращает ссылке id оригинальный URL из записи истории version.
+// Текущий URL при этом сам сохраняется в истории, так что восстановление тоже можно отменить.
+//
+// Если такой записи нет, возвращает ErrVersionNotFound, остальные ошибки — как у UpdateURL.
+func (s ShortenerService) RestoreURL(ctx context.Context, id string, userID string, version int) (model.ShortenerURLSForUserResponse, error) {
+	history, err := s.repository.GetURLHistory(ctx, id, userID)
+	if err != nil {
+		return model.ShortenerURLSForUserResponse{}, err
+	}
+
+	i := slices.IndexFunc(history, func(e model.URLEdit) bool {
+		return e.Version == version
+	})
+	if i < 0 {
+		return model.ShortenerURLSForUserResponse{}, constants.ErrVersionNotFound
+	}
+
+	return s.UpdateURL(ctx, id, userID, history[i].OriginalURL)
+}
+
 // DeleteUserURLS удаляет (помечает как удалённые) список ссылок, привязанных к пользователю.
 func (s ShortenerService) DeleteUserURLS(ctx context.Context, items []model.URLToDelete) error {
 	if len(items) == 0 {
@@ -184,6 +650,37 @@ func (s ShortenerService) DeleteUserURLS(ctx context.Context, items []model.URLT
 	return s.repository.DeleteUserURLS(ctx, items)
 }
 
+// GetDeletedURLs возвращает корзину пользователя: удалённые ссылки, которые ещё можно
+// восстановить, то есть удалённые не раньше, чем config.RestoreWindow назад.
+func (s ShortenerService) GetDeletedURLs(ctx context.Context, userID string) ([]model.DeletedURLResponse, error) {
+	items, err := s.repository.GetDeletedURLs(ctx, userID, time.Now().Add(-s.config.RestoreWindow.Duration))
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []model.DeletedURLResponse
+	for _, v := range items {
+		if v.DeletedAt == nil {
+			continue
+		}
+
+		deleted = append(deleted, model.DeletedURLResponse{
+			ShortURL:     s.generateResponseURL(v.ShortURL),
+			OriginalURL:  v.OriginalURL,
+			DeletedAt:    *v.DeletedAt,
+			RestoreUntil: v.DeletedAt.Add(s.config.RestoreWindow.Duration),
+		})
+	}
+
+	return deleted, nil
+}
+
+// RestoreDeletedURL восстанавливает удалённую пользователем ссылку, если с момента
+// удаления прошло не больше config.RestoreWindow. Ошибки — как у ShortenerRepository.UndeleteURL.
+func (s ShortenerService) RestoreDeletedURL(ctx context.Context, id string, userID string) error {
+	return s.repository.UndeleteURL(ctx, id, userID, time.Now().Add(-s.config.RestoreWindow.Duration))
+}
+
 // ScheduleURLDeletion планирует отложенное удаление ссылок через канал.
 func (s ShortenerService) ScheduleURLDeletion(ctx context.Context, items []model.URLToDelete) {
 	go func() {
@@ -233,6 +730,149 @@ func (s ShortenerService) Run(ctx context.Context, wg *sync.WaitGroup) {
 	}()
 }
 
+// ExpireURLs помечает удалёнными ссылки, срок жизни которых истёк, пакетами
+// по config.PurgeBatchSize и возвращает их число. Дальше такие ссылки
+// окончательно удаляются вместе с остальными удалёнными (см. PurgeDeletedURLs).
+func (s ShortenerService) ExpireURLs(ctx context.Context) (int, error) {
+	limit := max(s.config.PurgeBatchSize, 1)
+	now := time.Now()
+
+	total := 0
+	for {
+		expired, err := s.repository.ExpireURLs(ctx, now, limit)
+		total += expired
+		if err != nil {
+			return total, err
+		}
+
+		if expired < limit {
+			return total, nil
+		}
+	}
+}
+
+// RunExpirySweep запускает фоновую пометку истёкших ссылок с периодом config.ExpirySweepInterval.
+func (s ShortenerService) RunExpirySweep(ctx context.Context, wg *sync.WaitGroup) {
+	if s.config.ExpirySweepInterval.Duration <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.config.ExpirySweepInterval.Duration)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.sweepExpired(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (s ShortenerService) sweepExpired(ctx context.Context) {
+	expired, err := s.ExpireURLs(ctx)
+
+	expiryMetrics.Add("runs", 1)
+	expiryMetrics.Add("expired", int64(expired))
+
+	if err != nil {
+		expiryMetrics.Add("errors", 1)
+		logger.Log.Error("Expire urls error", zap.Int("expired", expired), zap.Error(err))
+		return
+	}
+
+	if expired > 0 {
+		logger.Log.Info("Expired urls swept", zap.Int("expired", expired))
+	}
+}
+
+// PurgeDeletedURLs окончательно удаляет ссылки, помеченные удалёнными раньше,
+// чем config.PurgeRetention назад, пакетами по config.PurgeBatchSize.
+// Пакеты запрашиваются, пока хранилище возвращает полный пакет.
+// Ссылки, которые ещё можно восстановить (см. config.RestoreWindow), не удаляются.
+//
+// Возвращает число удалённых ссылок. Нулевой срок хранения отключает очистку.
+func (s ShortenerService) PurgeDeletedURLs(ctx context.Context) (int, error) {
+	if s.config.PurgeRetention.Duration <= 0 {
+		return 0, nil
+	}
+
+	limit := max(s.config.PurgeBatchSize, 1)
+	deletedBefore := time.Now().Add(-max(s.config.PurgeRetention.Duration, s.config.RestoreWindow.Duration))
+
+	total := 0
+	for {
+		purged, err := s.repository.PurgeDeletedURLs(ctx, deletedBefore, limit, s.config.PurgeReuseIDs)
+		total += purged
+		if err != nil {
+			return total, err
+		}
+
+		if purged < limit {
+			return total, nil
+		}
+	}
+}
+
+// RunPurge запускает фоновую очистку удалённых ссылок с периодом config.PurgeInterval.
+// Если срок хранения не задан, очистка не запускается.
+func (s ShortenerService) RunPurge(ctx context.Context, wg *sync.WaitGroup) {
+	if s.config.PurgeRetention.Duration <= 0 || s.config.PurgeInterval.Duration <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.config.PurgeInterval.Duration)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.purge(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (s ShortenerService) purge(ctx context.Context) {
+	start := time.Now()
+	purged, err := s.PurgeDeletedURLs(ctx)
+
+	purgeMetrics.Add("runs", 1)
+	purgeMetrics.Add("purged", int64(purged))
+
+	lastPurged := new(expvar.Int)
+	lastPurged.Set(int64(purged))
+	purgeMetrics.Set("last_purged", lastPurged)
+
+	lastRun := new(expvar.String)
+	lastRun.Set(start.UTC().Format(time.RFC3339))
+	purgeMetrics.Set("last_run", lastRun)
+
+	if err != nil {
+		purgeMetrics.Add("errors", 1)
+		logger.Log.Error("Purge deleted urls error", zap.Int("purged", purged), zap.Error(err))
+		return
+	}
+
+	if purged > 0 {
+		logger.Log.Info("Deleted urls purged",
+			zap.Int("purged", purged),
+			zap.Duration("duration", time.Since(start)))
+	}
+}
+
 // Close - Закрывает канал
 func (s ShortenerService) Close() {
 	close(s.deleteChan)
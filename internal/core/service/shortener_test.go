@@ -4,61 +4,430 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/bubaew95/yandex-go-learn/config"
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/constants"
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/repository/memory"
+	"github.com/bubaew95/yandex-go-learn/internal/core/idgen"
 	"github.com/bubaew95/yandex-go-learn/internal/core/model"
+	"github.com/bubaew95/yandex-go-learn/pkg/crypto"
 	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// link сопоставляет аргумент SetURL с коротким ID и оригинальным URL;
+// пустой id означает любой ID.
+func link(id, url string) any {
+	return mock.MatchedBy(func(l model.ShortenURL) bool {
+		return (id == "" || l.ShortURL == id) && l.OriginalURL == url
+	})
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
 func TestGenerateURL(t *testing.T) {
 	repo := NewMockShortenerRepository(t)
-	service := NewShortenerService(repo, config.Config{
+	service := NewShortenerService(repo, idgen.NewRandom(idgen.Base62, 8, ""), config.Config{
 		BaseURL: "http://short.url",
 	})
 
-	repo.On("GetURLByID", mock.Anything, mock.Anything).Return("", errors.New("not found")).Once()
-	repo.On("SetURL", mock.Anything, mock.Anything, "https://www.yandex.ru").Return(nil).Once()
+	repo.On("SetURL", mock.Anything, link("", "https://www.yandex.ru")).Return(nil).Once()
 
-	url, err := service.GenerateURL(context.Background(), "https://www.yandex.ru", 10)
+	url, err := service.GenerateURL(context.Background(), "https://www.yandex.ru", model.LinkOptions{})
 	require.NoError(t, err)
 
 	assert.Contains(t, url, "http://short.url/")
 	repo.AssertExpectations(t)
 }
 
-func TestRandStringBytes(t *testing.T) {
+func TestGenerateURL_TooLong(t *testing.T) {
+	repo := NewMockShortenerRepository(t)
+	service := NewShortenerService(repo, idgen.NewRandom(idgen.Base62, 8, ""), config.Config{
+		BaseURL:      "http://short.url",
+		MaxURLLength: 20,
+	})
+
+	_, err := service.GenerateURL(context.Background(), "https://www.yandex.ru/very/long/path", model.LinkOptions{})
+	require.ErrorIs(t, err, constants.ErrURLTooLong)
+
+	// В пакете слишком длинный URL отмечается как невалидный, остальные сохраняются
+	repo.On("InsertURLs", mock.Anything, mock.MatchedBy(func(urls []model.BatchURL) bool {
+		return len(urls) == 1 && urls[0].OriginalURL == "https://ya.ru"
+	})).Return([]model.BatchURLResult{{ID: "abc"}}, nil).Once()
+
+	items, err := service.InsertURLs(context.Background(), []model.ShortenerURLMapping{
+		{CorrelationID: "1", OriginalURL: "https://ya.ru"},
+		{CorrelationID: "2", OriginalURL: "https://www.yandex.ru/very/long/path"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []model.ShortenerURLResponse{
+		{CorrelationID: "1", ShortURL: "http://short.url/abc", Status: model.BatchStatusCreated},
+		{CorrelationID: "2", Status: model.BatchStatusInvalid, Error: constants.ErrURLTooLong.Error(), Reason: constants.URLReasonTooLong},
+	}, items)
+
+	repo.AssertNotCalled(t, "SetURL", mock.Anything, mock.Anything)
+}
+
+func TestGenerateURL_IDConflict(t *testing.T) {
+	repo := NewMockShortenerRepository(t)
+	generator := idgen.NewHash(idgen.Base62, 8, "", "secret")
+	service := NewShortenerService(repo, generator, config.Config{
+		BaseURL: "http://short.url",
+	})
+
+	const url = "https://www.yandex.ru"
+	taken, err := generator.Generate(url, 0)
+	require.NoError(t, err)
+	next, err := generator.Generate(url, 1)
+	require.NoError(t, err)
+
+	// Первый ID уже занят другой ссылкой: генератор вызывается со следующей попыткой без чтения хранилища
+	repo.On("SetURL", mock.Anything, link(taken, url)).Return(constants.ErrIDConflict).Once()
+	repo.On("SetURL", mock.Anything, link(next, url)).Return(nil).Once()
+
+	shortURL, err := service.GenerateURL(context.Background(), url, model.LinkOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "http://short.url/"+next, shortURL)
+
+	repo.AssertNotCalled(t, "GetURLByID", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGenerateURL_IDAttemptsExhausted(t *testing.T) {
 	repo := NewMockShortenerRepository(t)
-	service := NewShortenerService(repo, config.Config{})
+	service := NewShortenerService(repo, idgen.NewRandom(idgen.Base62, 8, ""), config.Config{
+		BaseURL: "http://short.url",
+	})
+
+	// Хранилище отклоняет любой ID: попытки ограничены, а не продолжаются до отмены контекста
+	repo.On("SetURL", mock.Anything, mock.Anything).Return(constants.ErrIDConflict).Times(maxIDAttempts)
+
+	_, err := service.GenerateURL(context.Background(), "https://www.yandex.ru", model.LinkOptions{})
+	require.ErrorIs(t, err, constants.ErrIDAttemptsExhausted)
+
+	repo.On("InsertURLs", mock.Anything, mock.Anything).Return(func(_ context.Context, urls []model.BatchURL) ([]model.BatchURLResult, error) {
+		return []model.BatchURLResult{{ID: urls[0].ID, Err: constants.ErrIDConflict}}, nil
+	}).Times(maxIDAttempts)
 
-	randomID := service.RandStringBytes(8)
+	_, err = service.InsertURLs(context.Background(), []model.ShortenerURLMapping{{CorrelationID: "1", OriginalURL: "https://ya.ru"}})
+	require.ErrorIs(t, err, constants.ErrIDAttemptsExhausted)
+}
+
+func TestGenerateURL_URLConflict(t *testing.T) {
+	repo := NewMockShortenerRepository(t)
+	service := NewShortenerService(repo, idgen.NewRandom(idgen.Base62, 8, ""), config.Config{
+		BaseURL: "http://short.url",
+	})
+
+	repo.On("SetURL", mock.Anything, link("", "https://www.yandex.ru")).Return(constants.ErrUniqueIndex).Once()
+
+	_, err := service.GenerateURL(context.Background(), "https://www.yandex.ru", model.LinkOptions{})
+	require.ErrorIs(t, err, constants.ErrUniqueIndex)
+}
+
+func TestGenerateURL_Canonical(t *testing.T) {
+	repo := memory.NewShortenerRepository()
+	service := NewShortenerService(repo, idgen.NewRandom(idgen.Base62, 8, ""), config.Config{
+		BaseURL:             "http://short.url",
+		URLCanonicalization: config.URLCanonicalizationBasic,
+		URLStripTracking:    true,
+	})
+	ctx := context.WithValue(context.Background(), crypto.KeyUserID, "user-1")
+
+	shortURL, err := service.GenerateURL(ctx, "http://Example.com:80/a/?utm_source=mail", model.LinkOptions{})
+	require.NoError(t, err)
+
+	// Тот же адрес в другом написании считается уже сокращённым
+	_, err = service.GenerateURL(ctx, "http://example.com/a", model.LinkOptions{})
+	require.ErrorIs(t, err, constants.ErrUniqueIndex)
+
+	existing, ok := service.GetURLByOriginalURL(ctx, "HTTP://EXAMPLE.COM/a/")
+	require.True(t, ok)
+	assert.Equal(t, shortURL, existing)
+
+	// Канонический вид используется только для поиска повторов, переход идёт на переданный URL
+	id := strings.TrimPrefix(shortURL, "http://short.url/")
+	url, err := service.GetURLByID(ctx, id, "")
+	require.NoError(t, err)
+	assert.Equal(t, "http://Example.com:80/a/?utm_source=mail", url)
+
+	urls, err := service.GetURLSByUserID(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, []model.ShortenerURLSForUserResponse{{
+		ShortURL:     shortURL,
+		OriginalURL:  "http://example.com/a",
+		SubmittedURL: "http://Example.com:80/a/?utm_source=mail",
+	}}, urls)
+
+	// В пакете повторы сравниваются в каноническом виде
+	items, err := service.InsertURLs(ctx, []model.ShortenerURLMapping{
+		{CorrelationID: "1", OriginalURL: "https://b.com/x/"},
+		{CorrelationID: "2", OriginalURL: "https://B.com:443/x"},
+		{CorrelationID: "3", OriginalURL: "http://example.com/a/../a"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, model.BatchStatusCreated, items[0].Status)
+	assert.Equal(t, model.BatchStatusExists, items[1].Status)
+	assert.Equal(t, items[0].ShortURL, items[1].ShortURL)
+	assert.Equal(t, model.BatchStatusExists, items[2].Status)
+	assert.Equal(t, shortURL, items[2].ShortURL)
+
+	// Переданный вид сохраняется и при изменении ссылки
+	item, err := service.UpdateURL(ctx, id, "user-1", " https://c.com/d/ ")
+	require.NoError(t, err)
+	assert.Equal(t, "https://c.com/d", item.OriginalURL)
+	assert.Equal(t, "https://c.com/d/", item.SubmittedURL)
+
+	url, err = service.GetURLByID(ctx, id, "")
+	require.NoError(t, err)
+	assert.Equal(t, "https://c.com/d/", url)
+
+	history, err := service.GetURLHistory(ctx, id, "user-1")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, "http://Example.com:80/a/?utm_source=mail", history[0].OriginalURL)
+}
+
+// policyFunc — политика доменов для тестов.
+type policyFunc func(host string) error
+
+func (f policyFunc) Check(host string) error {
+	return f(host)
+}
+
+func TestShortenerService_Policy(t *testing.T) {
+	blocked := "evil.com"
+	domainPolicy := policyFunc(func(host string) error {
+		if strings.EqualFold(host, blocked) {
+			return &constants.PolicyError{Reason: constants.URLReasonBlockedDomain, Host: host, Rule: blocked}
+		}
+		return nil
+	})
 
-	assert.NotEmpty(t, randomID)
-	assert.Len(t, randomID, 8)
+	repo := memory.NewShortenerRepository()
+	service := NewShortenerService(repo, idgen.NewRandom(idgen.Base62, 8, ""), config.Config{
+		BaseURL:               "http://short.url",
+		PolicyDisableExisting: true,
+	})
+	ctx := context.WithValue(context.Background(), crypto.KeyUserID, "user-1")
+
+	// Ссылка создана до того, как домен попал в список запрещённых
+	shortURL, err := service.GenerateURL(ctx, "https://evil.com/old", model.LinkOptions{})
+	require.NoError(t, err)
+	id := strings.TrimPrefix(shortURL, "http://short.url/")
+
+	onceURL, err := service.GenerateURL(ctx, "https://evil.com/once", model.LinkOptions{MaxClicks: 1})
+	require.NoError(t, err)
+	onceID := strings.TrimPrefix(onceURL, "http://short.url/")
+
+	secretURL, err := service.GenerateURL(ctx, "https://evil.com/secret", model.LinkOptions{MaxClicks: 1, Password: "pw"})
+	require.NoError(t, err)
+	secretID := strings.TrimPrefix(secretURL, "http://short.url/")
+
+	clicksLeft := func(id string) int {
+		links, err := repo.GetURLSByUserID(ctx, "user-1")
+		require.NoError(t, err)
+
+		i := slices.IndexFunc(links, func(l model.ShortenURL) bool { return l.ShortURL == id })
+		require.GreaterOrEqual(t, i, 0)
+		require.NotNil(t, links[i].ClicksLeft)
+		return *links[i].ClicksLeft
+	}
+
+	service.SetPolicy(domainPolicy)
+
+	_, err = service.GenerateURL(ctx, "https://www.example.com/", model.LinkOptions{})
+	require.NoError(t, err)
+
+	_, err = service.GenerateURL(ctx, "https://EVIL.com:8443/new", model.LinkOptions{})
+	require.ErrorIs(t, err, constants.ErrForbiddenURL)
+
+	var policyErr *constants.PolicyError
+	require.True(t, errors.As(err, &policyErr))
+	assert.Equal(t, constants.URLReasonBlockedDomain, policyErr.Reason)
+
+	items, err := service.InsertURLs(ctx, []model.ShortenerURLMapping{
+		{CorrelationID: "1", OriginalURL: "https://evil.com/batch"},
+		{CorrelationID: "2", OriginalURL: "https://good.com/batch"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, model.BatchStatusForbidden, items[0].Status)
+	assert.Equal(t, constants.URLReasonBlockedDomain, items[0].Reason)
+	assert.Empty(t, items[0].ShortURL)
+	assert.Equal(t, model.BatchStatusCreated, items[1].Status)
+
+	_, err = service.GetURLByID(ctx, id, "")
+	require.ErrorIs(t, err, constants.ErrForbiddenURL)
+
+	// Запрещённая ссылка не тратит переход
+	_, err = service.GetURLByID(ctx, onceID, "")
+	require.ErrorIs(t, err, constants.ErrForbiddenURL)
+	assert.Equal(t, 1, clicksLeft(onceID))
+
+	_, err = service.GetURLByID(ctx, secretID, "pw")
+	require.ErrorIs(t, err, constants.ErrForbiddenURL)
+	assert.Equal(t, 1, clicksLeft(secretID))
+
+	// Без PolicyDisableExisting старые ссылки продолжают работать
+	service.config.PolicyDisableExisting = false
+	url, err := service.GetURLByID(ctx, id, "")
+	require.NoError(t, err)
+	assert.Equal(t, "https://evil.com/old", url)
+
+	url, err = service.GetURLByID(ctx, onceID, "")
+	require.NoError(t, err)
+	assert.Equal(t, "https://evil.com/once", url)
+	assert.Equal(t, 0, clicksLeft(onceID))
+
+	url, err = service.GetURLByID(ctx, secretID, "pw")
+	require.NoError(t, err)
+	assert.Equal(t, "https://evil.com/secret", url)
+}
+
+func TestGenerateURL_MaxClicks(t *testing.T) {
+	repo := NewMockShortenerRepository(t)
+	service := NewShortenerService(repo, idgen.NewRandom(idgen.Base62, 8, ""), config.Config{
+		BaseURL: "http://short.url",
+	})
+
+	repo.On("SetURL", mock.Anything, mock.MatchedBy(func(l model.ShortenURL) bool {
+		return l.ClicksLeft != nil && *l.ClicksLeft == 1
+	})).Return(nil).Once()
+
+	_, err := service.GenerateURL(context.Background(), "https://www.yandex.ru", model.LinkOptions{MaxClicks: 1})
+	require.NoError(t, err)
+
+	_, err = service.GenerateURL(context.Background(), "https://www.yandex.ru", model.LinkOptions{MaxClicks: -1})
+	require.ErrorIs(t, err, constants.ErrInvalidClicks)
+}
+
+func TestGenerateURL_Password(t *testing.T) {
+	repo := NewMockShortenerRepository(t)
+	service := NewShortenerService(repo, idgen.NewRandom(idgen.Base62, 8, ""), config.Config{
+		BaseURL: "http://short.url",
+	})
+
+	// В хранилище попадает только хеш пароля
+	repo.On("SetURL", mock.Anything, mock.MatchedBy(func(l model.ShortenURL) bool {
+		return l.PasswordHash != "qwerty" &&
+			bcrypt.CompareHashAndPassword([]byte(l.PasswordHash), []byte("qwerty")) == nil
+	})).Return(nil).Once()
+
+	_, err := service.GenerateURL(context.Background(), "https://www.yandex.ru", model.LinkOptions{Password: "qwerty"})
+	require.NoError(t, err)
+
+	_, err = service.GenerateURL(context.Background(), "https://www.yandex.ru", model.LinkOptions{Password: strings.Repeat("a", 73)})
+	require.ErrorIs(t, err, constants.ErrInvalidPassword)
+}
+
+func TestSetAlias(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		alias   string
+		repoErr error
+		wantErr error
+	}{
+		{name: "ok", alias: "promo-2026"},
+		{name: "underscore", alias: "Spring_Sale"},
+		{name: "too short", alias: "ab", wantErr: constants.ErrInvalidAlias},
+		{name: "too long", alias: strings.Repeat("a", 65), wantErr: constants.ErrInvalidAlias},
+		{name: "slash", alias: "promo/2026", wantErr: constants.ErrInvalidAlias},
+		{name: "non ascii", alias: "акция", wantErr: constants.ErrInvalidAlias},
+		{name: "reserved", alias: "ping", wantErr: constants.ErrReservedAlias},
+		{name: "reserved any case", alias: "API", wantErr: constants.ErrReservedAlias},
+		{name: "taken", alias: "promo-2026", repoErr: constants.ErrIDConflict, wantErr: constants.ErrIDConflict},
+		{name: "url exists", alias: "promo-2026", repoErr: constants.ErrUniqueIndex, wantErr: constants.ErrUniqueIndex},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockShortenerRepository(t)
+			service := NewShortenerService(repo, idgen.NewRandom(idgen.Base62, 8, ""), config.Config{
+				BaseURL: "http://short.url",
+			})
+
+			if tt.repoErr != nil || tt.wantErr == nil {
+				repo.On("SetURL", mock.Anything, link(tt.alias, "https://www.yandex.ru")).Return(tt.repoErr).Once()
+			}
+
+			url, err := service.SetAlias(context.Background(), "https://www.yandex.ru", tt.alias, model.LinkOptions{})
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, "http://short.url/"+tt.alias, url)
+		})
+	}
 }
 
 func TestGetURLByID(t *testing.T) {
 	repo := NewMockShortenerRepository(t)
-	service := NewShortenerService(repo, config.Config{})
+	service := NewShortenerService(repo, idgen.NewRandom(idgen.Base62, 8, ""), config.Config{})
 
 	link := "https://example.com"
 
-	repo.On("GetURLByID", mock.Anything, "SXhhC3").
+	repo.On("GetURLByID", mock.Anything, "SXhhC3", mock.Anything).
 		Return(link, nil)
 
-	url, err := service.GetURLByID(context.Background(), "SXhhC3")
+	url, err := service.GetURLByID(context.Background(), "SXhhC3", "")
 	require.NoError(t, err)
 	assert.Equal(t, link, url)
 }
 
+func TestGetURLByID_Password(t *testing.T) {
+	repo := memory.NewShortenerRepository()
+	service := NewShortenerService(repo, idgen.NewRandom(idgen.Base62, 8, ""), config.Config{
+		BaseURL:             "http://short.url",
+		PasswordMaxAttempts: 2,
+		PasswordLockout:     config.Duration{Duration: time.Hour},
+	})
+	ctx := context.Background()
+
+	_, err := service.SetAlias(ctx, "https://www.yandex.ru", "secret", model.LinkOptions{Password: "qwerty", MaxClicks: 2})
+	require.NoError(t, err)
+
+	_, err = service.GetURLByID(ctx, "secret", "")
+	require.ErrorIs(t, err, constants.ErrPasswordRequired)
+
+	url, err := service.GetURLByID(ctx, "secret", "qwerty")
+	require.NoError(t, err)
+	assert.Equal(t, "https://www.yandex.ru", url)
+
+	// Неверный пароль не списывает переход
+	_, err = service.GetURLByID(ctx, "secret", "wrong")
+	require.ErrorIs(t, err, constants.ErrWrongPassword)
+	_, err = service.GetURLByID(ctx, "secret", "wrong")
+	require.ErrorIs(t, err, constants.ErrWrongPassword)
+
+	// После лимита неудач не проверяется даже верный пароль
+	_, err = service.GetURLByID(ctx, "secret", "qwerty")
+	require.ErrorIs(t, err, constants.ErrTooManyAttempts)
+
+	service.attempts.reset("secret")
+	_, err = service.GetURLByID(ctx, "secret", "qwerty")
+	require.NoError(t, err)
+
+	_, err = service.GetURLByID(ctx, "secret", "qwerty")
+	require.ErrorIs(t, err, constants.ErrNoClicksLeft)
+}
+
 func TestGetURLByOriginalURL(t *testing.T) {
 	repo := NewMockShortenerRepository(t)
-	service := NewShortenerService(repo, config.Config{
+	service := NewShortenerService(repo, idgen.NewRandom(idgen.Base62, 8, ""), config.Config{
 		BaseURL: "http://short.url",
 	})
 
@@ -107,7 +476,7 @@ func TestGetURLByOriginalURL(t *testing.T) {
 
 func TestGenerateResponseUrl(t *testing.T) {
 	repo := NewMockShortenerRepository(t)
-	service := NewShortenerService(repo, config.Config{
+	service := NewShortenerService(repo, idgen.NewRandom(idgen.Base62, 8, ""), config.Config{
 		BaseURL: "http://short.url",
 	})
 
@@ -117,40 +486,92 @@ func TestGenerateResponseUrl(t *testing.T) {
 }
 
 func TestInsertURL(t *testing.T) {
+	generator := idgen.NewHash(idgen.Base62, 8, "", "secret")
+	id := func(url string, attempt int) string {
+		id, err := generator.Generate(url, attempt)
+		require.NoError(t, err)
+		return id
+	}
+
+	data := []model.ShortenerURLMapping{
+		{CorrelationID: "1", OriginalURL: "http://example.com"},
+		{CorrelationID: "2", OriginalURL: "http://site.com"},
+		{CorrelationID: "3", OriginalURL: " "},
+		{CorrelationID: "4", OriginalURL: "http://example.com"},
+	}
+
 	tests := []struct {
-		name     string
-		err      error
-		response []model.ShortenerURLResponse
+		name    string
+		calls   [][]model.BatchURLResult
+		err     error
+		want    []model.ShortenerURLResponse
+		wantIDs [][]string
 	}{
 		{
-			name: "Success",
-			err:  nil,
+			name: "Created",
+			calls: [][]model.BatchURLResult{
+				{{ID: id("http://example.com", 0)}, {ID: id("http://site.com", 0)}},
+			},
+			wantIDs: [][]string{{id("http://example.com", 0), id("http://site.com", 0)}},
+			want: []model.ShortenerURLResponse{
+				{CorrelationID: "1", ShortURL: "http://short.url/" + id("http://example.com", 0), Status: model.BatchStatusCreated},
+				{CorrelationID: "2", ShortURL: "http://short.url/" + id("http://site.com", 0), Status: model.BatchStatusCreated},
+				{CorrelationID: "3", Status: model.BatchStatusInvalid, Error: constants.ErrEmptyURL.Error(), Reason: constants.URLReasonEmpty},
+				{CorrelationID: "4", ShortURL: "http://short.url/" + id("http://example.com", 0), Status: model.BatchStatusExists},
+			},
 		},
 		{
-			name: "Error",
-			err:  errors.New("Mock error"),
+			name: "Existing URL and ID conflict",
+			calls: [][]model.BatchURLResult{
+				{
+					{ID: "abc", Err: constants.ErrUniqueIndex},
+					{ID: id("http://site.com", 0), Err: constants.ErrIDConflict},
+				},
+				{{ID: id("http://site.com", 1)}},
+			},
+			wantIDs: [][]string{
+				{id("http://example.com", 0), id("http://site.com", 0)},
+				{id("http://site.com", 1)},
+			},
+			want: []model.ShortenerURLResponse{
+				{CorrelationID: "1", ShortURL: "http://short.url/abc", Status: model.BatchStatusExists},
+				{CorrelationID: "2", ShortURL: "http://short.url/" + id("http://site.com", 1), Status: model.BatchStatusCreated},
+				{CorrelationID: "3", Status: model.BatchStatusInvalid, Error: constants.ErrEmptyURL.Error(), Reason: constants.URLReasonEmpty},
+				{CorrelationID: "4", ShortURL: "http://short.url/abc", Status: model.BatchStatusExists},
+			},
+		},
+		{
+			name:    "Error",
+			calls:   [][]model.BatchURLResult{nil},
+			wantIDs: [][]string{{id("http://example.com", 0), id("http://site.com", 0)}},
+			err:     errors.New("Mock error"),
 		},
-	}
-
-	repo := NewMockShortenerRepository(t)
-	service := NewShortenerService(repo, config.Config{})
-
-	data := []model.ShortenerURLMapping{
-		{CorrelationID: "test-id-1", OriginalURL: "http://example.com"},
-		{CorrelationID: "test-id-2", OriginalURL: "http://site.com"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			repo.On("InsertURLs", mock.Anything, data).Return(tt.err).Once()
+			repo := NewMockShortenerRepository(t)
+			service := NewShortenerService(repo, generator, config.Config{BaseURL: "http://short.url"})
+
+			for i, results := range tt.calls {
+				ids := tt.wantIDs[i]
+				repo.On("InsertURLs", mock.Anything, mock.MatchedBy(func(urls []model.BatchURL) bool {
+					got := make([]string, len(urls))
+					for k, v := range urls {
+						got[k] = v.ID
+					}
+					return slices.Equal(got, ids)
+				})).Return(results, tt.err).Once()
+			}
 
 			items, err := service.InsertURLs(context.Background(), data)
 			if tt.err != nil {
 				require.Error(t, err)
-			} else {
-				require.NoError(t, err)
-				assert.Len(t, items, len(data))
+				return
 			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, items)
 		})
 	}
 }
@@ -162,7 +583,7 @@ func TestShortenerService_GetURLSByUserID(t *testing.T) {
 		userID string
 	}
 	type repoReturn struct {
-		items map[string]string
+		items []model.ShortenURL
 		err   error
 	}
 	type want struct {
@@ -180,16 +601,16 @@ func TestShortenerService_GetURLSByUserID(t *testing.T) {
 			name: "success - returns list",
 			args: args{userID: "user123"},
 			repoReturn: repoReturn{
-				items: map[string]string{
-					"id1": "http://example.com",
-					"id2": "http://yandex.ru",
+				items: []model.ShortenURL{
+					{ShortURL: "id1", OriginalURL: "http://example.com"},
+					{ShortURL: "id2", OriginalURL: "http://yandex.ru", ClicksLeft: ptr(2)},
 				},
 				err: nil,
 			},
 			want: want{
 				result: []model.ShortenerURLSForUserResponse{
 					{ShortURL: "http://short.url/id1", OriginalURL: "http://example.com"},
-					{ShortURL: "http://short.url/id2", OriginalURL: "http://yandex.ru"},
+					{ShortURL: "http://short.url/id2", OriginalURL: "http://yandex.ru", ClicksLeft: ptr(2)},
 				},
 				err: false,
 			},
@@ -210,7 +631,7 @@ func TestShortenerService_GetURLSByUserID(t *testing.T) {
 			name: "empty result",
 			args: args{userID: "user456"},
 			repoReturn: repoReturn{
-				items: map[string]string{},
+				items: []model.ShortenURL{},
 				err:   nil,
 			},
 			want: want{
@@ -226,7 +647,7 @@ func TestShortenerService_GetURLSByUserID(t *testing.T) {
 			t.Parallel()
 
 			mockRepo := NewMockShortenerRepository(t)
-			svc := NewShortenerService(mockRepo, config.Config{
+			svc := NewShortenerService(mockRepo, idgen.NewRandom(idgen.Base62, 8, ""), config.Config{
 				BaseURL: "http://short.url",
 			})
 
@@ -249,6 +670,89 @@ func TestShortenerService_GetURLSByUserID(t *testing.T) {
 	}
 }
 
+func TestShortenerService_UpdateAndRestoreURL(t *testing.T) {
+	repo := memory.NewShortenerRepository()
+	service := NewShortenerService(repo, idgen.NewRandom(idgen.Base62, 8, ""), config.Config{
+		BaseURL:      "http://short.url",
+		MaxURLLength: 100,
+	})
+	ctx := context.WithValue(context.Background(), crypto.KeyUserID, "user-1")
+
+	_, err := service.SetAlias(ctx, "https://a.com", "promo", model.LinkOptions{})
+	require.NoError(t, err)
+
+	_, err = service.UpdateURL(ctx, "promo", "user-1", " ")
+	require.ErrorIs(t, err, constants.ErrEmptyURL)
+	_, err = service.UpdateURL(ctx, "promo", "user-1", "https://"+strings.Repeat("a", 100))
+	require.ErrorIs(t, err, constants.ErrURLTooLong)
+
+	item, err := service.UpdateURL(ctx, "promo", "user-1", "https://b.com")
+	require.NoError(t, err)
+	assert.Equal(t, model.ShortenerURLSForUserResponse{ShortURL: "http://short.url/promo", OriginalURL: "https://b.com"}, item)
+
+	_, err = service.UpdateURL(ctx, "promo", "user-1", "https://c.com")
+	require.NoError(t, err)
+
+	// История отдаётся от последнего изменения к первому
+	history, err := service.GetURLHistory(ctx, "promo", "user-1")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, "https://b.com", history[0].OriginalURL)
+	assert.Equal(t, "https://a.com", history[1].OriginalURL)
+
+	_, err = service.RestoreURL(ctx, "promo", "user-1", 3)
+	require.ErrorIs(t, err, constants.ErrVersionNotFound)
+
+	item, err = service.RestoreURL(ctx, "promo", "user-1", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "https://a.com", item.OriginalURL)
+
+	url, err := service.GetURLByID(ctx, "promo", "")
+	require.NoError(t, err)
+	assert.Equal(t, "https://a.com", url)
+
+	// Восстановление тоже попадает в историю
+	history, err = service.GetURLHistory(ctx, "promo", "user-1")
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, 3, history[0].Version)
+	assert.Equal(t, "https://c.com", history[0].OriginalURL)
+
+	_, err = service.RestoreURL(ctx, "promo", "user-2", 1)
+	require.ErrorIs(t, err, constants.ErrNotOwner)
+}
+
+func TestShortenerService_RestoreDeletedURL(t *testing.T) {
+	repo := memory.NewShortenerRepository()
+	service := NewShortenerService(repo, idgen.NewRandom(idgen.Base62, 8, ""), config.Config{
+		BaseURL:       "http://short.url",
+		RestoreWindow: config.Duration{Duration: time.Hour},
+	})
+	ctx := context.WithValue(context.Background(), crypto.KeyUserID, "user-1")
+
+	_, err := service.SetAlias(ctx, "https://a.com", "promo", model.LinkOptions{})
+	require.NoError(t, err)
+	require.NoError(t, service.DeleteUserURLS(ctx, []model.URLToDelete{{ShortLink: "promo", UserID: "user-1"}}))
+
+	trash, err := service.GetDeletedURLs(ctx, "user-1")
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+	assert.Equal(t, "http://short.url/promo", trash[0].ShortURL)
+	assert.Equal(t, "https://a.com", trash[0].OriginalURL)
+	assert.Equal(t, trash[0].DeletedAt.Add(time.Hour), trash[0].RestoreUntil)
+
+	require.ErrorIs(t, service.RestoreDeletedURL(ctx, "promo", "user-2"), constants.ErrNotOwner)
+	require.NoError(t, service.RestoreDeletedURL(ctx, "promo", "user-1"))
+
+	url, err := service.GetURLByID(ctx, "promo", "")
+	require.NoError(t, err)
+	assert.Equal(t, "https://a.com", url)
+
+	trash, err = service.GetDeletedURLs(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Empty(t, trash)
+}
+
 func TestShortenerService_ScheduleAndRunDeletion(t *testing.T) {
 	t.Parallel()
 
@@ -259,7 +763,7 @@ func TestShortenerService_ScheduleAndRunDeletion(t *testing.T) {
 	mockRepo := NewMockShortenerRepository(t)
 
 	deleteChan := make(chan model.URLToDelete, 10)
-	svc := NewShortenerService(mockRepo, config.Config{})
+	svc := NewShortenerService(mockRepo, idgen.NewRandom(idgen.Base62, 8, ""), config.Config{})
 	svcWithChan := svc
 	svcWithChan.deleteChan = deleteChan
 
@@ -285,3 +789,143 @@ func TestShortenerService_ScheduleAndRunDeletion(t *testing.T) {
 
 	mockRepo.AssertExpectations(t)
 }
+
+func TestShortenerService_PurgeDeletedURLs(t *testing.T) {
+	tests := []struct {
+		name      string
+		retention time.Duration
+		window    time.Duration
+		batches   []int
+		mockErr   error
+		want      int
+	}{
+		{name: "disabled", retention: 0, want: 0},
+		{name: "single batch", retention: time.Hour, batches: []int{1}, want: 1},
+		{name: "restore window longer than retention", retention: time.Hour, window: 2 * time.Hour, batches: []int{1}, want: 1},
+		{name: "several batches", retention: time.Hour, batches: []int{2, 2, 0}, want: 4},
+		{name: "error", retention: time.Hour, batches: []int{2, 1}, mockErr: errors.New("db error"), want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockShortenerRepository(t)
+			service := NewShortenerService(repo, idgen.NewRandom(idgen.Base62, 8, ""), config.Config{
+				PurgeRetention: config.Duration{Duration: tt.retention},
+				PurgeBatchSize: 2,
+				PurgeReuseIDs:  true,
+				RestoreWindow:  config.Duration{Duration: tt.window},
+			})
+
+			// Ссылки, которые ещё можно восстановить, не удаляются
+			keep := max(tt.retention, tt.window)
+			start := time.Now()
+			beforeRetention := mock.MatchedBy(func(before time.Time) bool {
+				return !before.Before(start.Add(-keep)) && !before.After(time.Now().Add(-keep))
+			})
+
+			for i, purged := range tt.batches {
+				var err error
+				if i == len(tt.batches)-1 {
+					err = tt.mockErr
+				}
+
+				repo.On("PurgeDeletedURLs", mock.Anything, beforeRetention, 2, true).Return(purged, err).Once()
+			}
+
+			purged, err := service.PurgeDeletedURLs(context.Background())
+			if tt.mockErr != nil {
+				require.ErrorIs(t, err, tt.mockErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.want, purged)
+		})
+	}
+}
+
+func TestShortenerService_ExpiresAt(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		v := now.Add(d)
+		return &v
+	}
+
+	tests := []struct {
+		name       string
+		defaultTTL time.Duration
+		maxTTL     time.Duration
+		opts       model.LinkOptions
+		want       *time.Time
+		wantErr    error
+	}{
+		{name: "no expiry"},
+		{name: "expires in", opts: model.LinkOptions{ExpiresIn: 60}, want: at(time.Minute)},
+		{name: "expires at", opts: model.LinkOptions{ExpiresAt: at(time.Hour)}, want: at(time.Hour)},
+		{name: "default ttl", defaultTTL: time.Hour, maxTTL: 24 * time.Hour, want: at(time.Hour)},
+		{name: "max ttl as default", maxTTL: 24 * time.Hour, want: at(24 * time.Hour)},
+		{name: "both set", opts: model.LinkOptions{ExpiresIn: 60, ExpiresAt: at(time.Hour)}, wantErr: constants.ErrInvalidExpiry},
+		{name: "negative", opts: model.LinkOptions{ExpiresIn: -1}, wantErr: constants.ErrInvalidExpiry},
+		{name: "in the past", opts: model.LinkOptions{ExpiresAt: at(-time.Second)}, wantErr: constants.ErrInvalidExpiry},
+		{name: "above max", maxTTL: time.Hour, opts: model.LinkOptions{ExpiresIn: 7200}, wantErr: constants.ErrInvalidExpiry},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewShortenerService(nil, nil, config.Config{
+				DefaultLinkTTL: config.Duration{Duration: tt.defaultTTL},
+				MaxLinkTTL:     config.Duration{Duration: tt.maxTTL},
+			})
+
+			got, err := service.expiresAt(tt.opts, now)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestShortenerService_ExpireURLs(t *testing.T) {
+	repo := NewMockShortenerRepository(t)
+	service := NewShortenerService(repo, idgen.NewRandom(idgen.Base62, 8, ""), config.Config{
+		PurgeBatchSize: 2,
+	})
+
+	start := time.Now()
+	beforeNow := mock.MatchedBy(func(before time.Time) bool {
+		return !before.Before(start) && !before.After(time.Now())
+	})
+
+	repo.On("ExpireURLs", mock.Anything, beforeNow, 2).Return(2, nil).Once()
+	repo.On("ExpireURLs", mock.Anything, beforeNow, 2).Return(1, nil).Once()
+
+	expired, err := service.ExpireURLs(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, expired)
+}
+
+// BenchmarkShortenerService_GenerateURL создаёт ссылки из параллельных горутин.
+// Без общей блокировки время на операцию не должно расти с числом горутин (-cpu 1,2,4,8).
+func BenchmarkShortenerService_GenerateURL(b *testing.B) {
+	service := NewShortenerService(memory.NewShortenerRepository(), idgen.NewRandom(idgen.Base62, 8, ""), config.Config{
+		BaseURL: "http://short.url",
+	})
+
+	var seq atomic.Int64
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			url := fmt.Sprintf("https://site.com/%d", seq.Add(1))
+			if _, err := service.GenerateURL(context.Background(), url, model.LinkOptions{}); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/constants"
+)
+
+// urlValidator проверяет сокращаемые URL: длину, управляющие символы, схему и хост.
+type urlValidator struct {
+	maxLength int
+	schemes   []string
+}
+
+func newURLValidator(maxLength int, schemes []string) urlValidator {
+	if len(schemes) == 0 {
+		schemes = []string{"http", "https"}
+	}
+
+	lower := make([]string, len(schemes))
+	for i, scheme := range schemes {
+		lower[i] = strings.ToLower(scheme)
+	}
+
+	return urlValidator{maxLength: maxLength, schemes: lower}
+}
+
+// validate проверяет raw и возвращает URL без пробельных символов по краям,
+// с хостом IDN в punycode.
+//
+// Возвращает *constants.URLError с причиной отказа; пустой URL также
+// соответствует ErrEmptyURL, слишком длинный — ErrURLTooLong.
+func (v urlValidator) validate(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", &constants.URLError{Reason: constants.URLReasonEmpty, Err: constants.ErrEmptyURL}
+	}
+
+	if v.maxLength > 0 && len(raw) > v.maxLength {
+		return "", &constants.URLError{Reason: constants.URLReasonTooLong, Err: constants.ErrURLTooLong}
+	}
+
+	if i := strings.IndexFunc(raw, unicode.IsControl); i >= 0 {
+		return "", &constants.URLError{
+			Reason: constants.URLReasonControlChars,
+			Err:    fmt.Errorf("url contains control character at position %d", i),
+		}
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", &constants.URLError{Reason: constants.URLReasonMalformed, Err: err}
+	}
+
+	if u.Scheme == "" {
+		return "", &constants.URLError{Reason: constants.URLReasonMissingScheme, Err: errors.New("url has no scheme")}
+	}
+
+	if !slices.Contains(v.schemes, strings.ToLower(u.Scheme)) {
+		return "", &constants.URLError{
+			Reason: constants.URLReasonSchemeNotAllowed,
+			Err:    fmt.Errorf("url scheme %q is not allowed", u.Scheme),
+		}
+	}
+
+	host := u.Hostname()
+	if u.Opaque != "" || host == "" {
+		return "", &constants.URLError{Reason: constants.URLReasonMissingHost, Err: errors.New("url has no host")}
+	}
+
+	ascii, err := asciiHost(host)
+	if err != nil {
+		return "", &constants.URLError{Reason: constants.URLReasonInvalidHost, Err: fmt.Errorf("url host %q: %w", host, err)}
+	}
+
+	if ascii == host {
+		return raw, nil
+	}
+
+	if port := u.Port(); port != "" {
+		ascii = net.JoinHostPort(ascii, port)
+	}
+	u.Host = ascii
+
+	return u.String(), nil
+}
+
+// asciiHost переводит интернационализированное доменное имя в punycode.
+// ASCII-хосты и IP-адреса возвращаются без изменений.
+func asciiHost(host string) (string, error) {
+	isASCII := strings.IndexFunc(host, func(r rune) bool { return r > unicode.MaxASCII }) < 0
+	if isASCII || net.ParseIP(host) != nil {
+		return host, nil
+	}
+
+	return idna.Lookup.ToASCII(host)
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bubaew95/yandex-go-learn/internal/adapters/constants"
+)
+
+func TestURLValidator_Validate(t *testing.T) {
+	t.Parallel()
+
+	v := newURLValidator(64, nil)
+
+	tests := []struct {
+		name   string
+		url    string
+		want   string
+		reason string
+	}{
+		{name: "http", url: "http://example.com/a?b=1", want: "http://example.com/a?b=1"},
+		{name: "https upper case scheme", url: "HTTPS://example.com", want: "HTTPS://example.com"},
+		{name: "surrounding spaces", url: "  https://example.com/\n", want: "https://example.com/"},
+		{name: "idn", url: "https://пример.рф/путь", want: "https://xn--e1afmkfd.xn--p1ai/%D0%BF%D1%83%D1%82%D1%8C"},
+		{name: "idn with port", url: "http://Bücher.de:8080/", want: "http://xn--bcher-kva.de:8080/"},
+		{name: "ip", url: "http://127.0.0.1:8080/", want: "http://127.0.0.1:8080/"},
+		{name: "empty", url: " ", reason: constants.URLReasonEmpty},
+		{name: "too long", url: "https://example.com/" + strings.Repeat("a", 64), reason: constants.URLReasonTooLong},
+		{name: "control character", url: "https://example.com/a\x00b", reason: constants.URLReasonControlChars},
+		{name: "malformed", url: "http://[::1", reason: constants.URLReasonMalformed},
+		{name: "plain text", url: "hello world", reason: constants.URLReasonMissingScheme},
+		{name: "relative", url: "/a/b", reason: constants.URLReasonMissingScheme},
+		{name: "javascript", url: "javascript:alert(1)", reason: constants.URLReasonSchemeNotAllowed},
+		{name: "ftp not allowed", url: "ftp://example.com/f", reason: constants.URLReasonSchemeNotAllowed},
+		{name: "no host", url: "http:///path", reason: constants.URLReasonMissingHost},
+		{name: "opaque", url: "http:example.com", reason: constants.URLReasonMissingHost},
+		{name: "invalid idn", url: "http://xn--a.рф/", reason: constants.URLReasonInvalidHost},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := v.validate(tt.url)
+			if tt.reason == "" {
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+				return
+			}
+
+			require.ErrorIs(t, err, constants.ErrInvalidURL)
+
+			var urlErr *constants.URLError
+			require.True(t, errors.As(err, &urlErr))
+			assert.Equal(t, tt.reason, urlErr.Reason)
+		})
+	}
+}
+
+func TestURLValidator_Schemes(t *testing.T) {
+	t.Parallel()
+
+	v := newURLValidator(0, []string{"HTTPS", "ftp"})
+
+	_, err := v.validate("ftp://example.com/f")
+	require.NoError(t, err)
+
+	_, err = v.validate("http://example.com")
+	require.ErrorIs(t, err, constants.ErrInvalidURL)
+
+	_, err = v.validate("https://example.com/" + strings.Repeat("a", 1<<16))
+	require.NoError(t, err)
+}